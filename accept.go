@@ -5,17 +5,21 @@ package websocket
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/textproto"
 	"net/url"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/oarkflow/websocket/internal/errd"
 )
@@ -24,9 +28,36 @@ import (
 type AcceptOptions struct {
 	// Subprotocols lists the WebSocket subprotocols that Accept will negotiate with the client.
 	// The empty subprotocol will always be negotiated as per RFC 6455. If you would like to
-	// reject it, close the connection when c.Subprotocol() == "".
+	// reject it, set RequireSubprotocol.
+	//
+	// An entry ending in * is a prefix that matches any subprotocol starting with it,
+	// e.g. "bearer.*" matches "bearer.abc123". The subprotocol offered by the client
+	// is then echoed back.
 	Subprotocols []string
 
+	// RequireSubprotocol makes Accept reject clients that offer none of Subprotocols
+	// with http.StatusBadRequest instead of negotiating the empty subprotocol.
+	//
+	// Setting it without Subprotocols is a configuration error: Accept then rejects
+	// every request with http.StatusInternalServerError.
+	RequireSubprotocol bool
+
+	// TCPKeepAlive sets the keep-alive period of the underlying TCP connection so that
+	// dead connections are detected by TCP independently of WebSocket pings.
+	// A negative value disables keep-alives. It has no effect on connections that are
+	// not TCP, e.g. over Unix sockets.
+	// Defaults to 0 which leaves the keep-alive configuration of the server or OS.
+	TCPKeepAlive time.Duration
+
+	// MaxHeaderBytes limits the total size of the handshake headers Accept parses,
+	// i.e. the Sec-WebSocket-* headers, Origin, Connection and Upgrade. Both the names
+	// and the values are counted. Accept responds with 431 Request Header Fields Too
+	// Large if it is exceeded.
+	//
+	// It complements http.Server.MaxHeaderBytes which bounds all headers of a request.
+	// Defaults to 0 which means no limit.
+	MaxHeaderBytes int
+
 	// InsecureSkipVerify is used to disable Accept's origin verification behaviour.
 	//
 	// You probably want to use OriginPatterns instead.
@@ -51,9 +82,21 @@ type AcceptOptions struct {
 	// to bring attention to the danger of such a setting.
 	OriginPatterns []string
 
+	// TrustForwardedHeaders makes the origin verification use the X-Forwarded-Host
+	// and X-Forwarded-Proto headers set by a reverse proxy as the request host and
+	// scheme. Otherwise the Origin of browsers behind the proxy never matches the
+	// host the proxy connects to. The first value of each header is used.
+	//
+	// Only enable it if every request passes through a proxy that sets or strips
+	// these headers as a client could otherwise spoof them to get around the check.
+	TrustForwardedHeaders bool
+
 	// CompressionMode controls the compression mode.
 	// Defaults to CompressionDisabled.
 	//
+	// With CompressionDisabled, the Sec-WebSocket-Extensions response header is never
+	// sent and so compression is never negotiated even if the client offers it.
+	//
 	// See docs on CompressionMode for details.
 	CompressionMode CompressionMode
 
@@ -61,7 +104,198 @@ type AcceptOptions struct {
 	//
 	// Defaults to 512 bytes for CompressionNoContextTakeover and 128 bytes
 	// for CompressionContextTakeover.
+	// It is ignored if CompressionOptions.ShouldCompress is set.
 	CompressionThreshold int
+
+	// CompressionOptions holds advanced permessage-deflate options.
+	// It is ignored when compression is disabled.
+	//
+	// See docs on CompressionOptions for details.
+	CompressionOptions *CompressionOptions
+
+	// Authorize is called with the request once the origin has been verified to
+	// authorize the client, e.g. with a token in a header.
+	//
+	// If it returns an error, Accept responds with 401 Unauthorized if the error
+	// wraps ErrUnauthorized and 403 Forbidden otherwise. The error is not written
+	// in the response.
+	//
+	// Otherwise the values of the returned context, e.g. a tenant ID, are available
+	// from the context returned by Conn.Context. Its cancellation has no effect on
+	// the connection and it may be nil.
+	Authorize func(r *http.Request) (context.Context, error)
+
+	// OnAccept is called synchronously with the connection once the handshake
+	// has completed but before Accept returns. Messages written in OnAccept are
+	// guaranteed to be sent before anything written after Accept returns, e.g.
+	// a welcome message required by a subprotocol.
+	//
+	// If OnAccept returns an error, the connection is closed with
+	// StatusInternalError and Accept returns the error.
+	OnAccept func(*Conn) error
+
+	// OnUpgradeError is called instead of writing the default error response
+	// when Accept rejects the upgrade, e.g. for a bad origin or a missing
+	// subprotocol, with the reason for the rejection. Accept still returns the
+	// error. OnUpgradeError must write the complete response to w, e.g. a JSON
+	// error with a custom status code.
+	//
+	// Defaults to nil which means the status code and error text are written
+	// with http.Error.
+	OnUpgradeError func(w http.ResponseWriter, r *http.Request, err error)
+
+	// OnConn is called with the connection right after a successful Accept.
+	//
+	// Use it to register connections in a registry such as wshub.Hub so that they
+	// may all be closed on shutdown.
+	OnConn func(*Conn)
+
+	// ConnLimiter limits the number of concurrent connections accepted from
+	// a single remote IP as determined by http.Request.RemoteAddr.
+	// Accept responds with 429 Too Many Requests once the limit is exceeded.
+	//
+	// Connections are counted by the ConnLimiter and so every Accept call
+	// sharing a ConnLimiter shares the limit. Use a ConnLimiter per endpoint
+	// for separate limits. Connections stop counting once closed. The limit is
+	// a *ConnLimiter rather than an int as the count must outlive any single
+	// AcceptOptions value, which handlers may build per request.
+	//
+	// Defaults to nil which means unlimited.
+	ConnLimiter *ConnLimiter
+
+	// ReadRateLimit limits the rate of data messages read from the client.
+	// Control frames are not limited.
+	//
+	// Once exceeded, the connection is closed with StatusPolicyViolation and
+	// Reader returns ErrReadRateLimited for the rejected message and every
+	// message after it.
+	//
+	// Defaults to nil which means unlimited.
+	ReadRateLimit *RateLimit
+
+	// Logf receives internal diagnostic messages such as close handshake
+	// failures, protocol violations and discarded control frames.
+	//
+	// Defaults to nil which means no logging.
+	Logf func(format string, v ...interface{})
+
+	// AllowUnmaskedFrames accepts unmasked frames from the client which
+	// RFC 6455 requires to be rejected. It pairs with DialOptions.DisableMasking.
+	//
+	// It is not RFC compliant and must only be used for testing and on
+	// trusted links where every client is known.
+	AllowUnmaskedFrames bool
+
+	// FrameHook is called with every frame read or written for debugging.
+	// It is purely observational. See docs on FrameHook.
+	FrameHook FrameHook
+
+	// WriteQueueSize is the maximum number of messages queued by Conn.WriteBuffered.
+	// Defaults to 16.
+	WriteQueueSize int
+
+	// MaxFrameSize is the maximum payload length of the data frames written. Longer
+	// messages are split into continuation frames of at most MaxFrameSize bytes
+	// for peers and middleboxes that do not handle large frames well. With
+	// compression, it applies to the compressed payload.
+	// Defaults to 0 which means a message written with Write is a single frame.
+	MaxFrameSize int
+
+	// BufferPool provides the scratch buffers into which Read, ReadWithInfo and
+	// TryRead read messages. Share it between connections to avoid growing a new
+	// buffer for every message. The returned message is still a new allocation of
+	// its exact size as it is owned by the application.
+	//
+	// The pool holds *bytes.Buffer values. Buffers larger than 1 MB are not returned
+	// to it. Buffers used by Reader, the compression buffers and the buffers of the
+	// underlying connection are not affected. Defaults to nil which means no pool.
+	BufferPool *sync.Pool
+
+	// HeartbeatInterval enables application level heartbeats for protocols that do
+	// not use ping and pong frames. Every HeartbeatInterval, the message returned by
+	// HeartbeatMessage is written.
+	//
+	// A heartbeat is acknowledged once a message for which IsHeartbeatAck reports true
+	// is read with Read, ReadWithInfo or TryRead. Acknowledgements are still returned
+	// to the application and messages read with Reader are not observed.
+	//
+	// If a heartbeat is not acknowledged by the time the next one is due, OnHeartbeatMiss
+	// is called if set and the connection is closed with StatusPolicyViolation.
+	//
+	// Heartbeats are only enabled if HeartbeatMessage and IsHeartbeatAck are set.
+	HeartbeatInterval time.Duration
+	HeartbeatMessage  func() (MessageType, []byte)
+	IsHeartbeatAck    func(typ MessageType, p []byte) bool
+	OnHeartbeatMiss   func()
+
+	// ManualCloseHandshake disables the automatic reply to close frames from the
+	// peer. The close frame is returned by Reader and Read as a CloseError and the
+	// connection is left open so that the application, e.g. a proxy, can forward
+	// the close frame before replying with Close.
+	//
+	// Close then only writes the reply if a close frame has already been received.
+	// CloseRead is unaffected and closes the connection once it reads a close frame.
+	ManualCloseHandshake bool
+
+	// DeliverControlFrames makes Reader and Read return the ping and pong frames
+	// received as messages of type MessagePing and MessagePong with the frame payload,
+	// e.g. for protocols that carry a liveness token in pings. The frames are still
+	// handled as usual, i.e. pings are replied to unless DisableAutoPong is set.
+	//
+	// Frames received while a message is read are returned after it. At most 16 are
+	// held and later ones are dropped. NetConn and Router ignore them, but other code
+	// reading from the connection, e.g. wsjson.Read, must expect them.
+	DeliverControlFrames bool
+
+	// DisableAutoPong disables the automatic pong reply to pings. Reply with
+	// Conn.WriteControl and ControlPong instead if required by the protocol.
+	DisableAutoPong bool
+
+	// StrictConcurrency makes Reader and Read fail with ErrConcurrentReader when
+	// another goroutine is reading and Writer and Write fail with ErrConcurrentWriter
+	// when another message is being written instead of waiting. A second Writer
+	// opened before the first is closed then fails instead of blocking forever.
+	// Use it to find misuse. The heartbeats and WriteBuffered still wait their turn.
+	StrictConcurrency bool
+
+	// PongOnData makes the connection write an unsolicited empty pong once each
+	// data message has been read to completion. It is for peers that rely on
+	// receiving frames for liveness but never send pings. Pongs in reply to pings
+	// are unaffected.
+	PongOnData bool
+
+	// RejectFragmentedMessages makes the connection fail with a ProtocolError of
+	// reason FragmentedMessage and close with StatusProtocolError as soon as the
+	// first frame of a fragmented data message is read, e.g. for subprotocols
+	// that forbid fragmentation. Control frames are never fragmented and so are
+	// still allowed.
+	RejectFragmentedMessages bool
+
+	// Extensions lists the custom extensions to negotiate in addition to
+	// permessage-deflate. The client's offers are accepted in the order they
+	// are offered with the Accept method of the Extension of the same name.
+	//
+	// See Extension.
+	Extensions []Extension
+
+	// WriteTimeout bounds every Writer, Write and Flush call whose context has
+	// no deadline, e.g. context.Background(), so that a write to a peer that
+	// stopped reading does not block forever. A deadline of the context or of
+	// SetWriteDeadline takes precedence. As with an expired context, the
+	// connection is closed when the timeout is hit during a write.
+	//
+	// Defaults to no timeout.
+	WriteTimeout time.Duration
+
+	// OnWriteComplete is called once each data message has been written with
+	// the length of its payload before and after compression, e.g. to tune
+	// CompressionThreshold. compressed equals uncompressed if the message was
+	// not compressed. compressed does not include the 4 bytes of the DEFLATE
+	// block trailer stripped from compressed messages as per RFC 7692.
+	//
+	// It is called synchronously by the goroutine that wrote the message once
+	// the next message may be written.
+	OnWriteComplete func(typ MessageType, uncompressed, compressed int)
 }
 
 func (opts *AcceptOptions) cloneWithDefaults() *AcceptOptions {
@@ -72,6 +306,20 @@ func (opts *AcceptOptions) cloneWithDefaults() *AcceptOptions {
 	return &o
 }
 
+// reject responds to the rejected upgrade request r with OnUpgradeError if set
+// and otherwise with the status code and msg.
+func (opts *AcceptOptions) reject(w http.ResponseWriter, r *http.Request, code int, msg string, err error) {
+	if opts.OnUpgradeError != nil {
+		opts.OnUpgradeError(w, r, err)
+		return
+	}
+	http.Error(w, msg, code)
+}
+
+// ErrUnauthorized can be wrapped by the error returned from AcceptOptions.Authorize
+// to respond with 401 Unauthorized instead of 403 Forbidden.
+var ErrUnauthorized = errors.New("unauthorized")
+
 // Accept accepts a WebSocket handshake from a client and upgrades the
 // the connection to a WebSocket.
 //
@@ -88,30 +336,86 @@ func Accept(w http.ResponseWriter, r *http.Request, opts *AcceptOptions) (*Conn,
 
 func accept(w http.ResponseWriter, r *http.Request, opts *AcceptOptions) (_ *Conn, err error) {
 	defer errd.Wrap(&err, "failed to accept WebSocket connection")
+	handshakeStart := time.Now()
+
+	opts = opts.cloneWithDefaults()
+	if opts.RequireSubprotocol && len(opts.Subprotocols) == 0 {
+		err = errors.New("RequireSubprotocol is set without any Subprotocols")
+		opts.reject(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), err)
+		return nil, err
+	}
+	if opts.MaxHeaderBytes > 0 {
+		n := handshakeHeaderBytes(r.Header)
+		if n > opts.MaxHeaderBytes {
+			err = fmt.Errorf("handshake headers of %v bytes exceed %v bytes", n, opts.MaxHeaderBytes)
+			opts.reject(w, r, http.StatusRequestHeaderFieldsTooLarge, err.Error(), err)
+			return nil, err
+		}
+	}
 
 	errCode, err := verifyClientRequest(w, r)
 	if err != nil {
-		http.Error(w, err.Error(), errCode)
+		opts.reject(w, r, errCode, err.Error(), err)
 		return nil, err
 	}
 
-	opts = opts.cloneWithDefaults()
 	if !opts.InsecureSkipVerify {
-		err = authenticateOrigin(r, opts.OriginPatterns)
+		err = authenticateOrigin(r, opts.OriginPatterns, opts.TrustForwardedHeaders)
 		if err != nil {
 			if errors.Is(err, path.ErrBadPattern) {
 				log.Printf("websocket: %v", err)
 				err = errors.New(http.StatusText(http.StatusForbidden))
 			}
-			http.Error(w, err.Error(), http.StatusForbidden)
+			opts.reject(w, r, http.StatusForbidden, err.Error(), err)
+			return nil, err
+		}
+	}
+
+	var baseCtx context.Context
+	if opts.Authorize != nil {
+		baseCtx, err = opts.Authorize(r)
+		if err != nil {
+			code := http.StatusForbidden
+			if errors.Is(err, ErrUnauthorized) {
+				code = http.StatusUnauthorized
+			}
+			err = fmt.Errorf("failed to authorize: %w", err)
+			opts.reject(w, r, code, http.StatusText(code), err)
 			return nil, err
 		}
 	}
 
+	subproto := selectSubprotocol(r, opts.Subprotocols)
+	if subproto == "" && opts.RequireSubprotocol {
+		err = fmt.Errorf("client offered none of the supported subprotocols %q", opts.Subprotocols)
+		opts.reject(w, r, http.StatusBadRequest, err.Error(), err)
+		return nil, err
+	}
+
+	var onClose func()
+	if opts.ConnLimiter != nil {
+		ip := remoteIP(r)
+		if !opts.ConnLimiter.acquire(ip) {
+			err = fmt.Errorf("too many connections from %q", ip)
+			opts.reject(w, r, http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests), err)
+			return nil, err
+		}
+		limiter := opts.ConnLimiter
+		onClose = func() {
+			limiter.release(ip)
+		}
+		defer func() {
+			// Once the connection is created, it releases the count when closed.
+			if err != nil && onClose != nil {
+				onClose()
+			}
+		}()
+	}
+
 	hj, ok := hijacker(w)
 	if !ok {
 		err = errors.New("http.ResponseWriter does not implement http.Hijacker")
-		http.Error(w, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+		opts.reject(w, r, http.StatusNotImplemented, http.StatusText(http.StatusNotImplemented), err)
 		return nil, err
 	}
 
@@ -121,14 +425,36 @@ func accept(w http.ResponseWriter, r *http.Request, opts *AcceptOptions) (_ *Con
 	key := r.Header.Get("Sec-WebSocket-Key")
 	w.Header().Set("Sec-WebSocket-Accept", secWebSocketAccept(key))
 
-	subproto := selectSubprotocol(r, opts.Subprotocols)
 	if subproto != "" {
 		w.Header().Set("Sec-WebSocket-Protocol", subproto)
 	}
 
-	copts, ok := selectDeflate(websocketExtensions(r.Header), opts.CompressionMode)
+	offers := websocketExtensions(r.Header)
+	exts, extElems, err := acceptExtensions(offers, opts.Extensions)
+	if err != nil {
+		opts.reject(w, r, http.StatusBadRequest, err.Error(), err)
+		return nil, err
+	}
+
+	var compressionMemory int64
+	copts, ok := selectDeflate(offers, opts.CompressionMode)
 	if ok {
-		w.Header().Set("Sec-WebSocket-Extensions", copts.String())
+		copts.setOptions(opts.CompressionOptions)
+		compressionMemory = opts.CompressionOptions.reserveMemory(copts, false)
+		defer func() {
+			// Once the connection is created, it releases the memory when closed.
+			if err != nil && compressionMemory > 0 {
+				opts.CompressionOptions.releaseMemory(compressionMemory)
+			}
+		}()
+		extElems = append([]string{copts.String()}, extElems...)
+	}
+	if len(extElems) > 0 {
+		w.Header().Set("Sec-WebSocket-Extensions", strings.Join(extElems, ", "))
+	} else {
+		// Never negotiate an extension we do not implement, even if the
+		// handler set the header before calling Accept.
+		w.Header().Del("Sec-WebSocket-Extensions")
 	}
 
 	w.WriteHeader(http.StatusSwitchingProtocols)
@@ -146,20 +472,92 @@ func accept(w http.ResponseWriter, r *http.Request, opts *AcceptOptions) (_ *Con
 		return nil, err
 	}
 
+	err = setTCPKeepAlive(netConn, opts.TCPKeepAlive)
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("failed to set TCP keep-alive: %w", err)
+	}
+
 	// https://github.com/golang/go/issues/32314
 	b, _ := brw.Reader.Peek(brw.Reader.Buffered())
 	brw.Reader.Reset(io.MultiReader(bytes.NewReader(b), netConn))
 
-	return newConn(connConfig{
-		subprotocol:    w.Header().Get("Sec-WebSocket-Protocol"),
-		rwc:            netConn,
-		client:         false,
-		copts:          copts,
-		flateThreshold: opts.CompressionThreshold,
+	c := newConn(connConfig{
+		subprotocol:       w.Header().Get("Sec-WebSocket-Protocol"),
+		extensions:        w.Header().Get("Sec-WebSocket-Extensions"),
+		peerExtensions:    strings.Join(r.Header.Values("Sec-WebSocket-Extensions"), ", "),
+		rwc:               netConn,
+		client:            false,
+		copts:             copts,
+		flateThreshold:    opts.CompressionThreshold,
+		maxFrameSize:      opts.MaxFrameSize,
+		logf:              opts.Logf,
+		allowUnmasked:     opts.AllowUnmaskedFrames,
+		frameHook:         opts.FrameHook,
+		writeQueueSize:    opts.WriteQueueSize,
+		manualClose:       opts.ManualCloseHandshake,
+		deliverControl:    opts.DeliverControlFrames,
+		noAutoPong:        opts.DisableAutoPong,
+		strictConcurrency: opts.StrictConcurrency,
+		pongOnData:        opts.PongOnData,
+		rejectFragmented:  opts.RejectFragmentedMessages,
+		exts:              exts,
+		writeTimeout:      opts.WriteTimeout,
+		onWriteComplete:   opts.OnWriteComplete,
+		bufferPool:        opts.BufferPool,
+		onClose:           onClose,
+		readRateLimit:     opts.ReadRateLimit,
+		baseCtx:           baseCtx,
+		heartbeat: heartbeat{
+			interval: opts.HeartbeatInterval,
+			message:  opts.HeartbeatMessage,
+			isAck:    opts.IsHeartbeatAck,
+			onMiss:   opts.OnHeartbeatMiss,
+		},
+
+		handshakeStart:    handshakeStart,
+		handshakeDuration: time.Since(handshakeStart),
+
+		remoteAddr: netConn.RemoteAddr(),
+		tlsState:   r.TLS,
+
+		compressionBudget: opts.CompressionOptions,
+		compressionMemory: compressionMemory,
 
 		br: brw.Reader,
 		bw: brw.Writer,
-	}), nil
+	})
+	onClose = nil
+	compressionMemory = 0
+
+	if opts.OnAccept != nil {
+		err = opts.OnAccept(c)
+		if err != nil {
+			c.Close(StatusInternalError, "failed to accept")
+			return nil, fmt.Errorf("failed to run OnAccept: %w", err)
+		}
+	}
+	if opts.OnConn != nil {
+		opts.OnConn(c)
+	}
+	return c, nil
+}
+
+// handshakeHeaderBytes returns the total size of the names and values
+// of the headers parsed by Accept.
+func handshakeHeaderBytes(h http.Header) int {
+	var n int
+	for k, vv := range h {
+		switch {
+		case strings.HasPrefix(k, "Sec-Websocket-"), k == "Origin", k == "Connection", k == "Upgrade":
+		default:
+			continue
+		}
+		for _, v := range vv {
+			n += len(k) + len(v)
+		}
+	}
+	return n
 }
 
 func verifyClientRequest(w http.ResponseWriter, r *http.Request) (errCode int, _ error) {
@@ -206,7 +604,7 @@ func verifyClientRequest(w http.ResponseWriter, r *http.Request) (errCode int, _
 	return 0, nil
 }
 
-func authenticateOrigin(r *http.Request, originHosts []string) error {
+func authenticateOrigin(r *http.Request, originHosts []string, trustForwarded bool) error {
 	origin := r.Header.Get("Origin")
 	if origin == "" {
 		return nil
@@ -217,7 +615,18 @@ func authenticateOrigin(r *http.Request, originHosts []string) error {
 		return fmt.Errorf("failed to parse Origin header %q: %w", origin, err)
 	}
 
-	if strings.EqualFold(r.Host, u.Host) {
+	host := r.Host
+	sameScheme := true
+	if trustForwarded {
+		if fh := firstForwarded(r.Header, "X-Forwarded-Host"); fh != "" {
+			host = fh
+		}
+		if proto := firstForwarded(r.Header, "X-Forwarded-Proto"); proto != "" {
+			sameScheme = strings.EqualFold(httpScheme(proto), httpScheme(u.Scheme))
+		}
+	}
+
+	if sameScheme && strings.EqualFold(host, u.Host) {
 		return nil
 	}
 
@@ -233,7 +642,27 @@ func authenticateOrigin(r *http.Request, originHosts []string) error {
 	if u.Host == "" {
 		return fmt.Errorf("request Origin %q is not a valid URL with a host", origin)
 	}
-	return fmt.Errorf("request Origin %q is not authorized for Host %q", u.Host, r.Host)
+	return fmt.Errorf("request Origin %q is not authorized for Host %q", u.Host, host)
+}
+
+// firstForwarded returns the first value of the comma separated
+// forwarding header key as set by the proxy closest to the client.
+func firstForwarded(h http.Header, key string) string {
+	v, _, _ := strings.Cut(h.Get(key), ",")
+	return strings.TrimSpace(v)
+}
+
+// httpScheme maps the WebSocket schemes to the HTTP
+// schemes they are upgraded from.
+func httpScheme(scheme string) string {
+	switch strings.ToLower(scheme) {
+	case "ws":
+		return "http"
+	case "wss":
+		return "https"
+	default:
+		return strings.ToLower(scheme)
+	}
 }
 
 func match(pattern, s string) (bool, error) {
@@ -244,7 +673,7 @@ func selectSubprotocol(r *http.Request, subprotocols []string) string {
 	cps := headerTokens(r.Header, "Sec-WebSocket-Protocol")
 	for _, sp := range subprotocols {
 		for _, cp := range cps {
-			if strings.EqualFold(sp, cp) {
+			if matchSubprotocol(sp, cp) {
 				return cp
 			}
 		}
@@ -252,6 +681,16 @@ func selectSubprotocol(r *http.Request, subprotocols []string) string {
 	return ""
 }
 
+// matchSubprotocol reports whether the client subprotocol cp matches sp
+// which may be a prefix ending in *.
+func matchSubprotocol(sp, cp string) bool {
+	prefix := strings.TrimSuffix(sp, "*")
+	if prefix == sp {
+		return strings.EqualFold(sp, cp)
+	}
+	return len(cp) >= len(prefix) && strings.EqualFold(prefix, cp[:len(prefix)])
+}
+
 func selectDeflate(extensions []websocketExtension, mode CompressionMode) (*compressionOptions, bool) {
 	if mode == CompressionDisabled {
 		return nil, false
@@ -294,6 +733,14 @@ func acceptDeflate(ext websocketExtension, mode CompressionMode) (*compressionOp
 	return copts, true
 }
 
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func headerContainsTokenIgnoreCase(h http.Header, key, token string) bool {
 	for _, t := range headerTokens(h, key) {
 		if strings.EqualFold(t, token) {
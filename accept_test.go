@@ -0,0 +1,597 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestAcceptConnLimiter(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	limiterA := websocket.NewConnLimiter(2)
+	limiterB := websocket.NewConnLimiter(1)
+	assert.Equal(t, "max per IP", 2, limiterA.MaxPerIP())
+	handler := func(l *websocket.ConnLimiter) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+				ConnLimiter: l,
+			})
+			if err != nil {
+				return
+			}
+			c.CloseRead(context.Background())
+		}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/a", handler(limiterA))
+	mux.Handle("/b", handler(limiterB))
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	dial := func(path string) (*websocket.Conn, *http.Response, error) {
+		return websocket.Dial(ctx, s.URL+path, nil)
+	}
+
+	for i := 0; i < 2; i++ {
+		c, _, err := dial("/a")
+		assert.Success(t, err)
+		defer c.CloseNow()
+	}
+	_, resp, err := dial("/a")
+	assert.Error(t, err)
+	assert.Equal(t, "status code", http.StatusTooManyRequests, resp.StatusCode)
+
+	// /b has its own limit unaffected by the connections to /a.
+	c, _, err := dial("/b")
+	assert.Success(t, err)
+	_, resp, err = dial("/b")
+	assert.Error(t, err)
+	assert.Equal(t, "status code", http.StatusTooManyRequests, resp.StatusCode)
+
+	// Closing a connection releases its slot.
+	c.Close(websocket.StatusNormalClosure, "")
+	for limiterB.Count("127.0.0.1") != 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("connection was not released")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	c, _, err = dial("/b")
+	assert.Success(t, err)
+	c.CloseNow()
+}
+
+func TestAcceptRequireSubprotocol(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			Subprotocols:       []string{"echo"},
+			RequireSubprotocol: true,
+		})
+		if err != nil {
+			return
+		}
+		c.CloseNow()
+	}))
+	defer s.Close()
+
+	_, resp, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		Subprotocols: []string{"other"},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "status code", http.StatusBadRequest, resp.StatusCode)
+
+	c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		Subprotocols: []string{"other", "echo"},
+	})
+	assert.Success(t, err)
+	assert.Equal(t, "subprotocol", "echo", c.Subprotocol())
+	c.CloseNow()
+}
+
+func TestAcceptRequireSubprotocolWithoutSubprotocols(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	acceptErrs := make(chan error, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			RequireSubprotocol: true,
+		})
+		acceptErrs <- err
+		if err != nil {
+			return
+		}
+		c.CloseNow()
+	}))
+	defer s.Close()
+
+	_, resp, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		Subprotocols: []string{"echo"},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "status code", http.StatusInternalServerError, resp.StatusCode)
+	assert.Contains(t, <-acceptErrs, "RequireSubprotocol is set without any Subprotocols")
+}
+
+func TestAcceptSubprotocolPrefix(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			Subprotocols: []string{"bearer.*"},
+		})
+		if err != nil {
+			return
+		}
+		c.CloseNow()
+	}))
+	defer s.Close()
+
+	for offered, exp := range map[string]string{
+		"bearer.abc123": "bearer.abc123",
+		"bearer":        "",
+		"other":         "",
+	} {
+		c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+			Subprotocols: []string{offered},
+		})
+		assert.Success(t, err)
+		assert.Equal(t, "subprotocol for "+offered, exp, c.Subprotocol())
+		c.CloseNow()
+	}
+}
+
+func TestAcceptAuthorize(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	type tenantKey struct{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			Authorize: func(r *http.Request) (context.Context, error) {
+				switch r.Header.Get("X-Tenant") {
+				case "":
+					return nil, errors.New("missing tenant")
+				case "unknown":
+					return nil, fmt.Errorf("unknown tenant: %w", websocket.ErrUnauthorized)
+				}
+				return context.WithValue(r.Context(), tenantKey{}, r.Header.Get("X-Tenant")), nil
+			},
+		})
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+		tenant, _ := c.Context().Value(tenantKey{}).(string)
+		c.Write(c.Context(), websocket.MessageText, []byte(tenant))
+	}))
+	defer s.Close()
+
+	for tenant, code := range map[string]int{
+		"":        http.StatusForbidden,
+		"unknown": http.StatusUnauthorized,
+	} {
+		_, resp, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+			HTTPHeader: http.Header{"X-Tenant": []string{tenant}},
+		})
+		assert.Error(t, err)
+		assert.Equal(t, "status code", code, resp.StatusCode)
+	}
+
+	c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		HTTPHeader: http.Header{"X-Tenant": []string{"acme"}},
+	})
+	assert.Success(t, err)
+	defer c.CloseNow()
+	_, p, err := c.Read(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "tenant", "acme", string(p))
+}
+
+func TestAcceptMaxHeaderBytes(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			Subprotocols:   []string{"echo"},
+			MaxHeaderBytes: 1024,
+		})
+		if err != nil {
+			return
+		}
+		c.CloseNow()
+	}))
+	defer s.Close()
+
+	_, resp, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		Subprotocols: []string{strings.Repeat("x", 2048)},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "status code", http.StatusRequestHeaderFieldsTooLarge, resp.StatusCode)
+
+	c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		Subprotocols: []string{"echo"},
+	})
+	assert.Success(t, err)
+	c.CloseNow()
+}
+
+func TestAcceptClientExtensionsOffered(t *testing.T) {
+	t.Parallel()
+
+	c1, c2 := wstest.Pipe(&websocket.DialOptions{
+		CompressionMode: websocket.CompressionContextTakeover,
+	}, &websocket.AcceptOptions{
+		CompressionMode: websocket.CompressionDisabled,
+	})
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	assert.Equal(t, "server extensions", "", c2.Extensions())
+	assert.Contains(t, c2.ClientExtensionsOffered(), "permessage-deflate")
+	assert.Equal(t, "server extensions offered on server", "", c2.ServerExtensionsOffered())
+
+	assert.Equal(t, "client extensions", "", c1.Extensions())
+	assert.Equal(t, "server extensions offered", "", c1.ServerExtensionsOffered())
+	assert.Equal(t, "client extensions offered on client", "", c1.ClientExtensionsOffered())
+}
+
+func TestAcceptCompressionDisabled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Removed by Accept as compression is disabled.
+		w.Header().Set("Sec-WebSocket-Extensions", "permessage-deflate")
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			CompressionMode: websocket.CompressionDisabled,
+		})
+		if err != nil {
+			return
+		}
+		c.CloseRead(context.Background())
+	}))
+	defer s.Close()
+
+	c, resp, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		CompressionMode: websocket.CompressionContextTakeover,
+	})
+	assert.Success(t, err)
+	defer c.CloseNow()
+
+	if v, ok := resp.Header["Sec-Websocket-Extensions"]; ok {
+		t.Fatalf("unexpected Sec-WebSocket-Extensions response header: %q", v)
+	}
+	assert.Equal(t, "client extensions", "", c.Extensions())
+}
+
+func TestAcceptTrustForwardedHeaders(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	newServer := func(trust bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+				TrustForwardedHeaders: trust,
+			})
+			if err != nil {
+				return
+			}
+			c.Close(websocket.StatusNormalClosure, "")
+		}))
+	}
+	trusted := newServer(true)
+	defer trusted.Close()
+	untrusted := newServer(false)
+	defer untrusted.Close()
+
+	// As forwarded by a reverse proxy that connects to the server as backend.internal.
+	dial := func(s *httptest.Server, proto string) (*http.Response, error) {
+		c, resp, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+			Host: "backend.internal",
+			HTTPHeader: http.Header{
+				"Origin":            []string{"https://chat.example.com"},
+				"X-Forwarded-Host":  []string{"chat.example.com, proxy.example.com"},
+				"X-Forwarded-Proto": []string{proto},
+			},
+		})
+		if err == nil {
+			c.CloseNow()
+		}
+		return resp, err
+	}
+
+	_, err := dial(trusted, "https")
+	assert.Success(t, err)
+
+	resp, err := dial(trusted, "http")
+	assert.Error(t, err)
+	assert.Equal(t, "mismatched scheme status code", http.StatusForbidden, resp.StatusCode)
+
+	resp, err = dial(untrusted, "https")
+	assert.Error(t, err)
+	assert.Equal(t, "untrusted status code", http.StatusForbidden, resp.StatusCode)
+}
+
+func TestSubprotocolAfterHandshake(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	serverSubprotocols := make(chan string, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			Subprotocols: []string{"echo"},
+		})
+		if err != nil {
+			serverSubprotocols <- err.Error()
+			return
+		}
+		defer c.CloseNow()
+		// No I/O before the subprotocol is checked.
+		serverSubprotocols <- c.Subprotocol()
+	}))
+	defer s.Close()
+
+	for offered, exp := range map[string]string{
+		"echo":  "echo",
+		"other": "",
+		"":      "",
+	} {
+		var subprotocols []string
+		if offered != "" {
+			subprotocols = []string{offered}
+		}
+		c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+			Subprotocols: subprotocols,
+		})
+		assert.Success(t, err)
+		assert.Equal(t, "client subprotocol for "+offered, exp, c.Subprotocol())
+		assert.Equal(t, "server subprotocol for "+offered, exp, <-serverSubprotocols)
+		c.CloseNow()
+	}
+}
+
+func TestAcceptOnUpgradeError(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	upgradeErrs := make(chan error, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			OnUpgradeError: func(w http.ResponseWriter, r *http.Request, err error) {
+				upgradeErrs <- err
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error": "origin_not_allowed",
+				})
+			},
+		})
+		if err != nil {
+			return
+		}
+		c.CloseNow()
+	}))
+	defer s.Close()
+
+	_, resp, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Origin": []string{"https://evil.example.com"},
+		},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "status code", http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, "content type", "application/json", resp.Header.Get("Content-Type"))
+
+	var body map[string]string
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	assert.Success(t, err)
+	assert.Equal(t, "body", map[string]string{"error": "origin_not_allowed"}, body)
+
+	select {
+	case err := <-upgradeErrs:
+		assert.Contains(t, err, "not authorized")
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+}
+
+func TestAcceptPeerInfo(t *testing.T) {
+	t.Parallel()
+
+	type peerInfo struct {
+		remoteAddr net.Addr
+		tls        *tls.ConnectionState
+	}
+	handler := func(infos chan<- peerInfo) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			c, err := websocket.Accept(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer c.CloseNow()
+			infos <- peerInfo{c.RemoteAddr(), c.TLS()}
+			c.Close(websocket.StatusNormalClosure, "")
+		}
+	}
+
+	t.Run("tls", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		infos := make(chan peerInfo, 1)
+		s := httptest.NewTLSServer(handler(infos))
+		defer s.Close()
+
+		c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+			HTTPClient: s.Client(),
+		})
+		assert.Success(t, err)
+		defer c.CloseNow()
+
+		info := <-infos
+		if info.tls == nil {
+			t.Fatal("expected TLS connection state")
+		}
+		assert.Equal(t, "handshake complete", true, info.tls.HandshakeComplete)
+		if info.tls.CipherSuite == 0 {
+			t.Fatal("expected a negotiated cipher suite")
+		}
+		if c.TLS() == nil {
+			t.Fatal("expected TLS connection state on the client")
+		}
+		assert.Equal(t, "cipher suite", tls.CipherSuiteName(c.TLS().CipherSuite), tls.CipherSuiteName(info.tls.CipherSuite))
+
+		host, _, err := net.SplitHostPort(info.remoteAddr.String())
+		assert.Success(t, err)
+		assert.Equal(t, "remote host", "127.0.0.1", host)
+		assert.Equal(t, "client remote addr", nil, c.RemoteAddr())
+
+		c.CloseRead(ctx)
+	})
+
+	t.Run("plain", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		infos := make(chan peerInfo, 1)
+		s := httptest.NewServer(handler(infos))
+		defer s.Close()
+
+		c, _, err := websocket.Dial(ctx, s.URL, nil)
+		assert.Success(t, err)
+		defer c.CloseNow()
+
+		info := <-infos
+		if info.tls != nil {
+			t.Fatalf("unexpected TLS connection state: %+v", info.tls)
+		}
+		if info.remoteAddr == nil {
+			t.Fatal("expected remote address")
+		}
+		if c.TLS() != nil {
+			t.Fatalf("unexpected TLS connection state on the client: %+v", c.TLS())
+		}
+
+		c.CloseRead(ctx)
+	})
+}
+
+func TestAcceptOnAccept(t *testing.T) {
+	t.Parallel()
+
+	t.Run("welcome", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+				OnAccept: func(c *websocket.Conn) error {
+					return c.Write(r.Context(), websocket.MessageText, []byte("welcome"))
+				},
+			})
+			if err != nil {
+				return
+			}
+			defer c.CloseNow()
+
+			err = c.Write(r.Context(), websocket.MessageText, []byte("after accept"))
+			if err != nil {
+				return
+			}
+			c.Close(websocket.StatusNormalClosure, "")
+		}))
+		defer s.Close()
+
+		c, _, err := websocket.Dial(ctx, s.URL, nil)
+		assert.Success(t, err)
+		defer c.CloseNow()
+
+		for _, exp := range []string{"welcome", "after accept"} {
+			_, b, err := c.Read(ctx)
+			assert.Success(t, err)
+			assert.Equal(t, "message", exp, string(b))
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		acceptErrs := make(chan error, 1)
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+				OnAccept: func(c *websocket.Conn) error {
+					return errors.New("session expired")
+				},
+			})
+			acceptErrs <- err
+			if err != nil {
+				return
+			}
+			c.CloseNow()
+		}))
+		defer s.Close()
+
+		c, _, err := websocket.Dial(ctx, s.URL, nil)
+		assert.Success(t, err)
+		defer c.CloseNow()
+
+		_, _, err = c.Read(ctx)
+		assert.Equal(t, "close status", websocket.StatusInternalError, websocket.CloseStatus(err))
+
+		select {
+		case err := <-acceptErrs:
+			assert.Contains(t, err, "session expired")
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+	})
+}
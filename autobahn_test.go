@@ -0,0 +1,45 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+// TestAutobahn runs the Autobahn TestSuite against the fuzzingserver at
+// AUTOBAHN_SERVER_URL which ci/autobahn.sh starts. The report is read from
+// AUTOBAHN_REPORT_DIR, the reports directory of the fuzzingserver.
+func TestAutobahn(t *testing.T) {
+	t.Parallel()
+
+	serverURL := os.Getenv("AUTOBAHN_SERVER_URL")
+	if serverURL == "" {
+		t.Skip("AUTOBAHN_SERVER_URL is not set")
+	}
+	reportDir := os.Getenv("AUTOBAHN_REPORT_DIR")
+	if reportDir == "" {
+		reportDir = "ci/out/autobahn-report"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*15)
+	defer cancel()
+
+	const agent = "websocket"
+	err := wstest.RunAutobahnClient(ctx, serverURL, agent, &websocket.DialOptions{
+		CompressionMode: websocket.CompressionContextTakeover,
+	})
+	if errors.Is(err, wstest.ErrAutobahnUnavailable) {
+		t.Skip(err)
+	}
+	assert.Success(t, err)
+	assert.Success(t, wstest.CheckAutobahnReport(reportDir, agent))
+}
@@ -0,0 +1,39 @@
+#!/bin/sh
+set -eu
+cd -- "$(dirname "$0")/.."
+
+# Runs TestAutobahn against the Autobahn TestSuite fuzzingserver in docker.
+# The HTML report is written to ci/out/autobahn-report.
+
+mkdir -p ci/out/autobahn-report
+cat >ci/out/fuzzingserver.json <<JSON
+{
+  "url": "ws://127.0.0.1:9001",
+  "outdir": "/reports",
+  "cases": ["*"],
+  "exclude-cases": ["9.*", "12.*", "13.*"]
+}
+JSON
+
+docker run --rm -d --name websocket-autobahn \
+  -p 9001:9001 \
+  -v "$PWD/ci/out/fuzzingserver.json:/config/fuzzingserver.json:ro" \
+  -v "$PWD/ci/out/autobahn-report:/reports" \
+  crossbario/autobahn-testsuite \
+  wstest -m fuzzingserver -s /config/fuzzingserver.json
+trap 'docker stop websocket-autobahn >/dev/null' EXIT
+
+# Wait for the fuzzingserver to listen.
+i=0
+until curl -s -o /dev/null http://127.0.0.1:9001; do
+  i=$((i + 1))
+  if [ "$i" -gt 100 ]; then
+    echo "fuzzingserver did not start" >&2
+    exit 1
+  fi
+  sleep 0.1
+done
+
+AUTOBAHN_SERVER_URL=ws://127.0.0.1:9001 \
+  AUTOBAHN_REPORT_DIR=ci/out/autobahn-report \
+  go test -run=TestAutobahn -count=1 -v "$@" .
@@ -31,3 +31,9 @@ GOOS=js GOARCH=wasm govulncheck ./...
   staticcheck ./...
   govulncheck ./...
 )
+(
+  cd ./wspb
+  go vet ./...
+  staticcheck ./...
+  govulncheck ./...
+)
@@ -10,6 +10,10 @@ cd -- "$(dirname "$0")/.."
   cd ./internal/thirdparty
   go test "$@" ./...
 )
+(
+  cd ./wspb
+  go test "$@" ./...
+)
 
 (
   GOARCH=arm64 go test -c -o ./ci/out/websocket-arm64.test "$@" .
@@ -25,6 +29,20 @@ cd -- "$(dirname "$0")/.."
 
 
 go install github.com/agnivade/wasmbrowsertest@latest
+(
+  wsjstestOut="$(mktemp -d)/stdout"
+  go build -o ./ci/out/wsjstest ./internal/test/wsjstest
+  ./ci/out/wsjstest >"$wsjstestOut" 2>&1 &
+  wsjstestPID=$!
+  trap 'kill "$wsjstestPID"' EXIT
+
+  while [ ! -s "$wsjstestOut" ]; do
+    sleep 0.1
+  done
+  export WS_ECHO_SERVER_URL="$(head -n 1 "$wsjstestOut")"
+
+  GOOS=js GOARCH=wasm go test -exec=wasmbrowsertest "$@" .
+)
 go test --race --bench=. --timeout=1h --covermode=atomic --coverprofile=ci/out/coverage.prof --coverpkg=./... "$@" ./...
 sed -i.bak '/stringer\.go/d' ci/out/coverage.prof
 sed -i.bak '/nhooyr.io\/websocket\/internal\/test/d' ci/out/coverage.prof
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"net"
 	"time"
+	"unicode/utf8"
 
 	"github.com/oarkflow/websocket/internal/errd"
 )
@@ -84,6 +85,18 @@ func CloseStatus(err error) StatusCode {
 	return -1
 }
 
+// CloseReason is a convenience wrapper around Go 1.13's errors.As to grab
+// the status code and reason from a CloseError.
+//
+// ok is false if the passed error is nil or not a CloseError.
+func CloseReason(err error) (code StatusCode, reason string, ok bool) {
+	var ce CloseError
+	if errors.As(err, &ce) {
+		return ce.Code, ce.Reason, true
+	}
+	return -1, "", false
+}
+
 // Close performs the WebSocket close handshake with the given status code and reason.
 //
 // It will write a WebSocket close frame with a timeout of 5s and then wait 5s for
@@ -114,6 +127,9 @@ func (c *Conn) Close(code StatusCode, reason string) (err error) {
 	}()
 
 	err = c.closeHandshake(code, reason)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		c.debugf("close handshake failed: %v", err)
+	}
 
 	err2 := c.close()
 	if err == nil && err2 != nil {
@@ -128,6 +144,68 @@ func (c *Conn) Close(code StatusCode, reason string) (err error) {
 	return err
 }
 
+// CloseGraceful is like Close but first waits for the messages queued with
+// WriteBuffered and the message being written with Writer or Write to be written
+// and flushes the messages held back by SetWriteCoalesce. Thus the messages written
+// before CloseGraceful is called reach the peer before the close frame.
+//
+// ctx bounds the whole close. If it expires, the connection is closed without
+// a close handshake as with CloseNow and the ctx error is returned.
+func (c *Conn) CloseGraceful(ctx context.Context, code StatusCode, reason string) (err error) {
+	defer errd.Wrap(&err, "failed to close WebSocket gracefully")
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.CloseNow()
+		case <-done:
+		}
+	}()
+
+	err = c.drainWrites(ctx)
+	if err == nil {
+		err = c.Close(code, reason)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// CloseWithPayload is like Close but takes the reason as raw bytes.
+// Use it to send a structured machine readable reason such as a small JSON object.
+//
+// The payload must be valid UTF-8 and at most 123 bytes. Otherwise an error is
+// returned and the connection is left open.
+func (c *Conn) CloseWithPayload(code StatusCode, payload []byte) error {
+	_, err := CloseError{Code: code, Reason: string(payload)}.bytesErr()
+	if err != nil {
+		return fmt.Errorf("failed to close WebSocket: %w", err)
+	}
+	return c.Close(code, string(payload))
+}
+
+// InitiateClose writes a close frame with the given status code and reason
+// without waiting for the peer's close frame.
+//
+// The connection remains readable so that the messages the peer sent before
+// receiving the close frame can still be read. Once the peer's close frame is
+// read, the connection is closed and Reader and Read return it as a CloseError.
+// Writing data messages fails once the close frame has been written.
+//
+// Keep reading until the CloseError is returned or call Close or CloseNow
+// to stop waiting for it.
+func (c *Conn) InitiateClose(code StatusCode, reason string) (err error) {
+	defer errd.Wrap(&err, "failed to initiate close")
+
+	if c.closeSent.Load() {
+		return errCloseSent
+	}
+	return c.writeClose(code, reason)
+}
+
 // CloseNow closes the WebSocket connection without attempting a close handshake.
 // Use when you do not want the overhead of the close handshake.
 func (c *Conn) CloseNow() (err error) {
@@ -160,6 +238,10 @@ func (c *Conn) closeHandshake(code StatusCode, reason string) error {
 	if err != nil {
 		return err
 	}
+	if c.closeRcvd.Load() {
+		// Our close frame was the reply to the peer's.
+		return nil
+	}
 
 	err = c.waitCloseHandshake()
 	if CloseStatus(err) != code {
@@ -183,9 +265,15 @@ func (c *Conn) writeClose(code StatusCode, reason string) error {
 		}
 	}
 
+	if !c.closeSent.CompareAndSwap(false, true) {
+		// Only one close frame is sent, e.g. a reply after InitiateClose.
+		return nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
+	c.stats.closeStatus.CompareAndSwap(0, int64(ce.Code))
 	err = c.writeControl(ctx, opClose, p)
 	// If the connection closed as we're writing we ignore the error as we might
 	// have written the close frame, the peer responded and then someone else read it
@@ -214,7 +302,7 @@ func (c *Conn) waitCloseHandshake() error {
 	}
 
 	for {
-		h, err := c.readLoop(ctx)
+		h, err := c.readLoop(ctx, false)
 		if err != nil {
 			return err
 		}
@@ -311,13 +399,15 @@ func (ce CloseError) bytes() ([]byte, error) {
 	return p, err
 }
 
-const maxCloseReason = maxControlPayload - 2
-
 func (ce CloseError) bytesErr() ([]byte, error) {
 	if len(ce.Reason) > maxCloseReason {
 		return nil, fmt.Errorf("reason string max is %v but got %q with length %v", maxCloseReason, ce.Reason, len(ce.Reason))
 	}
 
+	if !utf8.ValidString(ce.Reason) {
+		return nil, fmt.Errorf("reason string %q is not valid UTF-8", ce.Reason)
+	}
+
 	if !validWireCloseCode(ce.Code) {
 		return nil, fmt.Errorf("status code %v cannot be set", ce.Code)
 	}
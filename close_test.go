@@ -0,0 +1,337 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestManualCloseHandshake(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, &websocket.AcceptOptions{
+		ManualCloseHandshake: true,
+	})
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- c1.Close(websocket.StatusGoingAway, "bye")
+	}()
+
+	_, _, err := c2.Read(ctx)
+	var ce websocket.CloseError
+	if !errors.As(err, &ce) {
+		t.Fatalf("expected CloseError: %v", err)
+	}
+	assert.Equal(t, "close error", websocket.CloseError{Code: websocket.StatusGoingAway, Reason: "bye"}, ce)
+
+	// The close frame was not answered automatically.
+	select {
+	case err := <-closed:
+		t.Fatalf("close handshake completed without a reply: %v", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	err = c2.Close(ce.Code, ce.Reason)
+	assert.Success(t, err)
+	assert.Success(t, <-closed)
+}
+
+func TestInitiateClose(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// The peer keeps writing after it has received the close frame.
+	c1, c2 := wstest.Pipe(nil, &websocket.AcceptOptions{
+		ManualCloseHandshake: true,
+	})
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	peerErr := make(chan error, 1)
+	go func() {
+		_, _, err := c2.Read(ctx)
+		if websocket.CloseStatus(err) != websocket.StatusGoingAway {
+			peerErr <- err
+			return
+		}
+		for _, msg := range []string{"one", "two"} {
+			err = c2.Write(ctx, websocket.MessageText, []byte(msg))
+			if err != nil {
+				peerErr <- err
+				return
+			}
+		}
+		peerErr <- c2.Close(websocket.StatusGoingAway, "")
+	}()
+
+	assert.Success(t, c1.InitiateClose(websocket.StatusGoingAway, "draining"))
+	assert.Contains(t, c1.InitiateClose(websocket.StatusGoingAway, "draining"), "close frame already sent")
+	assert.Contains(t, c1.Write(ctx, websocket.MessageText, []byte("late")), "close frame already sent")
+
+	for _, exp := range []string{"one", "two"} {
+		_, p, err := c1.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "message", exp, string(p))
+	}
+	_, _, err := c1.Read(ctx)
+	assert.Equal(t, "close status", websocket.StatusGoingAway, websocket.CloseStatus(err))
+	assert.Success(t, <-peerErr)
+}
+
+func TestCloseGraceful(t *testing.T) {
+	t.Parallel()
+
+	t.Run("drain", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(&websocket.DialOptions{
+			WriteQueueSize: 32,
+		}, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		const n = 20
+		for i := 0; i < n; i++ {
+			assert.Success(t, c1.WriteBuffered(ctx, websocket.MessageText, []byte(strconv.Itoa(i))))
+		}
+		closeErr := make(chan error, 1)
+		go func() {
+			closeErr <- c1.CloseGraceful(ctx, websocket.StatusNormalClosure, "bye")
+		}()
+
+		for i := 0; i < n; i++ {
+			_, p, err := c2.Read(ctx)
+			assert.Success(t, err)
+			assert.Equal(t, "message", strconv.Itoa(i), string(p))
+		}
+		_, _, err := c2.Read(ctx)
+		assert.Equal(t, "close status", websocket.StatusNormalClosure, websocket.CloseStatus(err))
+		assert.Success(t, <-closeErr)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		t.Parallel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		// The peer does not read and so the queued message is never written.
+		assert.Success(t, c1.WriteBuffered(context.Background(), websocket.MessageText, []byte("stuck")))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+		err := c1.CloseGraceful(ctx, websocket.StatusNormalClosure, "")
+		assert.ErrorIs(t, context.DeadlineExceeded, err)
+
+		select {
+		case <-c1.Closed():
+		case <-time.After(time.Second * 5):
+			t.Fatal("connection not closed after the context expired")
+		}
+	})
+}
+
+func TestCloseStatusHTTP(t *testing.T) {
+	t.Parallel()
+
+	t.Run("toHTTP", func(t *testing.T) {
+		t.Parallel()
+
+		testCases := []struct {
+			code websocket.StatusCode
+			exp  int
+		}{
+			{websocket.StatusNormalClosure, http.StatusOK},
+			{websocket.StatusGoingAway, http.StatusServiceUnavailable},
+			{websocket.StatusProtocolError, http.StatusBadRequest},
+			{websocket.StatusUnsupportedData, http.StatusUnsupportedMediaType},
+			{websocket.StatusNoStatusRcvd, http.StatusBadGateway},
+			{websocket.StatusAbnormalClosure, http.StatusBadGateway},
+			{websocket.StatusInvalidFramePayloadData, http.StatusBadRequest},
+			{websocket.StatusPolicyViolation, http.StatusForbidden},
+			{websocket.StatusMessageTooBig, http.StatusRequestEntityTooLarge},
+			{websocket.StatusMandatoryExtension, http.StatusNotImplemented},
+			{websocket.StatusInternalError, http.StatusInternalServerError},
+			{websocket.StatusServiceRestart, http.StatusServiceUnavailable},
+			{websocket.StatusTryAgainLater, http.StatusServiceUnavailable},
+			{websocket.StatusBadGateway, http.StatusBadGateway},
+			{websocket.StatusTLSHandshake, http.StatusBadGateway},
+			// Unmapped.
+			{1004, http.StatusInternalServerError},
+			{4000, http.StatusInternalServerError},
+			{-1, http.StatusInternalServerError},
+		}
+		for _, tc := range testCases {
+			assert.Equal(t, tc.code.String(), tc.exp, websocket.CloseStatusToHTTP(tc.code))
+		}
+	})
+
+	t.Run("toCloseStatus", func(t *testing.T) {
+		t.Parallel()
+
+		testCases := []struct {
+			code int
+			exp  websocket.StatusCode
+		}{
+			{http.StatusOK, websocket.StatusNormalClosure},
+			{http.StatusNoContent, websocket.StatusNormalClosure},
+			{http.StatusBadRequest, websocket.StatusProtocolError},
+			{http.StatusUnauthorized, websocket.StatusPolicyViolation},
+			{http.StatusForbidden, websocket.StatusPolicyViolation},
+			{http.StatusRequestEntityTooLarge, websocket.StatusMessageTooBig},
+			{http.StatusUnsupportedMediaType, websocket.StatusUnsupportedData},
+			{http.StatusTooManyRequests, websocket.StatusTryAgainLater},
+			{http.StatusNotImplemented, websocket.StatusMandatoryExtension},
+			{http.StatusBadGateway, websocket.StatusBadGateway},
+			{http.StatusServiceUnavailable, websocket.StatusTryAgainLater},
+			{http.StatusGatewayTimeout, websocket.StatusBadGateway},
+			// Unmapped.
+			{http.StatusNotFound, websocket.StatusPolicyViolation},
+			{http.StatusInternalServerError, websocket.StatusInternalError},
+			{http.StatusHTTPVersionNotSupported, websocket.StatusInternalError},
+			{http.StatusFound, websocket.StatusInternalError},
+			{0, websocket.StatusInternalError},
+		}
+		for _, tc := range testCases {
+			assert.Equal(t, strconv.Itoa(tc.code), tc.exp, websocket.HTTPToCloseStatus(tc.code))
+		}
+	})
+
+	t.Run("roundTrip", func(t *testing.T) {
+		t.Parallel()
+
+		codes := []websocket.StatusCode{
+			websocket.StatusNormalClosure,
+			websocket.StatusProtocolError,
+			websocket.StatusUnsupportedData,
+			websocket.StatusPolicyViolation,
+			websocket.StatusMessageTooBig,
+			websocket.StatusMandatoryExtension,
+			websocket.StatusInternalError,
+			websocket.StatusTryAgainLater,
+			websocket.StatusBadGateway,
+		}
+		for _, code := range codes {
+			got := websocket.HTTPToCloseStatus(websocket.CloseStatusToHTTP(code))
+			assert.Equal(t, code.String(), code, got)
+		}
+	})
+}
+
+func TestCloseReplyEchoesStatus(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2, rec := wstest.RecordingPipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- c1.Close(websocket.StatusGoingAway, "server restarting")
+	}()
+
+	_, _, err := c2.Read(ctx)
+	assert.Equal(t, "close status", websocket.StatusGoingAway, websocket.CloseStatus(err))
+	assert.Success(t, <-closed)
+
+	// The reply written automatically by the reading server.
+	frames := rec.ServerFrames()
+	assert.Equal(t, "frames", 1, len(frames))
+	reply := frames[0]
+	assert.Equal(t, "opcode", websocket.OpClose, reply.Opcode)
+	if len(reply.Payload) < 2 {
+		t.Fatalf("expected close frame reply with a status code: %q", reply.Payload)
+	}
+	assert.Equal(t, "reply status", websocket.StatusGoingAway, websocket.StatusCode(binary.BigEndian.Uint16(reply.Payload)))
+	assert.Equal(t, "reply reason", "server restarting", string(reply.Payload[2:]))
+}
+
+func TestCloseWithPayload(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2, rec := wstest.RecordingPipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	payload := []byte(`{"code":"quota_exceeded","retry":30}`)
+
+	err := c1.CloseWithPayload(websocket.StatusPolicyViolation, make([]byte, 124))
+	assert.Contains(t, err, "124")
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- c1.CloseWithPayload(websocket.StatusPolicyViolation, payload)
+	}()
+
+	_, _, err = c2.Read(ctx)
+	code, reason, ok := websocket.CloseReason(err)
+	assert.Equal(t, "close error", true, ok)
+	assert.Equal(t, "close status", websocket.StatusPolicyViolation, code)
+	assert.Equal(t, "close reason", string(payload), reason)
+	assert.Success(t, <-closed)
+
+	// The close frame carries the status code and the payload as is.
+	frames := rec.ClientFrames()
+	assert.Equal(t, "frames", 1, len(frames))
+	assert.Equal(t, "opcode", websocket.OpClose, frames[0].Opcode)
+	exp := binary.BigEndian.AppendUint16(nil, uint16(websocket.StatusPolicyViolation))
+	assert.Equal(t, "close payload", append(exp, payload...), frames[0].Payload)
+}
+
+func TestCloseReason(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- c1.Close(websocket.StatusTryAgainLater, "overloaded")
+	}()
+
+	_, _, err := c2.Read(ctx)
+	code, reason, ok := websocket.CloseReason(fmt.Errorf("wrapped: %w", err))
+	assert.Equal(t, "close error", true, ok)
+	assert.Equal(t, "close status", websocket.StatusTryAgainLater, code)
+	assert.Equal(t, "close reason", "overloaded", reason)
+	assert.Success(t, <-closed)
+
+	code, reason, ok = websocket.CloseReason(errors.New("connection reset"))
+	assert.Equal(t, "close error", false, ok)
+	assert.Equal(t, "close status", websocket.StatusCode(-1), code)
+	assert.Equal(t, "close reason", "", reason)
+}
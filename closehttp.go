@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"net/http"
+)
+
+// CloseStatusToHTTP maps the WebSocket status code to the HTTP status code
+// closest in meaning, e.g. for a gateway that proxies WebSocket connections
+// to HTTP and must respond once the connection is closed.
+//
+//	StatusNormalClosure            200 OK
+//	StatusGoingAway                503 Service Unavailable
+//	StatusProtocolError            400 Bad Request
+//	StatusUnsupportedData          415 Unsupported Media Type
+//	StatusNoStatusRcvd             502 Bad Gateway
+//	StatusAbnormalClosure          502 Bad Gateway
+//	StatusInvalidFramePayloadData  400 Bad Request
+//	StatusPolicyViolation          403 Forbidden
+//	StatusMessageTooBig            413 Request Entity Too Large
+//	StatusMandatoryExtension       501 Not Implemented
+//	StatusInternalError            500 Internal Server Error
+//	StatusServiceRestart           503 Service Unavailable
+//	StatusTryAgainLater            503 Service Unavailable
+//	StatusBadGateway               502 Bad Gateway
+//	StatusTLSHandshake             502 Bad Gateway
+//
+// Every other status code, e.g. an application code in the 4000-4999 range,
+// maps to 500 Internal Server Error.
+func CloseStatusToHTTP(code StatusCode) int {
+	switch code {
+	case StatusNormalClosure:
+		return http.StatusOK
+	case StatusProtocolError, StatusInvalidFramePayloadData:
+		return http.StatusBadRequest
+	case StatusUnsupportedData:
+		return http.StatusUnsupportedMediaType
+	case StatusPolicyViolation:
+		return http.StatusForbidden
+	case StatusMessageTooBig:
+		return http.StatusRequestEntityTooLarge
+	case StatusMandatoryExtension:
+		return http.StatusNotImplemented
+	case StatusGoingAway, StatusServiceRestart, StatusTryAgainLater:
+		return http.StatusServiceUnavailable
+	case StatusNoStatusRcvd, StatusAbnormalClosure, StatusBadGateway, StatusTLSHandshake:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// HTTPToCloseStatus maps the HTTP status code to the WebSocket status code
+// closest in meaning, e.g. for a gateway that proxies WebSocket connections
+// to HTTP and closes the connection with the status of the HTTP response.
+//
+//	2xx                            StatusNormalClosure
+//	400 Bad Request                StatusProtocolError
+//	401 Unauthorized               StatusPolicyViolation
+//	403 Forbidden                  StatusPolicyViolation
+//	413 Request Entity Too Large   StatusMessageTooBig
+//	415 Unsupported Media Type     StatusUnsupportedData
+//	429 Too Many Requests          StatusTryAgainLater
+//	501 Not Implemented            StatusMandatoryExtension
+//	502 Bad Gateway                StatusBadGateway
+//	503 Service Unavailable        StatusTryAgainLater
+//	504 Gateway Timeout            StatusBadGateway
+//	other 4xx                      StatusPolicyViolation
+//	other                          StatusInternalError
+//
+// The mapping is the inverse of CloseStatusToHTTP where the latter is
+// unambiguous, e.g. StatusPolicyViolation and StatusMessageTooBig
+// round trip.
+func HTTPToCloseStatus(code int) StatusCode {
+	switch code {
+	case http.StatusBadRequest:
+		return StatusProtocolError
+	case http.StatusRequestEntityTooLarge:
+		return StatusMessageTooBig
+	case http.StatusUnsupportedMediaType:
+		return StatusUnsupportedData
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return StatusTryAgainLater
+	case http.StatusNotImplemented:
+		return StatusMandatoryExtension
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return StatusBadGateway
+	}
+
+	switch {
+	case code >= 200 && code < 300:
+		return StatusNormalClosure
+	case code >= 400 && code < 500:
+		return StatusPolicyViolation
+	default:
+		return StatusInternalError
+	}
+}
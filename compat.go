@@ -0,0 +1,21 @@
+package websocket
+
+import (
+	"context"
+	"io"
+)
+
+// NextReader is an alias for Reader to ease migrating from gorilla/websocket.
+//
+// As with Reader, the returned reader must be read to EOF before
+// the next message can be read.
+func (c *Conn) NextReader(ctx context.Context) (MessageType, io.Reader, error) {
+	return c.Reader(ctx)
+}
+
+// NextWriter is an alias for Writer to ease migrating from gorilla/websocket.
+//
+// As with Writer, the returned writer must be closed to finish the message.
+func (c *Conn) NextWriter(ctx context.Context, typ MessageType) (io.WriteCloser, error) {
+	return c.Writer(ctx, typ)
+}
@@ -0,0 +1,61 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestNextReaderWriter(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	chunks := []string{"streamed ", "in ", "chunks"}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- func() error {
+			for i := 0; i < 2; i++ {
+				w, err := c1.NextWriter(ctx, websocket.MessageText)
+				if err != nil {
+					return err
+				}
+				for _, chunk := range chunks {
+					_, err = io.WriteString(w, chunk)
+					if err != nil {
+						return err
+					}
+				}
+				err = w.Close()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}()
+	}()
+
+	for i := 0; i < 2; i++ {
+		typ, r, err := c2.NextReader(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "type", websocket.MessageText, typ)
+		b, err := io.ReadAll(r)
+		assert.Success(t, err)
+		assert.Equal(t, "msg", strings.Join(chunks, ""), string(b))
+	}
+	assert.Success(t, <-errs)
+}
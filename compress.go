@@ -7,6 +7,7 @@ import (
 	"compress/flate"
 	"io"
 	"sync"
+	"sync/atomic"
 )
 
 // CompressionMode represents the modes available to the permessage-deflate extension.
@@ -48,18 +49,155 @@ const (
 	//
 	// If the peer does not support CompressionNoContextTakeover then we will fall back to CompressionDisabled.
 	CompressionNoContextTakeover
+
+	// CompressionMatchClient makes Accept negotiate the mode offered by the client,
+	// i.e. CompressionContextTakeover unless the client offers client_no_context_takeover
+	// or server_no_context_takeover for either side. It is for servers with varied clients
+	// that should not have a fixed mode imposed on them.
+	//
+	// The default CompressionThreshold then follows the negotiated mode. For Dial, it is
+	// the same as CompressionContextTakeover.
+	CompressionMatchClient
 )
 
 func (m CompressionMode) opts() *compressionOptions {
+	// CompressionMatchClient starts with context takeover on both sides
+	// so that only the parameters offered by the client disable it.
 	return &compressionOptions{
 		clientNoContextTakeover: m == CompressionNoContextTakeover,
 		serverNoContextTakeover: m == CompressionNoContextTakeover,
 	}
 }
 
+// CompressionOptions holds advanced options for the permessage-deflate extension.
+type CompressionOptions struct {
+	// Dictionary is a preset deflate dictionary used to seed both the compressor
+	// and the decompressor. It is most effective when messages share a common
+	// prefix or structure such as a fixed JSON schema. Only the last 32 KB are used.
+	//
+	// The dictionary is not negotiated during the handshake. Both peers must agree on
+	// it out of band, otherwise messages will fail to decompress or decompress into garbage.
+	// This also means browser clients cannot use it.
+	//
+	// Remember to lower CompressionThreshold as small messages are not compressed by default.
+	Dictionary []byte
+
+	// ShouldCompress decides whether a message is compressed. When set, it is
+	// used instead of CompressionThreshold.
+	//
+	// size is the length of the message for Write and the length of the first
+	// Write for a message written with Writer.
+	ShouldCompress func(typ MessageType, size int) bool
+
+	// MinRatio is the maximum ratio of the compressed to the original size of a
+	// message for it to be sent compressed, e.g. 0.9 sends a message compressed only
+	// if it shrinks to at most 90% of its size. Otherwise it is sent uncompressed
+	// which saves the peer from decompressing it for a negligible gain.
+	//
+	// It only applies to messages written with Write as the whole message must be
+	// compressed into a scratch buffer first. The message is compressed once, with
+	// context takeover and the Dictionary if any. As the peer never sees a message
+	// sent uncompressed, the context taken over so far is then dropped and the next
+	// messages are compressed without it. Defaults to 0 which means messages are
+	// always compressed.
+	MinRatio float64
+
+	// MaxTotalMemory caps the memory held by context takeover across the connections
+	// accepted or dialed with these CompressionOptions, i.e. the flate.Writer and the
+	// 32 KB sliding window each connection keeps between messages. A new connection
+	// that would exceed it negotiates no context takeover in both directions instead
+	// which holds no memory between messages. Accept then responds with and Dial
+	// offers client_no_context_takeover and server_no_context_takeover.
+	//
+	// Share the *CompressionOptions between Accept or Dial calls to share the budget.
+	// The memory is released once the connection is closed. See TotalMemory.
+	// Defaults to 0 which means no cap.
+	MaxTotalMemory int64
+
+	totalMemory atomic.Int64
+}
+
+// Estimates of the memory held between messages with context takeover.
+const (
+	// flateWriterMemory is the size of a flate.Writer with flate.BestSpeed.
+	flateWriterMemory = 480 << 10
+	// slidingWindowMemory is the size of the sliding window of msgReader.
+	slidingWindowMemory = 32 << 10
+)
+
+// TotalMemory returns the estimated memory held by context takeover across the
+// open connections with these CompressionOptions. It is only tracked if
+// MaxTotalMemory is set.
+func (opts *CompressionOptions) TotalMemory() int64 {
+	return opts.totalMemory.Load()
+}
+
+// reserveMemory reserves the memory held by copts on the client or server side out
+// of MaxTotalMemory. If it does not fit, copts falls back to no context takeover.
+// It returns the memory reserved which is 0 if MaxTotalMemory is not set.
+func (opts *CompressionOptions) reserveMemory(copts *compressionOptions, client bool) int64 {
+	if opts == nil || opts.MaxTotalMemory <= 0 {
+		return 0
+	}
+	n := copts.memory(client)
+	if n == 0 {
+		return 0
+	}
+	for {
+		total := opts.totalMemory.Load()
+		if total+n > opts.MaxTotalMemory {
+			copts.clientNoContextTakeover = true
+			copts.serverNoContextTakeover = true
+			return 0
+		}
+		if opts.totalMemory.CompareAndSwap(total, total+n) {
+			return n
+		}
+	}
+}
+
+// releaseMemory releases n bytes reserved with reserveMemory.
+func (opts *CompressionOptions) releaseMemory(n int64) {
+	if n > 0 {
+		opts.totalMemory.Add(-n)
+	}
+}
+
+// memory returns the estimated memory held between messages with copts
+// on the client or server side.
+func (copts *compressionOptions) memory(client bool) int64 {
+	writeTakeover := !copts.serverNoContextTakeover
+	readTakeover := !copts.clientNoContextTakeover
+	if client {
+		writeTakeover, readTakeover = readTakeover, writeTakeover
+	}
+
+	var n int64
+	if writeTakeover {
+		n += flateWriterMemory
+	}
+	if readTakeover {
+		n += slidingWindowMemory
+	}
+	return n
+}
+
 type compressionOptions struct {
 	clientNoContextTakeover bool
 	serverNoContextTakeover bool
+
+	dictionary     []byte
+	shouldCompress func(typ MessageType, size int) bool
+	minRatio       float64
+}
+
+func (copts *compressionOptions) setOptions(opts *CompressionOptions) {
+	if opts == nil {
+		return
+	}
+	copts.dictionary = opts.Dictionary
+	copts.shouldCompress = opts.ShouldCompress
+	copts.minRatio = opts.MinRatio
 }
 
 func (copts *compressionOptions) String() string {
@@ -91,6 +229,21 @@ func (tw *trimLastFourBytesWriter) reset() {
 	}
 }
 
+// flush writes the bytes held back in the tail.
+// It is used when flushing in the middle of a message as the
+// peer's flate.Reader needs them to return what has been written so far.
+func (tw *trimLastFourBytesWriter) flush() error {
+	if len(tw.tail) == 0 {
+		return nil
+	}
+	_, err := tw.w.Write(tw.tail)
+	if err != nil {
+		return err
+	}
+	tw.tail = tw.tail[:0]
+	return nil
+}
+
 func (tw *trimLastFourBytesWriter) Write(p []byte) (int, error) {
 	if tw.tail == nil {
 		tw.tail = make([]byte, 0, 4)
@@ -150,7 +303,13 @@ func putFlateReader(fr io.Reader) {
 
 var flateWriterPool sync.Pool
 
-func getFlateWriter(w io.Writer) *flate.Writer {
+func getFlateWriter(w io.Writer, dict []byte) *flate.Writer {
+	if len(dict) > 0 {
+		// flate.Writer.Reset retains the dictionary so writers
+		// with a dictionary cannot be pooled.
+		fw, _ := flate.NewWriterDict(w, flate.BestSpeed, dict)
+		return fw
+	}
 	fw, ok := flateWriterPool.Get().(*flate.Writer)
 	if !ok {
 		fw, _ = flate.NewWriter(w, flate.BestSpeed)
@@ -0,0 +1,347 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestCompressionDictionary(t *testing.T) {
+	t.Parallel()
+
+	dict := []byte(`{"type":"update","user":{"id":"","name":"","email":""},"items":[{"sku":"","quantity":0,"price":0}],"status":"pending"}`)
+	msg := []byte(`{"type":"update","user":{"id":"42","name":"gopher","email":"gopher@example.com"},"items":[{"sku":"ABC","quantity":3,"price":10}],"status":"pending"}`)
+
+	// compressedSize returns the number of payload bytes written for msg.
+	compressedSize := func(t *testing.T, copts *websocket.CompressionOptions) int64 {
+		var written atomic.Int64
+		c1, c2 := wstest.Pipe(&websocket.DialOptions{
+			CompressionMode:      websocket.CompressionNoContextTakeover,
+			CompressionThreshold: 1,
+			CompressionOptions:   copts,
+			FrameHook: func(dir websocket.Direction, op websocket.Opcode, fin, rsv1 bool, length int) {
+				if dir == websocket.DirectionWrite && op != websocket.OpClose {
+					written.Add(int64(length))
+				}
+			},
+		}, &websocket.AcceptOptions{
+			CompressionMode:      websocket.CompressionNoContextTakeover,
+			CompressionThreshold: 1,
+			CompressionOptions:   copts,
+		})
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		// Twice to ensure the dictionary is reused across messages.
+		for i := 0; i < 2; i++ {
+			go c1.Write(ctx, websocket.MessageText, msg)
+			_, p, err := c2.Read(ctx)
+			assert.Success(t, err)
+			assert.Equal(t, "message", string(msg), string(p))
+		}
+		return written.Load()
+	}
+
+	without := compressedSize(t, nil)
+	with := compressedSize(t, &websocket.CompressionOptions{Dictionary: dict})
+	if with == 0 || with >= without {
+		t.Fatalf("expected the dictionary to reduce the compressed size: %v >= %v", with, without)
+	}
+}
+
+func TestCompressionShouldCompress(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	rsv1 := make(chan bool, 2)
+	copts := &websocket.CompressionOptions{
+		ShouldCompress: func(typ websocket.MessageType, size int) bool {
+			return typ == websocket.MessageText
+		},
+	}
+	c1, c2 := wstest.Pipe(&websocket.DialOptions{
+		CompressionMode: websocket.CompressionContextTakeover,
+		// Would compress every message if the predicate was not used.
+		CompressionThreshold: 1,
+		CompressionOptions:   copts,
+		FrameHook: func(dir websocket.Direction, op websocket.Opcode, fin, rsv1Set bool, length int) {
+			if dir == websocket.DirectionWrite && (op == websocket.OpText || op == websocket.OpBinary) {
+				rsv1 <- rsv1Set
+			}
+		},
+	}, &websocket.AcceptOptions{
+		CompressionMode: websocket.CompressionContextTakeover,
+	})
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	for _, typ := range []websocket.MessageType{websocket.MessageText, websocket.MessageBinary} {
+		go c1.Write(ctx, typ, []byte("message"))
+		_, p, err := c2.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "message", "message", string(p))
+		assert.Equal(t, typ.String()+" rsv1", typ == websocket.MessageText, <-rsv1)
+	}
+}
+
+func TestCompressionRecordedFrames(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2, rec := wstest.RecordingPipe(&websocket.DialOptions{
+		CompressionMode:      websocket.CompressionContextTakeover,
+		CompressionThreshold: 1,
+	}, &websocket.AcceptOptions{
+		CompressionMode: websocket.CompressionContextTakeover,
+	})
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	errs := make(chan error, 1)
+	go func() {
+		w, err := c1.Writer(ctx, websocket.MessageText)
+		if err != nil {
+			errs <- err
+			return
+		}
+		for _, p := range []string{"hello ", "world"} {
+			_, err = w.Write([]byte(p))
+			if err != nil {
+				errs <- err
+				return
+			}
+			err = w.(interface{ Flush() error }).Flush()
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+		errs <- w.Close()
+	}()
+
+	_, p, err := c2.Read(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "message", "hello world", string(p))
+	assert.Success(t, <-errs)
+
+	// How the deflate stream is split into frames is up to compress/flate
+	// so only the structure of the recorded frame sequence is asserted.
+	frames := rec.ClientFrames()
+	if len(frames) < 2 {
+		t.Fatalf("expected a fragmented message but got %v frames", len(frames))
+	}
+	var compressed []byte
+	for i, f := range frames {
+		expOpcode := websocket.OpContinuation
+		if i == 0 {
+			expOpcode = websocket.OpText
+		}
+		assert.Equal(t, "opcode", expOpcode, f.Opcode)
+		assert.Equal(t, "fin", i == len(frames)-1, f.Fin)
+		// Only the first frame of a compressed message has rsv1 set.
+		assert.Equal(t, "rsv1", i == 0, f.RSV1)
+		assert.Equal(t, "masked", true, f.Masked)
+		assert.Equal(t, "length", len(f.Payload), f.Length)
+		compressed = append(compressed, f.Payload...)
+	}
+	assert.Equal(t, "server frames", 0, len(rec.ServerFrames()))
+
+	// See https://tools.ietf.org/html/rfc7692#section-7.2.2
+	compressed = append(compressed, 0x00, 0x00, 0xff, 0xff)
+	b, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+	if err != io.ErrUnexpectedEOF {
+		assert.Success(t, err)
+	}
+	assert.Equal(t, "decompressed", "hello world", string(b))
+}
+
+func TestCompressionMinRatio(t *testing.T) {
+	t.Parallel()
+
+	dict := bytes.Repeat([]byte("compressible "), 10)
+	testCases := []struct {
+		name string
+		mode websocket.CompressionMode
+		dict []byte
+	}{
+		{name: "contextTakeover", mode: websocket.CompressionContextTakeover},
+		{name: "noContextTakeover", mode: websocket.CompressionNoContextTakeover},
+		{name: "dictionary", mode: websocket.CompressionContextTakeover, dict: dict},
+		{name: "dictionaryNoContextTakeover", mode: websocket.CompressionNoContextTakeover, dict: dict},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			c1, c2, rec := wstest.RecordingPipe(&websocket.DialOptions{
+				CompressionMode:      tc.mode,
+				CompressionThreshold: 1,
+				CompressionOptions: &websocket.CompressionOptions{
+					MinRatio:   0.9,
+					Dictionary: tc.dict,
+				},
+			}, &websocket.AcceptOptions{
+				CompressionMode: tc.mode,
+				CompressionOptions: &websocket.CompressionOptions{
+					Dictionary: tc.dict,
+				},
+			})
+			defer c1.CloseNow()
+			defer c2.CloseNow()
+
+			incompressible := make([]byte, 1024)
+			_, err := rand.Read(incompressible)
+			assert.Success(t, err)
+			compressible := bytes.Repeat([]byte("compressible "), 100)
+
+			// A message sent uncompressed must not be referred to by the
+			// compression of the following ones.
+			msgs := [][]byte{incompressible, compressible, incompressible, compressible, compressible}
+			for i, msg := range msgs {
+				go c1.Write(ctx, websocket.MessageBinary, msg)
+				_, p, err := c2.Read(ctx)
+				assert.Success(t, err)
+				assert.Equal(t, "message", msg, p)
+
+				// rsv1 is set on the first frame of compressed messages.
+				var first []wstest.Frame
+				for _, f := range rec.ClientFrames() {
+					if f.Opcode != websocket.OpContinuation {
+						first = append(first, f)
+					}
+				}
+				assert.Equal(t, "message count", i+1, len(first))
+				assert.Equal(t, "rsv1", bytes.Equal(msg, compressible), first[i].RSV1)
+			}
+		})
+	}
+}
+
+func TestCompressionMatchClient(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		clientMode websocket.CompressionMode
+		exp        string
+	}{
+		"noContextTakeover": {websocket.CompressionNoContextTakeover, "permessage-deflate; client_no_context_takeover; server_no_context_takeover"},
+		"contextTakeover":   {websocket.CompressionContextTakeover, "permessage-deflate"},
+		"disabled":          {websocket.CompressionDisabled, ""},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			c1, c2, rec := wstest.RecordingPipe(&websocket.DialOptions{
+				CompressionMode: tc.clientMode,
+			}, &websocket.AcceptOptions{
+				CompressionMode: websocket.CompressionMatchClient,
+			})
+			defer c1.CloseNow()
+			defer c2.CloseNow()
+
+			assert.Equal(t, "server extensions", tc.exp, c2.Extensions())
+			assert.Equal(t, "client extensions", tc.exp, c1.Extensions())
+
+			msg := bytes.Repeat([]byte("compressible "), 100)
+			go c2.Write(ctx, websocket.MessageText, msg)
+			_, p, err := c1.Read(ctx)
+			assert.Success(t, err)
+			assert.Equal(t, "message", msg, p)
+
+			frames := rec.ServerFrames()
+			if len(frames) == 0 {
+				t.Fatal("expected recorded frames")
+			}
+			assert.Equal(t, "compressed", tc.exp != "", frames[0].RSV1)
+		})
+	}
+}
+
+func TestCompressionMaxTotalMemory(t *testing.T) {
+	t.Parallel()
+
+	pipe := func(t *testing.T, dialCopts, acceptCopts *websocket.CompressionOptions) (*websocket.Conn, *websocket.Conn) {
+		c1, c2 := wstest.Pipe(&websocket.DialOptions{
+			CompressionMode:    websocket.CompressionContextTakeover,
+			CompressionOptions: dialCopts,
+		}, &websocket.AcceptOptions{
+			CompressionMode:    websocket.CompressionContextTakeover,
+			CompressionOptions: acceptCopts,
+		})
+		t.Cleanup(func() {
+			c1.CloseNow()
+			c2.CloseNow()
+		})
+		return c1, c2
+	}
+
+	// Learn the memory of a single connection with context takeover.
+	measure := &websocket.CompressionOptions{MaxTotalMemory: 1 << 30}
+	_, c2 := pipe(t, nil, measure)
+	n := measure.TotalMemory()
+	if n <= 0 {
+		t.Fatalf("expected memory to be reserved: %v", n)
+	}
+	c2.CloseNow()
+	assert.Equal(t, "memory after close", int64(0), measure.TotalMemory())
+
+	const takeover = "permessage-deflate"
+	const noTakeover = "permessage-deflate; client_no_context_takeover; server_no_context_takeover"
+
+	t.Run("server", func(t *testing.T) {
+		copts := &websocket.CompressionOptions{MaxTotalMemory: 2 * n}
+
+		c1a, c2a := pipe(t, nil, copts)
+		assert.Equal(t, "first extensions", takeover, c1a.Extensions())
+		_, c2b := pipe(t, nil, copts)
+		assert.Equal(t, "second extensions", takeover, c2b.Extensions())
+		assert.Equal(t, "memory", 2*n, copts.TotalMemory())
+
+		c1c, c2c := pipe(t, nil, copts)
+		assert.Equal(t, "client extensions over budget", noTakeover, c1c.Extensions())
+		assert.Equal(t, "server extensions over budget", noTakeover, c2c.Extensions())
+		assert.Equal(t, "memory over budget", 2*n, copts.TotalMemory())
+
+		c2a.CloseNow()
+		assert.Equal(t, "memory after close", n, copts.TotalMemory())
+		_, c2d := pipe(t, nil, copts)
+		assert.Equal(t, "extensions after close", takeover, c2d.Extensions())
+	})
+
+	t.Run("client", func(t *testing.T) {
+		copts := &websocket.CompressionOptions{MaxTotalMemory: 1}
+
+		c1, c2 := pipe(t, copts, nil)
+		assert.Equal(t, "client extensions", noTakeover, c1.Extensions())
+		assert.Equal(t, "server extensions", noTakeover, c2.Extensions())
+		assert.Equal(t, "memory", int64(0), copts.TotalMemory())
+	})
+}
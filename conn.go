@@ -6,6 +6,7 @@ package websocket
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
@@ -13,6 +14,7 @@ import (
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // MessageType represents the type of a WebSocket message.
@@ -25,6 +27,10 @@ const (
 	MessageText MessageType = iota + 1
 	// MessageBinary is for binary messages like protobufs.
 	MessageBinary
+	// MessagePing is for ping frames returned with the DeliverControlFrames option.
+	MessagePing
+	// MessagePong is for pong frames returned with the DeliverControlFrames option.
+	MessagePong
 )
 
 // Conn represents a WebSocket connection.
@@ -45,10 +51,19 @@ type Conn struct {
 	noCopy noCopy
 
 	subprotocol    string
+	extensions     string
+	peerExtensions string
 	rwc            io.ReadWriteCloser
 	client         bool
 	copts          *compressionOptions
 	flateThreshold int
+	maxFrameSize   int
+	logf           func(format string, v ...interface{})
+	onClose        func()
+	disableMasking bool
+	allowUnmasked  bool
+	frameHook      FrameHook
+	readLimiter    *tokenBucket
 	br             *bufio.Reader
 	bw             *bufio.Writer
 
@@ -56,11 +71,17 @@ type Conn struct {
 	writeTimeout    chan context.Context
 	timeoutLoopDone chan struct{}
 
+	readDeadline  atomic.Int64
+	writeDeadline atomic.Int64
+
 	// Read state.
 	readMu         *mu
 	readHeaderBuf  [8]byte
 	readControlBuf [maxControlPayload]byte
-	msgReader      *msgReader
+	// Control frames to be returned by Reader with DeliverControlFrames.
+	// Guarded by readMu.
+	controlEvents []controlEvent
+	msgReader     *msgReader
 
 	// Write state.
 	msgWriter      *msgWriter
@@ -68,6 +89,20 @@ type Conn struct {
 	writeBuf       []byte
 	writeHeaderBuf [8]byte
 	writeHeader    header
+	// msgFlushed reports whether frames of the message being written
+	// may have reached the connection. Guarded by writeFrameMu.
+	msgFlushed bool
+	// Set with SetWriteCoalesce. Guarded by writeFrameMu.
+	coalesceWindow   time.Duration
+	coalesceMaxBytes int
+	coalesceTimer    *time.Timer
+	coalescePending  bool
+
+	writeQueueOnce    sync.Once
+	writeQueueSize    int
+	writeQueue        chan queuedMessage
+	writeQueuePending atomic.Int64
+	writeQueueWritten chan struct{}
 
 	closeReadMu   sync.Mutex
 	closeReadCtx  context.Context
@@ -77,17 +112,91 @@ type Conn struct {
 	closeMu sync.Mutex
 	closing bool
 
+	// manualClose is set with ManualCloseHandshake and closeRcvd
+	// once a close frame has been received in that mode.
+	manualClose bool
+	closeRcvd   atomic.Bool
+	// closeSent is set once a close frame has been written.
+	closeSent atomic.Bool
+
+	// Set with DeliverControlFrames and DisableAutoPong.
+	deliverControl bool
+	noAutoPong     bool
+	// Set with StrictConcurrency, PongOnData and RejectFragmentedMessages.
+	strictConcurrency bool
+	pongOnData        bool
+	rejectFragmented  bool
+	// exts are the custom extensions negotiated in the handshake.
+	exts []Extension
+	// defaultWriteTimeout is set with WriteTimeout.
+	defaultWriteTimeout time.Duration
+	onWriteComplete     func(typ MessageType, uncompressed, compressed int)
+
+	// baseCtx holds the values of Context. It may be nil.
+	baseCtx context.Context
+	// bufferPool holds the *bytes.Buffer scratch buffers of readAll.
+	bufferPool *sync.Pool
+
+	heartbeat      heartbeat
+	heartbeatAcked atomic.Bool
+
+	stats connStats
+
+	handshakeStart    time.Time
+	handshakeDuration time.Duration
+
+	// remoteAddr and tlsState describe the peer of the handshake.
+	remoteAddr net.Addr
+	tlsState   *tls.ConnectionState
+
+	// compressionMemory is reserved out of the MaxTotalMemory of compressionBudget.
+	compressionBudget *CompressionOptions
+	compressionMemory int64
+
 	pingCounter   atomic.Int64
 	activePingsMu sync.Mutex
 	activePings   map[string]chan<- struct{}
 }
 
 type connConfig struct {
-	subprotocol    string
-	rwc            io.ReadWriteCloser
-	client         bool
-	copts          *compressionOptions
-	flateThreshold int
+	subprotocol       string
+	extensions        string
+	peerExtensions    string
+	rwc               io.ReadWriteCloser
+	client            bool
+	copts             *compressionOptions
+	flateThreshold    int
+	maxFrameSize      int
+	logf              func(format string, v ...interface{})
+	onClose           func()
+	readRateLimit     *RateLimit
+	disableMasking    bool
+	allowUnmasked     bool
+	frameHook         FrameHook
+	writeQueueSize    int
+	manualClose       bool
+	deliverControl    bool
+	noAutoPong        bool
+	strictConcurrency bool
+	pongOnData        bool
+	rejectFragmented  bool
+	exts              []Extension
+	writeTimeout      time.Duration
+	onWriteComplete   func(typ MessageType, uncompressed, compressed int)
+	baseCtx           context.Context
+	bufferPool        *sync.Pool
+	heartbeat         heartbeat
+
+	handshakeStart    time.Time
+	handshakeDuration time.Duration
+
+	remoteAddr net.Addr
+	tlsState   *tls.ConnectionState
+
+	// compressionMemory is the memory reserved for copts during the handshake
+	// out of which the memory not used by the negotiated copts is released.
+	compressionBudget *CompressionOptions
+	compressionMemory int64
 
 	br *bufio.Reader
 	bw *bufio.Writer
@@ -95,11 +204,41 @@ type connConfig struct {
 
 func newConn(cfg connConfig) *Conn {
 	c := &Conn{
-		subprotocol:    cfg.subprotocol,
-		rwc:            cfg.rwc,
-		client:         cfg.client,
-		copts:          cfg.copts,
-		flateThreshold: cfg.flateThreshold,
+		subprotocol:       cfg.subprotocol,
+		extensions:        cfg.extensions,
+		peerExtensions:    cfg.peerExtensions,
+		rwc:               cfg.rwc,
+		client:            cfg.client,
+		copts:             cfg.copts,
+		flateThreshold:    cfg.flateThreshold,
+		maxFrameSize:      cfg.maxFrameSize,
+		logf:              cfg.logf,
+		onClose:           cfg.onClose,
+		disableMasking:    cfg.disableMasking,
+		allowUnmasked:     cfg.allowUnmasked,
+		frameHook:         cfg.frameHook,
+		writeQueueSize:    cfg.writeQueueSize,
+		manualClose:       cfg.manualClose,
+		deliverControl:    cfg.deliverControl,
+		noAutoPong:        cfg.noAutoPong,
+		strictConcurrency: cfg.strictConcurrency,
+		pongOnData:        cfg.pongOnData,
+		rejectFragmented:  cfg.rejectFragmented,
+		exts:              cfg.exts,
+		baseCtx:           cfg.baseCtx,
+		bufferPool:        cfg.bufferPool,
+		heartbeat:         cfg.heartbeat,
+
+		handshakeStart:    cfg.handshakeStart,
+		handshakeDuration: cfg.handshakeDuration,
+
+		defaultWriteTimeout: cfg.writeTimeout,
+		onWriteComplete:     cfg.onWriteComplete,
+
+		remoteAddr: cfg.remoteAddr,
+		tlsState:   cfg.tlsState,
+
+		compressionBudget: cfg.compressionBudget,
 
 		br: cfg.br,
 		bw: cfg.bw,
@@ -112,16 +251,31 @@ func newConn(cfg connConfig) *Conn {
 		activePings: make(map[string]chan<- struct{}),
 	}
 
+	if c.writeQueueSize <= 0 {
+		c.writeQueueSize = defaultWriteQueueSize
+	}
+
+	if cfg.readRateLimit != nil && cfg.readRateLimit.Rate > 0 {
+		c.readLimiter = newTokenBucket(cfg.readRateLimit)
+	}
+
 	c.readMu = newMu(c)
 	c.writeFrameMu = newMu(c)
 
 	c.msgReader = newMsgReader(c)
 
 	c.msgWriter = newMsgWriter(c)
-	if c.client {
+	if c.client && !c.disableMasking {
 		c.writeBuf = extractBufioWriterBuf(c.bw, c.rwc)
 	}
 
+	if cfg.compressionMemory > 0 {
+		if c.copts != nil {
+			c.compressionMemory = c.copts.memory(c.client)
+		}
+		c.compressionBudget.releaseMemory(cfg.compressionMemory - c.compressionMemory)
+	}
+
 	if c.flate() && c.flateThreshold == 0 {
 		c.flateThreshold = 128
 		if !c.msgWriter.flateContextTakeover() {
@@ -134,16 +288,88 @@ func newConn(cfg connConfig) *Conn {
 	})
 
 	go c.timeoutLoop()
+	if c.heartbeat.enabled() {
+		go c.heartbeatLoop()
+	}
 
 	return c
 }
 
 // Subprotocol returns the negotiated subprotocol.
 // An empty string means the default protocol.
+// It is set by the handshake and so is available as soon as Accept or Dial
+// returns, before any message is read or written, and never changes.
 func (c *Conn) Subprotocol() string {
 	return c.subprotocol
 }
 
+// Extensions returns the negotiated extensions in the format of
+// the Sec-WebSocket-Extensions header.
+// An empty string means no extensions were negotiated.
+func (c *Conn) Extensions() string {
+	return c.extensions
+}
+
+// ClientExtensionsOffered returns the Sec-WebSocket-Extensions header of the
+// handshake request as sent by the client. Unlike Extensions, it includes the
+// offers that were not negotiated which helps troubleshoot why e.g. compression
+// was not negotiated. It is always empty for connections obtained from Dial.
+func (c *Conn) ClientExtensionsOffered() string {
+	if c.client {
+		return ""
+	}
+	return c.peerExtensions
+}
+
+// ServerExtensionsOffered returns the Sec-WebSocket-Extensions header of the
+// handshake response as sent by the server. It is always empty for connections
+// obtained from Accept.
+func (c *Conn) ServerExtensionsOffered() string {
+	if !c.client {
+		return ""
+	}
+	return c.peerExtensions
+}
+
+// HandshakeStart returns the time the handshake started. That is when the
+// handshake request was sent by Dial or when Accept was called.
+func (c *Conn) HandshakeStart() time.Time {
+	return c.handshakeStart
+}
+
+// HandshakeDuration returns how long the handshake took. For Dial, it is the
+// time from sending the handshake request to receiving the response. For Accept,
+// it is the time spent processing the handshake request.
+func (c *Conn) HandshakeDuration() time.Duration {
+	return c.handshakeDuration
+}
+
+// RemoteAddr returns the address of the client for connections obtained from
+// Accept, i.e. the remote address of the hijacked connection, so that it may be
+// logged without holding onto the *http.Request. It is nil for connections
+// obtained from Dial as Dial does not expose the underlying net.Conn.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// TLS returns the state of the TLS connection the handshake was performed
+// over, i.e. http.Request.TLS for Accept and http.Response.TLS for Dial.
+// It is nil if the connection does not use TLS. It must not be modified.
+func (c *Conn) TLS() *tls.ConnectionState {
+	return c.tlsState
+}
+
+// Stats returns the connection's statistics.
+func (c *Conn) Stats() Stats {
+	return c.stats.load()
+}
+
+// Closed returns a channel that is closed once the connection is closed
+// for any reason.
+func (c *Conn) Closed() <-chan struct{} {
+	return c.closed
+}
+
 func (c *Conn) close() error {
 	c.closeMu.Lock()
 	defer c.closeMu.Unlock()
@@ -161,6 +387,12 @@ func (c *Conn) close() error {
 	// With the close of rwc, these become safe to close.
 	c.msgWriter.close()
 	c.msgReader.close()
+	if c.onClose != nil {
+		c.onClose()
+	}
+	if c.compressionMemory > 0 {
+		c.compressionBudget.releaseMemory(c.compressionMemory)
+	}
 	return err
 }
 
@@ -188,6 +420,36 @@ func (c *Conn) timeoutLoop() {
 	}
 }
 
+// ioErr returns the error to report for err from an I/O call bounded by ctx.
+// If ctx is done, ctx.Err() is returned so that callers can distinguish a
+// deadline from a cancellation with errors.Is, as the expiry of ctx is what
+// closed the connection. Otherwise net.ErrClosed is returned if the
+// connection is closed and err if not.
+func (c *Conn) ioErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if c.isClosed() {
+		return net.ErrClosed
+	}
+	return err
+}
+
+// debugf logs a diagnostic message with the Logf option if set.
+func (c *Conn) debugf(format string, v ...interface{}) {
+	if c.logf != nil {
+		c.logf("websocket: "+format, v...)
+	}
+}
+
+// contextValue implements the Value method of Context.
+func (c *Conn) contextValue(key interface{}) interface{} {
+	if c.baseCtx == nil {
+		return nil
+	}
+	return c.baseCtx.Value(key)
+}
+
 func (c *Conn) flate() bool {
 	return c.copts != nil
 }
@@ -0,0 +1,65 @@
+//go:build !js
+// +build !js
+
+package websocket
+
+import "sync"
+
+// ConnLimiter counts the concurrent connections accepted per remote IP
+// for AcceptOptions.ConnLimiter. Create one with NewConnLimiter.
+//
+// A ConnLimiter must not be copied after first use.
+// All methods may be called concurrently.
+type ConnLimiter struct {
+	// maxPerIP is fixed by NewConnLimiter so that it is never
+	// changed while connections are counted.
+	maxPerIP int
+
+	mu    sync.Mutex
+	conns map[string]int
+}
+
+// NewConnLimiter returns a ConnLimiter allowing maxPerIP concurrent
+// connections per remote IP. 0 means unlimited.
+func NewConnLimiter(maxPerIP int) *ConnLimiter {
+	return &ConnLimiter{
+		maxPerIP: maxPerIP,
+	}
+}
+
+// MaxPerIP returns the maximum number of concurrent connections
+// accepted from a single remote IP. 0 means unlimited.
+func (l *ConnLimiter) MaxPerIP() int {
+	return l.maxPerIP
+}
+
+// Count returns the number of open connections accepted from ip.
+func (l *ConnLimiter) Count(ip string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.conns[ip]
+}
+
+func (l *ConnLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxPerIP > 0 && l.conns[ip] >= l.maxPerIP {
+		return false
+	}
+	if l.conns == nil {
+		l.conns = make(map[string]int)
+	}
+	l.conns[ip]++
+	return true
+}
+
+func (l *ConnLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.conns[ip]--
+	if l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
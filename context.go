@@ -0,0 +1,47 @@
+package websocket
+
+import (
+	"context"
+	"time"
+)
+
+// Context returns a context that is cancelled once the connection is closed
+// for any reason. It has no deadline and the same context is returned on
+// every call. It holds the values of the context returned by
+// AcceptOptions.Authorize, if any.
+//
+// Use it to bound work done on behalf of the connection, e.g. per message handlers.
+func (c *Conn) Context() context.Context {
+	return connContext{c: c}
+}
+
+// connContext implements Conn.Context without a goroutine
+// by using the closed channel of the Conn as its Done channel.
+type connContext struct {
+	c *Conn
+}
+
+func (ctx connContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (ctx connContext) Done() <-chan struct{} {
+	return ctx.c.Closed()
+}
+
+func (ctx connContext) Err() error {
+	select {
+	case <-ctx.c.Closed():
+		return context.Canceled
+	default:
+		return nil
+	}
+}
+
+func (ctx connContext) Value(key interface{}) interface{} {
+	return ctx.c.contextValue(key)
+}
+
+func (ctx connContext) String() string {
+	return "websocket.Conn.Context"
+}
@@ -0,0 +1,36 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestConnContext(t *testing.T) {
+	t.Parallel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	ctx := c2.Context()
+	assert.Equal(t, "same context", ctx, c2.Context())
+	assert.Success(t, ctx.Err())
+
+	c2.CloseRead(context.Background())
+	go c1.Close(websocket.StatusNormalClosure, "")
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("context was not cancelled when the peer closed")
+	}
+	assert.ErrorIs(t, context.Canceled, ctx.Err())
+}
@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// SetReadDeadline sets a deadline for reads in addition to the context passed
+// to Reader and Read. A zero value for t clears the deadline.
+//
+// The deadline applies to Reader and Read calls made after it is set,
+// including the reading of the messages they return.
+// As with an expired context, the connection is closed when the deadline is hit
+// during a read.
+//
+// The deadline composes with the deadline of the context passed to Reader and
+// Read and whichever is earlier applies. When the deadline is hit, the returned
+// error wraps context.DeadlineExceeded. When the context is cancelled, the returned
+// error wraps context.Canceled instead. Use errors.Is to tell them apart.
+//
+// It always returns nil.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	storeDeadline(&c.readDeadline, t)
+	return nil
+}
+
+// SetWriteDeadline sets a deadline for writes in addition to the context passed
+// to Writer and Write. A zero value for t clears the deadline.
+//
+// The deadline applies to Writer and Write calls made after it is set,
+// including the writing of the messages they return.
+// As with an expired context, the connection is closed when the deadline is hit
+// during a write.
+//
+// The deadline composes with the context like the read deadline and the
+// returned error wraps context.DeadlineExceeded when it is hit.
+//
+// In Wasm, writes never block and so the write deadline has no effect.
+//
+// It always returns nil.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	storeDeadline(&c.writeDeadline, t)
+	return nil
+}
+
+// ReadMsg is like Read but without a context. It blocks until a message is read,
+// the read deadline is hit or the connection is closed.
+//
+// Reads can then only be cancelled with SetReadDeadline, Close or CloseNow.
+func (c *Conn) ReadMsg() (MessageType, []byte, error) {
+	return c.Read(context.Background())
+}
+
+// WriteMsg is like Write but without a context. It blocks until the message is
+// written, the write deadline is hit or the connection is closed.
+//
+// Writes can then only be cancelled with SetWriteDeadline, Close or CloseNow.
+func (c *Conn) WriteMsg(typ MessageType, p []byte) error {
+	return c.Write(context.Background(), typ, p)
+}
+
+// MessageReader is like Reader but every Read of the returned io.Reader is bound
+// by deadline. It is for handing messages to consumers such as parsers that take
+// an io.Reader without a context.
+//
+// Once the deadline is hit, Read returns an error wrapping context.DeadlineExceeded
+// which is a net.Error with Timeout returning true. As with an expired context, the
+// connection is then closed.
+func (c *Conn) MessageReader(ctx context.Context, deadline time.Time) (MessageType, io.Reader, error) {
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	typ, r, err := c.Reader(ctx)
+	if err != nil {
+		cancel()
+		return 0, nil, err
+	}
+	return typ, &deadlineReader{r: r, cancel: cancel}, nil
+}
+
+// deadlineReader releases the deadline context of MessageReader
+// once the message has been read.
+type deadlineReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (dr *deadlineReader) Read(p []byte) (int, error) {
+	n, err := dr.r.Read(p)
+	if err != nil {
+		dr.cancel()
+	}
+	return n, err
+}
+
+func storeDeadline(d *atomic.Int64, t time.Time) {
+	if t.IsZero() {
+		d.Store(0)
+		return
+	}
+	d.Store(t.UnixNano())
+}
+
+// withDeadline bounds ctx with the deadline stored in d if any.
+// The returned cancel func is nil if there is no deadline.
+func withDeadline(ctx context.Context, d *atomic.Int64) (context.Context, context.CancelFunc) {
+	n := d.Load()
+	if n == 0 {
+		return ctx, nil
+	}
+	return context.WithDeadline(ctx, time.Unix(0, n))
+}
@@ -0,0 +1,248 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestReadDeadline(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		deadline time.Duration
+		timeout  time.Duration
+		cancel   bool
+		exp      error
+	}{
+		{
+			name:     "deadlineFirst",
+			deadline: time.Millisecond * 50,
+			timeout:  time.Second * 5,
+			exp:      context.DeadlineExceeded,
+		},
+		{
+			name:     "contextFirst",
+			deadline: time.Second * 5,
+			timeout:  time.Millisecond * 50,
+			exp:      context.DeadlineExceeded,
+		},
+		{
+			name:     "cancelled",
+			deadline: time.Second * 5,
+			timeout:  time.Second * 5,
+			cancel:   true,
+			exp:      context.Canceled,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c1, c2 := wstest.Pipe(nil, nil)
+			defer c1.CloseNow()
+			defer c2.CloseNow()
+
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			if tc.cancel {
+				time.AfterFunc(time.Millisecond*50, cancel)
+			}
+
+			c2.SetReadDeadline(time.Now().Add(tc.deadline))
+			start := time.Now()
+			_, _, err := c2.Read(ctx)
+			assert.ErrorIs(t, tc.exp, err)
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("read returned after %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestReadWriteMsg(t *testing.T) {
+	t.Parallel()
+
+	t.Run("echo", func(t *testing.T) {
+		t.Parallel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		// Neither side has a context so the deadlines bound the test.
+		deadline := time.Now().Add(time.Second * 5)
+		for _, c := range []*websocket.Conn{c1, c2} {
+			c.SetReadDeadline(deadline)
+			c.SetWriteDeadline(deadline)
+		}
+
+		echoErrs := make(chan error, 1)
+		go func() {
+			for {
+				typ, p, err := c2.ReadMsg()
+				if err != nil {
+					echoErrs <- err
+					return
+				}
+				err = c2.WriteMsg(typ, p)
+				if err != nil {
+					echoErrs <- err
+					return
+				}
+			}
+		}()
+
+		msgs := []struct {
+			typ websocket.MessageType
+			p   string
+		}{
+			{websocket.MessageText, "hello"},
+			{websocket.MessageBinary, "\x00\x01\x02"},
+			{websocket.MessageText, ""},
+		}
+		for _, msg := range msgs {
+			msg := msg
+			errs := make(chan error, 1)
+			go func() {
+				errs <- c1.WriteMsg(msg.typ, []byte(msg.p))
+			}()
+
+			typ, p, err := c1.ReadMsg()
+			assert.Success(t, err)
+			assert.Success(t, <-errs)
+			assert.Equal(t, "type", msg.typ, typ)
+			assert.Equal(t, "message", msg.p, string(p))
+		}
+
+		go c1.Close(websocket.StatusNormalClosure, "")
+		assert.Equal(t, "close status", websocket.StatusNormalClosure, websocket.CloseStatus(<-echoErrs))
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		t.Parallel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		c2.SetReadDeadline(time.Now().Add(time.Millisecond * 50))
+		_, _, err := c2.ReadMsg()
+		assert.ErrorIs(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("closeNow", func(t *testing.T) {
+		t.Parallel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+
+		// Closing the connection is the only way to cancel a blocked ReadMsg
+		// without a deadline.
+		time.AfterFunc(time.Millisecond*50, func() {
+			c2.CloseNow()
+		})
+		_, _, err := c2.ReadMsg()
+		assert.ErrorIs(t, net.ErrClosed, err)
+	})
+}
+
+func TestMessageReader(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	go func() {
+		w, err := c1.Writer(ctx, websocket.MessageText)
+		if err != nil {
+			return
+		}
+		w.Write([]byte("partial"))
+		// The rest of the message is never written.
+		w.(interface{ Flush() error }).Flush()
+	}()
+
+	_, r, err := c2.MessageReader(ctx, time.Now().Add(time.Millisecond*100))
+	assert.Success(t, err)
+	p := make([]byte, len("partial"))
+	_, err = io.ReadFull(r, p)
+	assert.Success(t, err)
+	assert.Equal(t, "partial", "partial", string(p))
+
+	start := time.Now()
+	_, err = r.Read(p)
+	assert.ErrorIs(t, context.DeadlineExceeded, err)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected a timeout error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("read returned after %v", elapsed)
+	}
+}
+
+func TestWriteDeadline(t *testing.T) {
+	t.Parallel()
+
+	t.Run("expired", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		// c1 never reads and so the write blocks until the deadline.
+		c2.SetWriteDeadline(time.Now().Add(time.Millisecond * 50))
+		start := time.Now()
+		err := c2.Write(ctx, websocket.MessageBinary, make([]byte, 4096))
+		assert.ErrorIs(t, context.DeadlineExceeded, err)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("write returned after %v", elapsed)
+		}
+	})
+
+	t.Run("cleared", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		c2.SetWriteDeadline(time.Now().Add(time.Millisecond * 50))
+		c2.SetWriteDeadline(time.Time{})
+
+		// The write blocks past the cleared deadline until c1 reads.
+		errs := make(chan error, 1)
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			_, _, err := c1.Read(ctx)
+			errs <- err
+		}()
+		err := c2.Write(ctx, websocket.MessageBinary, make([]byte, 4096))
+		assert.Success(t, err)
+		assert.Success(t, <-errs)
+	})
+}
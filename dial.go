@@ -8,10 +8,16 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strings"
 	"sync"
@@ -27,16 +33,125 @@ type DialOptions struct {
 	// http.Transport does beginning with Go 1.12.
 	HTTPClient *http.Client
 
+	// TLSConfig is the TLS configuration used for wss:// URLs.
+	// It is applied to a clone of http.DefaultTransport. If http.DefaultTransport has
+	// been replaced with a RoundTripper that is not an *http.Transport, it is applied
+	// to a new *http.Transport that uses proxies from the environment instead.
+	//
+	// Set TLSConfig.InsecureSkipVerify to skip verification of the server's certificate.
+	// This is unrelated to AcceptOptions.InsecureSkipVerify which disables origin verification.
+	//
+	// It is an error to set both TLSConfig and HTTPClient. Configure the TLSClientConfig
+	// of the HTTPClient's Transport instead.
+	TLSConfig *tls.Config
+
+	// TLSNextProtos lists the protocols advertised with ALPN during the TLS handshake
+	// of wss:// URLs, e.g. to reach a server that multiplexes protocols on a single
+	// port. http/1.1 must be included for the server to accept the HTTP/1.1 upgrade
+	// and h2 must not be as the upgrade cannot be done over HTTP/2.
+	//
+	// net/http does not advertise the NextProtos of TLSConfig for WebSocket handshakes
+	// and so Dial performs the TLS handshake itself with TLSConfig and TLSNextProtos.
+	// ALPN is not used when connecting through a proxy from the environment.
+	//
+	// As with TLSConfig, it is an error to set both TLSNextProtos and HTTPClient.
+	TLSNextProtos []string
+
+	// ReuseTransport makes Dial share a transport between every dial with the same
+	// TLSConfig and TLSNextProtos instead of creating one per dial. The shared
+	// transport caches TLS sessions so that repeated dials to the same host resume
+	// the TLS session instead of performing a full handshake.
+	//
+	// A connection upgraded to a WebSocket is owned by the Conn and never returned to
+	// the transport. Thus only idle keep-alive connections, e.g. from a failed handshake,
+	// are reused for an upgrade and a new TCP connection is dialed otherwise.
+	//
+	// It has no effect with HTTPClient as its transport is already shared. Pass the same
+	// *tls.Config to each dial as every TLSConfig gets its own transport. Only the 32
+	// most recently used transports are kept and the idle connections of older ones
+	// are closed. To own the lifetime of the transport, set HTTPClient instead.
+	ReuseTransport bool
+
+	// CertPins pins the public key of the server's leaf certificate for wss:// URLs.
+	// Each pin is the SHA-256 hash of the DER encoded SubjectPublicKeyInfo of a
+	// certificate, i.e. sha256.Sum256(cert.RawSubjectPublicKeyInfo). If set, the dial
+	// fails with ErrCertPinMismatch unless the leaf certificate matches one of the pins.
+	//
+	// The pins are checked in addition to the usual verification of the certificate
+	// chain against TLSConfig.RootCAs or the system roots. Only if
+	// TLSConfig.InsecureSkipVerify is set are the pins the sole check. A
+	// TLSConfig.VerifyConnection callback is still called after the pins are checked.
+	//
+	// As with TLSConfig, it is an error to set both CertPins and HTTPClient.
+	CertPins [][]byte
+
 	// HTTPHeader specifies the HTTP headers included in the handshake request.
+	//
+	// Every header is sent as is except for the headers of the WebSocket handshake
+	// which Dial sets and overrides: Connection, Upgrade, Sec-WebSocket-Version and
+	// Sec-WebSocket-Key, Sec-WebSocket-Protocol if Subprotocols is set and
+	// Sec-WebSocket-Extensions if compression or Extensions are enabled. Use the
+	// Host field instead of a Host header as net/http ignores the latter.
+	//
+	// Dial sets no other default headers. In particular, a User-Agent header wins
+	// over the default of net/http and a User-Agent header with an empty value
+	// omits it for HTTP/1.1. An Origin header is sent as is, e.g. for non-browser
+	// clients of servers that verify it.
 	HTTPHeader http.Header
 
+	// ModifyRequest is called with the handshake request just before it is sent
+	// and after the WebSocket headers have been set. It can rewrite the URL, e.g.
+	// to add signed query parameters, or set headers computed at dial time.
+	//
+	// Dial fails if it returns an error or changes any of the Connection, Upgrade,
+	// Sec-WebSocket-Version and Sec-WebSocket-Key headers. With AllowHTTP2 it is
+	// also called with the extended CONNECT request.
+	ModifyRequest func(*http.Request) error
+
+	// Username and Password set HTTP basic authentication on the handshake request
+	// when Username or Password is non empty.
+	//
+	// An Authorization header in HTTPHeader takes precedence over them and they take
+	// precedence over credentials in the URL such as ws://user:pass@example.com.
+	Username string
+	Password string
+
+	// Jar specifies the cookie jar used for the handshake. It overrides the Jar
+	// of HTTPClient.
+	//
+	// Cookies in the jar are sent with the handshake request and cookies set by the
+	// handshake and redirect responses are stored in it. Jar cookies are appended to
+	// any Cookie header in HTTPHeader.
+	//
+	// On redirects, net/http keeps the Cookie header from HTTPHeader but removes the
+	// cookies that a redirect response sets, so their updated values come from the
+	// jar instead. The Cookie header is only dropped when redirecting to a host that
+	// is neither the original host nor one of its subdomains.
+	Jar http.CookieJar
+
+	// MaxRedirects is the maximum number of 301, 302, 307 and 308 redirects followed
+	// during the handshake. ws and wss schemes in the Location header are rewritten
+	// to http and https.
+	//
+	// Defaults to 10 like net/http. A negative value disables following redirects
+	// and the redirect response is returned with an error.
+	//
+	// It is ignored if HTTPClient has a CheckRedirect function.
+	MaxRedirects int
+
 	// Host optionally overrides the Host HTTP header to send. If empty, the value
 	// of URL.Host will be used.
 	Host string
 
 	// Subprotocols lists the WebSocket subprotocols to negotiate with the server.
+	// Dial fails with ErrSubprotocol if the server selects a subprotocol that is
+	// not in the list.
 	Subprotocols []string
 
+	// RequireSubprotocol makes Dial fail with ErrSubprotocol if the server
+	// does not select any of Subprotocols.
+	RequireSubprotocol bool
+
 	// CompressionMode controls the compression mode.
 	// Defaults to CompressionDisabled.
 	//
@@ -47,7 +162,170 @@ type DialOptions struct {
 	//
 	// Defaults to 512 bytes for CompressionNoContextTakeover and 128 bytes
 	// for CompressionContextTakeover.
+	// It is ignored if CompressionOptions.ShouldCompress is set.
 	CompressionThreshold int
+
+	// CompressionOptions holds advanced permessage-deflate options.
+	// It is ignored when compression is disabled.
+	//
+	// See docs on CompressionOptions for details.
+	CompressionOptions *CompressionOptions
+
+	// AllowHTTP2 enables bootstrapping the WebSocket over HTTP/2 with the extended
+	// CONNECT method from RFC 8441 when the server advertises SETTINGS_ENABLE_CONNECT_PROTOCOL.
+	//
+	// net/http's Transport rejects the :protocol pseudo header required by RFC 8441 and so
+	// HTTPClient must use a Transport that supports extended CONNECT such as
+	// golang.org/x/net/http2.Transport.
+	//
+	// Dial falls back to the HTTP/1.1 upgrade if HTTPClient uses a net/http Transport or
+	// if the server responds over HTTP/1.1 or with 405 Method Not Allowed or 501 Not
+	// Implemented. Errors of the transport, e.g. as the server did not advertise
+	// SETTINGS_ENABLE_CONNECT_PROTOCOL or TLS and DNS failures, are returned as is as a
+	// transport for HTTP/2 only cannot perform the HTTP/1.1 upgrade.
+	//
+	// See https://tools.ietf.org/html/rfc8441
+	AllowHTTP2 bool
+
+	// Logf receives internal diagnostic messages such as close handshake
+	// failures, protocol violations and discarded control frames.
+	//
+	// Defaults to nil which means no logging.
+	Logf func(format string, v ...interface{})
+
+	// DisableMasking sends unmasked frames to the server to avoid the cost of masking
+	// at very high throughput. Servers must reject unmasked frames so the server must
+	// opt in as well, e.g. with AcceptOptions.AllowUnmaskedFrames.
+	//
+	// It is not RFC compliant and must only be used for testing and on
+	// trusted links where the server is known.
+	DisableMasking bool
+
+	// FrameHook is called with every frame read or written for debugging.
+	// It is purely observational. See docs on FrameHook.
+	FrameHook FrameHook
+
+	// WriteQueueSize is the maximum number of messages queued by Conn.WriteBuffered.
+	// Defaults to 16.
+	WriteQueueSize int
+
+	// MaxFrameSize is the maximum payload length of the data frames written. Longer
+	// messages are split into continuation frames of at most MaxFrameSize bytes
+	// for peers and middleboxes that do not handle large frames well. With
+	// compression, it applies to the compressed payload.
+	// Defaults to 0 which means a message written with Write is a single frame.
+	MaxFrameSize int
+
+	// BufferPool provides the scratch buffers into which Read, ReadWithInfo and
+	// TryRead read messages. Share it between connections to avoid growing a new
+	// buffer for every message. The returned message is still a new allocation of
+	// its exact size as it is owned by the application.
+	//
+	// The pool holds *bytes.Buffer values. Buffers larger than 1 MB are not returned
+	// to it. Buffers used by Reader, the compression buffers and the buffers of the
+	// underlying connection are not affected. Defaults to nil which means no pool.
+	BufferPool *sync.Pool
+
+	// HeartbeatInterval enables application level heartbeats for protocols that do
+	// not use ping and pong frames. Every HeartbeatInterval, the message returned by
+	// HeartbeatMessage is written.
+	//
+	// A heartbeat is acknowledged once a message for which IsHeartbeatAck reports true
+	// is read with Read, ReadWithInfo or TryRead. Acknowledgements are still returned
+	// to the application and messages read with Reader are not observed.
+	//
+	// If a heartbeat is not acknowledged by the time the next one is due, OnHeartbeatMiss
+	// is called if set and the connection is closed with StatusPolicyViolation.
+	//
+	// Heartbeats are only enabled if HeartbeatMessage and IsHeartbeatAck are set.
+	HeartbeatInterval time.Duration
+	HeartbeatMessage  func() (MessageType, []byte)
+	IsHeartbeatAck    func(typ MessageType, p []byte) bool
+	OnHeartbeatMiss   func()
+
+	// ManualCloseHandshake disables the automatic reply to close frames from the
+	// peer. The close frame is returned by Reader and Read as a CloseError and the
+	// connection is left open so that the application, e.g. a proxy, can forward
+	// the close frame before replying with Close.
+	//
+	// Close then only writes the reply if a close frame has already been received.
+	// CloseRead is unaffected and closes the connection once it reads a close frame.
+	ManualCloseHandshake bool
+
+	// DeliverControlFrames makes Reader and Read return the ping and pong frames
+	// received as messages of type MessagePing and MessagePong with the frame payload,
+	// e.g. for protocols that carry a liveness token in pings. The frames are still
+	// handled as usual, i.e. pings are replied to unless DisableAutoPong is set.
+	//
+	// Frames received while a message is read are returned after it. At most 16 are
+	// held and later ones are dropped. NetConn and Router ignore them, but other code
+	// reading from the connection, e.g. wsjson.Read, must expect them.
+	DeliverControlFrames bool
+
+	// DisableAutoPong disables the automatic pong reply to pings. Reply with
+	// Conn.WriteControl and ControlPong instead if required by the protocol.
+	DisableAutoPong bool
+
+	// StrictConcurrency makes Reader and Read fail with ErrConcurrentReader when
+	// another goroutine is reading and Writer and Write fail with ErrConcurrentWriter
+	// when another message is being written instead of waiting. A second Writer
+	// opened before the first is closed then fails instead of blocking forever.
+	// Use it to find misuse. The heartbeats and WriteBuffered still wait their turn.
+	StrictConcurrency bool
+
+	// PongOnData makes the connection write an unsolicited empty pong once each
+	// data message has been read to completion. It is for peers that rely on
+	// receiving frames for liveness but never send pings. Pongs in reply to pings
+	// are unaffected.
+	PongOnData bool
+
+	// RejectFragmentedMessages makes the connection fail with a ProtocolError of
+	// reason FragmentedMessage and close with StatusProtocolError as soon as the
+	// first frame of a fragmented data message is read, e.g. for subprotocols
+	// that forbid fragmentation. Control frames are never fragmented and so are
+	// still allowed.
+	RejectFragmentedMessages bool
+
+	// Extensions lists the custom extensions offered in addition to
+	// permessage-deflate. The dial fails if the server responds with an
+	// extension that is not offered or that the Extension does not accept.
+	//
+	// See Extension.
+	Extensions []Extension
+
+	// WriteTimeout bounds every Writer, Write and Flush call whose context has
+	// no deadline, e.g. context.Background(), so that a write to a peer that
+	// stopped reading does not block forever. A deadline of the context or of
+	// SetWriteDeadline takes precedence. As with an expired context, the
+	// connection is closed when the timeout is hit during a write.
+	//
+	// Defaults to no timeout.
+	WriteTimeout time.Duration
+
+	// OnWriteComplete is called once each data message has been written with
+	// the length of its payload before and after compression, e.g. to tune
+	// CompressionThreshold. compressed equals uncompressed if the message was
+	// not compressed. compressed does not include the 4 bytes of the DEFLATE
+	// block trailer stripped from compressed messages as per RFC 7692.
+	//
+	// It is called synchronously by the goroutine that wrote the message once
+	// the next message may be written.
+	OnWriteComplete func(typ MessageType, uncompressed, compressed int)
+
+	// TCPKeepAlive sets the keep-alive period of the underlying TCP connection so that
+	// dead connections are detected by TCP independently of WebSocket pings.
+	// A negative value disables keep-alives. It has no effect on connections that are
+	// not TCP, e.g. over Unix sockets or HTTP/2.
+	// Defaults to 0 which leaves the keep-alive configuration of the transport's dialer.
+	TCPKeepAlive time.Duration
+
+	// HandshakeTimeout bounds the dial including the TCP connection, the TLS
+	// handshake and the WebSocket handshake. Once Dial returns, the connection is
+	// only bound by the contexts passed to its methods.
+	//
+	// Like HTTPClient.Timeout, it is applied to the ctx passed to Dial. If both are
+	// set, the shorter one applies. Defaults to no timeout.
+	HandshakeTimeout time.Duration
 }
 
 func (opts *DialOptions) cloneWithDefaults(ctx context.Context) (context.Context, context.CancelFunc, *DialOptions) {
@@ -59,19 +337,46 @@ func (opts *DialOptions) cloneWithDefaults(ctx context.Context) (context.Context
 	}
 	if o.HTTPClient == nil {
 		o.HTTPClient = http.DefaultClient
+		tlsConfig := o.TLSConfig
+		if len(o.CertPins) > 0 && !o.ReuseTransport {
+			tlsConfig = pinTLSConfig(tlsConfig, o.CertPins)
+		}
+		switch {
+		case o.ReuseTransport:
+			o.HTTPClient = &http.Client{Transport: sharedTransport(o.TLSConfig, o.TLSNextProtos, o.CertPins)}
+		case len(o.TLSNextProtos) > 0:
+			o.HTTPClient = &http.Client{Transport: alpnTransport(tlsConfig, o.TLSNextProtos)}
+		case tlsConfig != nil:
+			t := defaultTransport()
+			t.TLSClientConfig = tlsConfig.Clone()
+			o.HTTPClient = &http.Client{Transport: t}
+		}
 	}
+	timeout := o.HandshakeTimeout
 	if o.HTTPClient.Timeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, o.HTTPClient.Timeout)
+		if timeout <= 0 || o.HTTPClient.Timeout < timeout {
+			timeout = o.HTTPClient.Timeout
+		}
 
 		newClient := *o.HTTPClient
 		newClient.Timeout = 0
 		o.HTTPClient = &newClient
 	}
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
 	if o.HTTPHeader == nil {
 		o.HTTPHeader = http.Header{}
 	}
 	newClient := *o.HTTPClient
+	if o.Jar != nil {
+		newClient.Jar = o.Jar
+	}
 	oldCheckRedirect := o.HTTPClient.CheckRedirect
+	maxRedirects := o.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = 10
+	}
 	newClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 		switch req.URL.Scheme {
 		case "ws":
@@ -82,6 +387,12 @@ func (opts *DialOptions) cloneWithDefaults(ctx context.Context) (context.Context
 		if oldCheckRedirect != nil {
 			return oldCheckRedirect(req, via)
 		}
+		if maxRedirects < 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
 		return nil
 	}
 	o.HTTPClient = &newClient
@@ -89,13 +400,195 @@ func (opts *DialOptions) cloneWithDefaults(ctx context.Context) (context.Context
 	return ctx, cancel, &o
 }
 
+func (opts *DialOptions) setBasicAuth(req *http.Request) {
+	if opts.Username == "" && opts.Password == "" {
+		return
+	}
+	if req.Header.Get("Authorization") != "" {
+		return
+	}
+	req.SetBasicAuth(opts.Username, opts.Password)
+}
+
+// defaultTransport returns a clone of http.DefaultTransport or if it is not
+// an *http.Transport, a new transport with similar defaults.
+func defaultTransport() *http.Transport {
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		return t.Clone()
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+type sharedTransportKey struct {
+	tlsConfig  *tls.Config
+	nextProtos string
+	certPins   string
+}
+
+// maxSharedTransports bounds the transports kept for ReuseTransport so that
+// dials with a new *tls.Config every time do not grow the cache without limit.
+const maxSharedTransports = 32
+
+var sharedTransports struct {
+	sync.Mutex
+	m map[sharedTransportKey]*http.Transport
+	// lru holds the keys of m from the least to the most recently used.
+	lru []sharedTransportKey
+}
+
+// sharedTransport returns the transport used by every dial with ReuseTransport
+// and the given tlsConfig, nextProtos and certPins.
+//
+// Once maxSharedTransports transports are cached, the least recently used one
+// is evicted and its idle connections closed. Dials still using it are unaffected.
+func sharedTransport(tlsConfig *tls.Config, nextProtos []string, certPins [][]byte) *http.Transport {
+	key := sharedTransportKey{
+		tlsConfig:  tlsConfig,
+		nextProtos: strings.Join(nextProtos, ","),
+		certPins:   string(bytes.Join(certPins, []byte(","))),
+	}
+
+	sharedTransports.Lock()
+	defer sharedTransports.Unlock()
+
+	if t, ok := sharedTransports.m[key]; ok {
+		for i, k := range sharedTransports.lru {
+			if k == key {
+				sharedTransports.lru = append(sharedTransports.lru[:i], sharedTransports.lru[i+1:]...)
+				break
+			}
+		}
+		sharedTransports.lru = append(sharedTransports.lru, key)
+		return t
+	}
+
+	cfg := &tls.Config{}
+	if tlsConfig != nil {
+		cfg = tlsConfig.Clone()
+	}
+	if cfg.ClientSessionCache == nil {
+		cfg.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+	if len(certPins) > 0 {
+		cfg = pinTLSConfig(cfg, certPins)
+	}
+
+	var t *http.Transport
+	if len(nextProtos) > 0 {
+		t = alpnTransport(cfg, nextProtos)
+	} else {
+		t = defaultTransport()
+		t.TLSClientConfig = cfg
+	}
+
+	if sharedTransports.m == nil {
+		sharedTransports.m = make(map[sharedTransportKey]*http.Transport)
+	}
+	if len(sharedTransports.lru) >= maxSharedTransports {
+		oldest := sharedTransports.lru[0]
+		sharedTransports.m[oldest].CloseIdleConnections()
+		delete(sharedTransports.m, oldest)
+		sharedTransports.lru = append(sharedTransports.lru[:0], sharedTransports.lru[1:]...)
+	}
+	sharedTransports.m[key] = t
+	sharedTransports.lru = append(sharedTransports.lru, key)
+	return t
+}
+
+// ErrCertPinMismatch is returned by Dial when the server's leaf certificate
+// matches none of DialOptions.CertPins.
+var ErrCertPinMismatch = errors.New("server certificate matches no pin")
+
+// pinTLSConfig returns a clone of tlsConfig that fails the handshake with
+// ErrCertPinMismatch unless the leaf certificate matches one of certPins.
+func pinTLSConfig(tlsConfig *tls.Config, certPins [][]byte) *tls.Config {
+	cfg := &tls.Config{}
+	if tlsConfig != nil {
+		cfg = tlsConfig.Clone()
+	}
+	pins := make([][]byte, len(certPins))
+	copy(pins, certPins)
+
+	// VerifyConnection is called after the chain is verified unless
+	// InsecureSkipVerify is set and also on resumed sessions.
+	verifyConnection := cfg.VerifyConnection
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return ErrCertPinMismatch
+		}
+		sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+		matched := false
+		for _, pin := range pins {
+			if subtle.ConstantTimeCompare(pin, sum[:]) == 1 {
+				matched = true
+			}
+		}
+		if !matched {
+			return ErrCertPinMismatch
+		}
+		if verifyConnection != nil {
+			return verifyConnection(cs)
+		}
+		return nil
+	}
+	return cfg
+}
+
+// alpnTransport returns a clone of the default transport that advertises
+// nextProtos with ALPN. The transport clears NextProtos for WebSocket
+// handshakes and so it dials TLS connections itself.
+func alpnTransport(tlsConfig *tls.Config, nextProtos []string) *http.Transport {
+	cfg := &tls.Config{}
+	if tlsConfig != nil {
+		cfg = tlsConfig.Clone()
+	}
+	cfg.NextProtos = nextProtos
+
+	t := defaultTransport()
+	t.TLSClientConfig = cfg
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	t.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg := cfg.Clone()
+		if cfg.ServerName == "" {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+			cfg.ServerName = host
+		}
+		tlsConn := tls.Client(conn, cfg)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+	return t
+}
+
 // Dial performs a WebSocket handshake on url.
 //
 // The response is the WebSocket handshake response from the server.
 // You never need to close resp.Body yourself.
 //
 // If an error occurs, the returned response may be non nil.
-// However, you can only read the first 1024 bytes of the body.
+// However, you can only read the first 4096 bytes of the body.
 //
 // This function requires at least Go 1.12 as it uses a new feature
 // in net/http to perform WebSocket handshakes.
@@ -106,9 +599,21 @@ func Dial(ctx context.Context, u string, opts *DialOptions) (*Conn, *http.Respon
 	return dial(ctx, u, opts, nil)
 }
 
+// dial is Dial with rand as the source of the Sec-WebSocket-Key nonce so that
+// tests can make the handshake deterministic. nil means crypto/rand.Reader.
 func dial(ctx context.Context, urls string, opts *DialOptions, rand io.Reader) (_ *Conn, _ *http.Response, err error) {
 	defer errd.Wrap(&err, "failed to WebSocket dial")
 
+	if opts != nil && opts.HTTPClient != nil && opts.TLSConfig != nil {
+		return nil, nil, errors.New("HTTPClient and TLSConfig cannot both be set")
+	}
+	if opts != nil && opts.HTTPClient != nil && len(opts.TLSNextProtos) > 0 {
+		return nil, nil, errors.New("HTTPClient and TLSNextProtos cannot both be set")
+	}
+	if opts != nil && opts.HTTPClient != nil && len(opts.CertPins) > 0 {
+		return nil, nil, errors.New("HTTPClient and CertPins cannot both be set")
+	}
+
 	var cancel context.CancelFunc
 	ctx, cancel, opts = opts.cloneWithDefaults(ctx)
 	if cancel != nil {
@@ -121,11 +626,39 @@ func dial(ctx context.Context, urls string, opts *DialOptions, rand io.Reader) (
 	}
 
 	var copts *compressionOptions
+	var compressionMemory int64
 	if opts.CompressionMode != CompressionDisabled {
 		copts = opts.CompressionMode.opts()
+		copts.setOptions(opts.CompressionOptions)
+		compressionMemory = opts.CompressionOptions.reserveMemory(copts, true)
+		defer func() {
+			// Once the connection is created, it releases the memory when closed.
+			if err != nil && compressionMemory > 0 {
+				opts.CompressionOptions.releaseMemory(compressionMemory)
+			}
+		}()
+	}
+
+	if opts.AllowHTTP2 {
+		c, resp, err := dialHTTP2(ctx, urls, opts, copts, compressionMemory)
+		if !errors.Is(err, errHTTP2Unavailable) {
+			return c, resp, err
+		}
 	}
 
+	// The connection used for the handshake is the one that is upgraded.
+	var netConn net.Conn
+	if opts.TCPKeepAlive != 0 {
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				netConn = info.Conn
+			},
+		})
+	}
+
+	handshakeStart := time.Now()
 	resp, err := handshakeRequest(ctx, urls, opts, copts, secWebSocketKey)
+	handshakeDuration := time.Since(handshakeStart)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -133,21 +666,11 @@ func dial(ctx context.Context, urls string, opts *DialOptions, rand io.Reader) (
 	resp.Body = nil
 	defer func() {
 		if err != nil {
-			// We read a bit of the body for easier debugging.
-			r := io.LimitReader(respBody, 1024)
-
-			timer := time.AfterFunc(time.Second*3, func() {
-				respBody.Close()
-			})
-			defer timer.Stop()
-
-			b, _ := io.ReadAll(r)
-			respBody.Close()
-			resp.Body = io.NopCloser(bytes.NewReader(b))
+			readErrorBody(resp, respBody)
 		}
 	}()
 
-	copts, err = verifyServerResponse(opts, copts, secWebSocketKey, resp)
+	copts, exts, err := verifyServerResponse(opts, copts, secWebSocketKey, resp)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -157,15 +680,73 @@ func dial(ctx context.Context, urls string, opts *DialOptions, rand io.Reader) (
 		return nil, resp, fmt.Errorf("response body is not a io.ReadWriteCloser: %T", respBody)
 	}
 
-	return newConn(connConfig{
-		subprotocol:    resp.Header.Get("Sec-WebSocket-Protocol"),
-		rwc:            rwc,
-		client:         true,
-		copts:          copts,
-		flateThreshold: opts.CompressionThreshold,
-		br:             getBufioReader(rwc),
-		bw:             getBufioWriter(rwc),
-	}), resp, nil
+	err = setTCPKeepAlive(netConn, opts.TCPKeepAlive)
+	if err != nil {
+		return nil, resp, fmt.Errorf("failed to set TCP keep-alive: %w", err)
+	}
+
+	cfg := opts.connConfig(resp, rwc, copts, exts, compressionMemory)
+	cfg.handshakeStart = handshakeStart
+	cfg.handshakeDuration = handshakeDuration
+	return newConn(cfg), resp, nil
+}
+
+// connConfig returns the connConfig of the client connection over rwc of the
+// handshake response resp. The handshake timing is left to the caller.
+func (opts *DialOptions) connConfig(resp *http.Response, rwc io.ReadWriteCloser, copts *compressionOptions, exts []Extension, compressionMemory int64) connConfig {
+	return connConfig{
+		subprotocol:       resp.Header.Get("Sec-WebSocket-Protocol"),
+		extensions:        resp.Header.Get("Sec-WebSocket-Extensions"),
+		peerExtensions:    strings.Join(resp.Header.Values("Sec-WebSocket-Extensions"), ", "),
+		rwc:               rwc,
+		client:            true,
+		copts:             copts,
+		flateThreshold:    opts.CompressionThreshold,
+		maxFrameSize:      opts.MaxFrameSize,
+		logf:              opts.Logf,
+		disableMasking:    opts.DisableMasking,
+		frameHook:         opts.FrameHook,
+		writeQueueSize:    opts.WriteQueueSize,
+		manualClose:       opts.ManualCloseHandshake,
+		deliverControl:    opts.DeliverControlFrames,
+		noAutoPong:        opts.DisableAutoPong,
+		strictConcurrency: opts.StrictConcurrency,
+		pongOnData:        opts.PongOnData,
+		rejectFragmented:  opts.RejectFragmentedMessages,
+		exts:              exts,
+		writeTimeout:      opts.WriteTimeout,
+		onWriteComplete:   opts.OnWriteComplete,
+		bufferPool:        opts.BufferPool,
+		heartbeat: heartbeat{
+			interval: opts.HeartbeatInterval,
+			message:  opts.HeartbeatMessage,
+			isAck:    opts.IsHeartbeatAck,
+			onMiss:   opts.OnHeartbeatMiss,
+		},
+
+		tlsState: resp.TLS,
+
+		compressionBudget: opts.CompressionOptions,
+		compressionMemory: compressionMemory,
+
+		br: getBufioReader(rwc),
+		bw: getBufioWriter(rwc),
+	}
+}
+
+// readErrorBody reads a bit of the body of a failed handshake response
+// into resp.Body for easier debugging.
+func readErrorBody(resp *http.Response, respBody io.ReadCloser) {
+	r := io.LimitReader(respBody, 4096)
+
+	timer := time.AfterFunc(time.Second*3, func() {
+		respBody.Close()
+	})
+	defer timer.Stop()
+
+	b, _ := io.ReadAll(r)
+	respBody.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(b))
 }
 
 func handshakeRequest(ctx context.Context, urls string, opts *DialOptions, copts *compressionOptions, secWebSocketKey string) (*http.Response, error) {
@@ -192,6 +773,7 @@ func handshakeRequest(ctx context.Context, urls string, opts *DialOptions, copts
 		req.Host = opts.Host
 	}
 	req.Header = opts.HTTPHeader.Clone()
+	opts.setBasicAuth(req)
 	req.Header.Set("Connection", "Upgrade")
 	req.Header.Set("Upgrade", "websocket")
 	req.Header.Set("Sec-WebSocket-Version", "13")
@@ -199,8 +781,12 @@ func handshakeRequest(ctx context.Context, urls string, opts *DialOptions, copts
 	if len(opts.Subprotocols) > 0 {
 		req.Header.Set("Sec-WebSocket-Protocol", strings.Join(opts.Subprotocols, ","))
 	}
-	if copts != nil {
-		req.Header.Set("Sec-WebSocket-Extensions", copts.String())
+	if copts != nil || len(opts.Extensions) > 0 {
+		req.Header.Set("Sec-WebSocket-Extensions", extensionsHeader(copts, opts.Extensions))
+	}
+	err = opts.modifyRequest(req, "Connection", "Upgrade", "Sec-WebSocket-Version", "Sec-WebSocket-Key")
+	if err != nil {
+		return nil, err
 	}
 
 	resp, err := opts.HTTPClient.Do(req)
@@ -222,60 +808,112 @@ func secWebSocketKey(rr io.Reader) (string, error) {
 	return base64.StdEncoding.EncodeToString(b), nil
 }
 
-func verifyServerResponse(opts *DialOptions, copts *compressionOptions, secWebSocketKey string, resp *http.Response) (*compressionOptions, error) {
+// modifyRequest calls ModifyRequest if set and verifies that the
+// given handshake headers were left unchanged.
+func (opts *DialOptions) modifyRequest(req *http.Request, headers ...string) error {
+	if opts.ModifyRequest == nil {
+		return nil
+	}
+
+	want := make([]string, len(headers))
+	for i, k := range headers {
+		want[i] = req.Header.Get(k)
+	}
+
+	err := opts.ModifyRequest(req)
+	if err != nil {
+		return fmt.Errorf("failed to modify handshake request: %w", err)
+	}
+
+	for i, k := range headers {
+		got := req.Header.Get(k)
+		if got != want[i] {
+			return fmt.Errorf("ModifyRequest changed the %v header from %q to %q", k, want[i], got)
+		}
+	}
+	return nil
+}
+
+func verifyServerResponse(opts *DialOptions, copts *compressionOptions, secWebSocketKey string, resp *http.Response) (*compressionOptions, []Extension, error) {
 	if resp.StatusCode != http.StatusSwitchingProtocols {
-		return nil, fmt.Errorf("expected handshake response status code %v but got %v", http.StatusSwitchingProtocols, resp.StatusCode)
+		return nil, nil, fmt.Errorf("expected handshake response status code %v but got %v", http.StatusSwitchingProtocols, resp.StatusCode)
 	}
 
 	if !headerContainsTokenIgnoreCase(resp.Header, "Connection", "Upgrade") {
-		return nil, fmt.Errorf("WebSocket protocol violation: Connection header %q does not contain Upgrade", resp.Header.Get("Connection"))
+		return nil, nil, fmt.Errorf("WebSocket protocol violation: Connection header %q does not contain Upgrade", resp.Header.Get("Connection"))
 	}
 
 	if !headerContainsTokenIgnoreCase(resp.Header, "Upgrade", "WebSocket") {
-		return nil, fmt.Errorf("WebSocket protocol violation: Upgrade header %q does not contain websocket", resp.Header.Get("Upgrade"))
+		return nil, nil, fmt.Errorf("WebSocket protocol violation: Upgrade header %q does not contain websocket", resp.Header.Get("Upgrade"))
 	}
 
 	if resp.Header.Get("Sec-WebSocket-Accept") != secWebSocketAccept(secWebSocketKey) {
-		return nil, fmt.Errorf("WebSocket protocol violation: invalid Sec-WebSocket-Accept %q, key %q",
+		return nil, nil, fmt.Errorf("WebSocket protocol violation: invalid Sec-WebSocket-Accept %q, key %q",
 			resp.Header.Get("Sec-WebSocket-Accept"),
 			secWebSocketKey,
 		)
 	}
 
-	err := verifySubprotocol(opts.Subprotocols, resp)
+	err := verifySubprotocol(opts, resp)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return verifyServerExtensions(copts, resp.Header)
+	return verifyServerExtensions(copts, opts.Extensions, resp.Header)
 }
 
-func verifySubprotocol(subprotos []string, resp *http.Response) error {
+// ErrSubprotocol is returned by Dial when the server selects a subprotocol that
+// was not offered or selects none despite DialOptions.RequireSubprotocol.
+var ErrSubprotocol = errors.New("subprotocol negotiation failed")
+
+func verifySubprotocol(opts *DialOptions, resp *http.Response) error {
 	proto := resp.Header.Get("Sec-WebSocket-Protocol")
 	if proto == "" {
+		if opts.RequireSubprotocol && len(opts.Subprotocols) > 0 {
+			return fmt.Errorf("%w: server selected none of %q", ErrSubprotocol, opts.Subprotocols)
+		}
 		return nil
 	}
 
-	for _, sp2 := range subprotos {
+	for _, sp2 := range opts.Subprotocols {
 		if strings.EqualFold(sp2, proto) {
 			return nil
 		}
 	}
 
-	return fmt.Errorf("WebSocket protocol violation: unexpected Sec-WebSocket-Protocol from server: %q", proto)
+	return fmt.Errorf("%w: WebSocket protocol violation: unexpected Sec-WebSocket-Protocol from server: %q", ErrSubprotocol, proto)
 }
 
-func verifyServerExtensions(copts *compressionOptions, h http.Header) (*compressionOptions, error) {
-	exts := websocketExtensions(h)
-	if len(exts) == 0 {
-		return nil, nil
-	}
+func verifyServerExtensions(copts *compressionOptions, offered []Extension, h http.Header) (*compressionOptions, []Extension, error) {
+	var deflate *compressionOptions
+	var exts []Extension
+	for _, ext := range websocketExtensions(h) {
+		if ext.name == "permessage-deflate" && copts != nil && deflate == nil {
+			var err error
+			deflate, err = verifyServerDeflate(copts, ext)
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
 
-	ext := exts[0]
-	if ext.name != "permessage-deflate" || len(exts) > 1 || copts == nil {
-		return nil, fmt.Errorf("WebSocket protcol violation: unsupported extensions from server: %+v", exts[1:])
+		e := findExtension(offered, ext.name)
+		if e == nil || findExtension(exts, ext.name) != nil {
+			return nil, nil, fmt.Errorf("WebSocket protcol violation: unsupported extensions from server: %+v", ext)
+		}
+		ok, err := e.Accept(strings.Join(ext.params, "; "))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to accept extension %q: %w", ext.name, err)
+		}
+		if !ok {
+			return nil, nil, fmt.Errorf("extension %q selected by the server was not accepted", ext.name)
+		}
+		exts = append(exts, e)
 	}
+	return deflate, exts, nil
+}
 
+func verifyServerDeflate(copts *compressionOptions, ext websocketExtension) (*compressionOptions, error) {
 	_copts := *copts
 	copts = &_copts
 
@@ -0,0 +1,833 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+)
+
+func TestDialTLSConfig(t *testing.T) {
+	// Not parallel as it replaces http.DefaultTransport.
+
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.Close(websocket.StatusNormalClosure, "")
+	}))
+	defer s.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(s.Certificate())
+	tlsConfig := &tls.Config{RootCAs: roots}
+
+	dial := func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+			TLSConfig: tlsConfig,
+		})
+		assert.Success(t, err)
+		c.CloseNow()
+	}
+
+	t.Run("defaultTransport", dial)
+
+	t.Run("replacedDefaultTransport", func(t *testing.T) {
+		defaultTransport := http.DefaultTransport
+		defer func() {
+			http.DefaultTransport = defaultTransport
+		}()
+		http.DefaultTransport = roundTripperFunc(defaultTransport.RoundTrip)
+
+		dial(t)
+	})
+
+	t.Run("withHTTPClient", func(t *testing.T) {
+		_, _, err := websocket.Dial(context.Background(), s.URL, &websocket.DialOptions{
+			HTTPClient: s.Client(),
+			TLSConfig:  tlsConfig,
+		})
+		assert.Contains(t, err, "cannot both be set")
+	})
+}
+
+func TestDialRedirect(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(s.URL, "http")
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.Close(websocket.StatusNormalClosure, "")
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, wsURL+"/ws", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/redirect2", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/redirect", http.StatusTemporaryRedirect)
+	})
+
+	dial := func(path string, maxRedirects int) (*http.Response, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c, resp, err := websocket.Dial(ctx, wsURL+path, &websocket.DialOptions{
+			MaxRedirects: maxRedirects,
+		})
+		if err == nil {
+			c.CloseNow()
+		}
+		return resp, err
+	}
+
+	t.Run("follow", func(t *testing.T) {
+		resp, err := dial("/redirect", 0)
+		assert.Success(t, err)
+		assert.Equal(t, "status code", http.StatusSwitchingProtocols, resp.StatusCode)
+	})
+
+	t.Run("maxRedirects", func(t *testing.T) {
+		_, err := dial("/redirect2", 1)
+		assert.Contains(t, err, "stopped after 1 redirects")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		resp, err := dial("/redirect", -1)
+		assert.Error(t, err)
+		assert.Equal(t, "status code", http.StatusTemporaryRedirect, resp.StatusCode)
+	})
+}
+
+func TestDialSubprotocol(t *testing.T) {
+	t.Parallel()
+
+	// misbehavingServer responds to the handshake with proto as the
+	// selected subprotocol regardless of what was offered.
+	misbehavingServer := func(proto string) *http.Client {
+		return &http.Client{
+			Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				h := sha1.New()
+				h.Write([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+				resp := &http.Response{
+					StatusCode: http.StatusSwitchingProtocols,
+					Header:     http.Header{},
+					Body:       io.NopCloser(strings.NewReader("")),
+					Request:    r,
+				}
+				resp.Header.Set("Connection", "Upgrade")
+				resp.Header.Set("Upgrade", "websocket")
+				resp.Header.Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(h.Sum(nil)))
+				if proto != "" {
+					resp.Header.Set("Sec-WebSocket-Protocol", proto)
+				}
+				return resp, nil
+			}),
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	t.Run("unoffered", func(t *testing.T) {
+		_, _, err := websocket.Dial(ctx, "ws://example.com", &websocket.DialOptions{
+			HTTPClient:   misbehavingServer("other"),
+			Subprotocols: []string{"echo"},
+		})
+		assert.ErrorIs(t, websocket.ErrSubprotocol, err)
+	})
+
+	t.Run("required", func(t *testing.T) {
+		_, _, err := websocket.Dial(ctx, "ws://example.com", &websocket.DialOptions{
+			HTTPClient:         misbehavingServer(""),
+			Subprotocols:       []string{"echo"},
+			RequireSubprotocol: true,
+		})
+		assert.ErrorIs(t, websocket.ErrSubprotocol, err)
+	})
+
+	t.Run("selected", func(t *testing.T) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+				Subprotocols: []string{"echo"},
+			})
+			if err != nil {
+				return
+			}
+			c.CloseNow()
+		}))
+		defer s.Close()
+
+		c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+			Subprotocols:       []string{"other", "echo"},
+			RequireSubprotocol: true,
+		})
+		assert.Success(t, err)
+		assert.Equal(t, "subprotocol", "echo", c.Subprotocol())
+		c.CloseNow()
+	})
+}
+
+func TestDialModifyRequest(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sig") != "signed" {
+			http.Error(w, "missing signature", http.StatusForbidden)
+			return
+		}
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.CloseNow()
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	_, resp, err := websocket.Dial(ctx, s.URL, nil)
+	assert.Error(t, err)
+	assert.Equal(t, "status code", http.StatusForbidden, resp.StatusCode)
+
+	c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		ModifyRequest: func(r *http.Request) error {
+			q := r.URL.Query()
+			q.Set("sig", "signed")
+			r.URL.RawQuery = q.Encode()
+			return nil
+		},
+	})
+	assert.Success(t, err)
+	c.CloseNow()
+
+	_, _, err = websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		ModifyRequest: func(r *http.Request) error {
+			r.Header.Del("Upgrade")
+			return nil
+		},
+	})
+	assert.Contains(t, err, "changed the Upgrade header")
+}
+
+func TestDialRejectedBody(t *testing.T) {
+	t.Parallel()
+
+	large := strings.Repeat("x", 8192)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("large") != "" {
+			http.Error(w, large, http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "token_expired",
+		})
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	_, resp, err := websocket.Dial(ctx, s.URL, nil)
+	assert.Contains(t, err, "403")
+	assert.Equal(t, "status code", http.StatusForbidden, resp.StatusCode)
+
+	var body map[string]string
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	assert.Success(t, err)
+	assert.Equal(t, "body", map[string]string{"error": "token_expired"}, body)
+
+	// Only the first 4 KB of the body are kept.
+	_, resp, err = websocket.Dial(ctx, s.URL+"?large=1", nil)
+	assert.Error(t, err)
+	b, err := io.ReadAll(resp.Body)
+	assert.Success(t, err)
+	assert.Equal(t, "body", large[:4096], string(b))
+}
+
+func TestDialHTTPHeader(t *testing.T) {
+	t.Parallel()
+
+	headers := make(chan http.Header, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			OriginPatterns: []string{"app.example.com"},
+		})
+		if err != nil {
+			return
+		}
+		c.CloseNow()
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	dial := func(h http.Header) http.Header {
+		c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+			HTTPHeader: h,
+		})
+		assert.Success(t, err)
+		c.CloseNow()
+		return <-headers
+	}
+
+	h := dial(http.Header{
+		"User-Agent": []string{"corp-agent/2.1"},
+		"Origin":     []string{"https://app.example.com"},
+		// Overridden by the handshake.
+		"Sec-Websocket-Version": []string{"8"},
+	})
+	assert.Equal(t, "user agent", []string{"corp-agent/2.1"}, h.Values("User-Agent"))
+	assert.Equal(t, "origin", []string{"https://app.example.com"}, h.Values("Origin"))
+	assert.Equal(t, "version", []string{"13"}, h.Values("Sec-WebSocket-Version"))
+
+	h = dial(nil)
+	assert.Contains(t, h.Get("User-Agent"), "Go-http-client")
+	assert.Equal(t, "origin", "", h.Get("Origin"))
+
+	// An empty User-Agent omits the default of net/http.
+	h = dial(http.Header{
+		"User-Agent": []string{""},
+	})
+	assert.Equal(t, "user agent", []string(nil), h.Values("User-Agent"))
+}
+
+func TestDialJar(t *testing.T) {
+	t.Parallel()
+
+	cookies := make(chan []*http.Cookie, 2)
+	mux := http.NewServeMux()
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		cookies <- r.Cookies()
+		_, err := r.Cookie("session")
+		if err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1"})
+		}
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.CloseNow()
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		cookies <- r.Cookies()
+		http.SetCookie(w, &http.Cookie{Name: "login", Value: "l1"})
+		http.Redirect(w, r, "/ws", http.StatusTemporaryRedirect)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	jar, err := cookiejar.New(nil)
+	assert.Success(t, err)
+	dial := func(path string, h http.Header) {
+		c, _, err := websocket.Dial(ctx, s.URL+path, &websocket.DialOptions{
+			HTTPHeader: h,
+			Jar:        jar,
+		})
+		assert.Success(t, err)
+		c.CloseNow()
+	}
+	names := func(cookies []*http.Cookie) map[string]string {
+		m := make(map[string]string)
+		for _, c := range cookies {
+			m[c.Name] = c.Value
+		}
+		return m
+	}
+
+	// The cookie set by the 101 response is stored and sent on the next dial.
+	dial("/ws", nil)
+	assert.Equal(t, "first dial cookies", map[string]string{}, names(<-cookies))
+	dial("/ws", nil)
+	assert.Equal(t, "second dial cookies", map[string]string{"session": "s1"}, names(<-cookies))
+
+	// The cookie set by the redirect is sent with the handshake it redirects to
+	// and jar cookies are appended to the Cookie header of HTTPHeader.
+	dial("/login", http.Header{
+		"Cookie": []string{"theme=dark"},
+	})
+	assert.Equal(t, "login cookies", map[string]string{"theme": "dark", "session": "s1"}, names(<-cookies))
+	assert.Equal(t, "redirected cookies", map[string]string{"theme": "dark", "session": "s1", "login": "l1"}, names(<-cookies))
+}
+
+func TestDialBasicAuth(t *testing.T) {
+	t.Parallel()
+
+	auths := make(chan string, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths <- r.Header.Get("Authorization")
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.CloseNow()
+	}))
+	defer s.Close()
+
+	basic := func(username, password string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	}
+	withUserinfo := strings.Replace(s.URL, "http://", "http://url-user:url-pass@", 1)
+
+	testCases := []struct {
+		name string
+		url  string
+		opts *websocket.DialOptions
+		exp  string
+	}{
+		{
+			name: "credentials",
+			url:  s.URL,
+			opts: &websocket.DialOptions{Username: "alice", Password: "s3cret"},
+			exp:  basic("alice", "s3cret"),
+		},
+		{
+			name: "usernameOnly",
+			url:  s.URL,
+			opts: &websocket.DialOptions{Username: "alice"},
+			exp:  basic("alice", ""),
+		},
+		{
+			name: "httpHeaderWins",
+			url:  withUserinfo,
+			opts: &websocket.DialOptions{
+				HTTPHeader: http.Header{"Authorization": []string{"Bearer token"}},
+				Username:   "alice",
+				Password:   "s3cret",
+			},
+			exp: "Bearer token",
+		},
+		{
+			name: "credentialsWinOverURL",
+			url:  withUserinfo,
+			opts: &websocket.DialOptions{Username: "alice", Password: "s3cret"},
+			exp:  basic("alice", "s3cret"),
+		},
+		{
+			name: "url",
+			url:  withUserinfo,
+			opts: nil,
+			exp:  basic("url-user", "url-pass"),
+		},
+		{
+			name: "none",
+			url:  s.URL,
+			opts: nil,
+			exp:  "",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			c, _, err := websocket.Dial(ctx, tc.url, tc.opts)
+			assert.Success(t, err)
+			c.CloseNow()
+			assert.Equal(t, "authorization", tc.exp, <-auths)
+		})
+	}
+}
+
+func TestDialHandshakeTimeout(t *testing.T) {
+	t.Parallel()
+
+	t.Run("stalled", func(t *testing.T) {
+		t.Parallel()
+
+		// Accepts TCP connections but never responds to the handshake.
+		l, err := net.Listen("tcp", "localhost:0")
+		assert.Success(t, err)
+		defer l.Close()
+		go func() {
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				defer c.Close()
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		start := time.Now()
+		_, _, err = websocket.Dial(ctx, "ws://"+l.Addr().String(), &websocket.DialOptions{
+			HandshakeTimeout: time.Millisecond * 100,
+		})
+		assert.ErrorIs(t, context.DeadlineExceeded, err)
+		if d := time.Since(start); d > time.Second {
+			t.Fatalf("dial took %v, expected it to fail at the handshake timeout", d)
+		}
+	})
+
+	t.Run("connected", func(t *testing.T) {
+		t.Parallel()
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := websocket.Accept(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer c.CloseNow()
+			typ, p, err := c.Read(r.Context())
+			if err != nil {
+				return
+			}
+			c.Write(r.Context(), typ, p)
+		}))
+		defer s.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+			HandshakeTimeout: time.Millisecond * 100,
+		})
+		assert.Success(t, err)
+		defer c.CloseNow()
+
+		// The connection outlives the handshake timeout.
+		time.Sleep(time.Millisecond * 200)
+		assert.Success(t, c.Write(ctx, websocket.MessageText, []byte("hello")))
+		_, p, err := c.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "message", "hello", string(p))
+	})
+}
+
+func TestDialReuseTransport(t *testing.T) {
+	t.Parallel()
+
+	var conns atomic.Int64
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+		handshake := "full"
+		if r.TLS.DidResume {
+			handshake = "resumed"
+		}
+		c.Write(r.Context(), websocket.MessageText, []byte(handshake))
+		c.Close(websocket.StatusNormalClosure, "")
+	}))
+	s.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	s.StartTLS()
+	defer s.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(s.Certificate())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	dial := func(t *testing.T, opts *websocket.DialOptions) string {
+		c, _, err := websocket.Dial(ctx, s.URL, opts)
+		assert.Success(t, err)
+		defer c.CloseNow()
+		_, p, err := c.Read(ctx)
+		assert.Success(t, err)
+		return string(p)
+	}
+
+	t.Run("reuse", func(t *testing.T) {
+		opts := &websocket.DialOptions{
+			TLSConfig:      &tls.Config{RootCAs: roots},
+			ReuseTransport: true,
+		}
+		assert.Equal(t, "first handshake", "full", dial(t, opts))
+		assert.Equal(t, "second handshake", "resumed", dial(t, opts))
+	})
+
+	t.Run("noReuse", func(t *testing.T) {
+		opts := &websocket.DialOptions{
+			TLSConfig: &tls.Config{RootCAs: roots},
+		}
+		assert.Equal(t, "first handshake", "full", dial(t, opts))
+		assert.Equal(t, "second handshake", "full", dial(t, opts))
+	})
+
+	// Upgraded connections cannot be reused.
+	assert.Equal(t, "connections", int64(4), conns.Load())
+}
+
+func TestDialTLSNextProtos(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS.NegotiatedProtocol != "chat" {
+			http.Error(w, "unexpected ALPN protocol "+r.TLS.NegotiatedProtocol, http.StatusForbidden)
+			return
+		}
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.Close(websocket.StatusNormalClosure, "")
+	}))
+	s.TLS = &tls.Config{NextProtos: []string{"chat", "http/1.1"}}
+	s.Config.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){
+		// Serves HTTP/1.1 on connections that negotiated chat as multiplexing servers do.
+		"chat": func(hs *http.Server, c *tls.Conn, h http.Handler) {
+			(&http.Server{Handler: hs.Handler}).Serve(newConnListener(c))
+		},
+	}
+	s.StartTLS()
+	defer s.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(s.Certificate())
+	tlsConfig := &tls.Config{RootCAs: roots}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	for _, nextProtos := range [][]string{nil, {"http/1.1"}} {
+		_, resp, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+			TLSConfig:     tlsConfig,
+			TLSNextProtos: nextProtos,
+		})
+		assert.Error(t, err)
+		assert.Equal(t, "status code", http.StatusForbidden, resp.StatusCode)
+	}
+
+	c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		TLSConfig:     tlsConfig,
+		TLSNextProtos: []string{"chat", "http/1.1"},
+	})
+	assert.Success(t, err)
+	c.CloseNow()
+
+	_, _, err = websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		HTTPClient:    s.Client(),
+		TLSNextProtos: []string{"chat", "http/1.1"},
+	})
+	assert.Contains(t, err, "cannot both be set")
+}
+
+// connListener is a net.Listener that accepts a single connection
+// and then blocks until it is closed.
+//
+// The connection hides the *tls.Conn type from net/http so that it serves
+// HTTP/1.1 on it regardless of the negotiated protocol.
+type connListener struct {
+	conn   net.Conn
+	addr   net.Addr
+	closed chan struct{}
+}
+
+func newConnListener(c *tls.Conn) *connListener {
+	l := &connListener{
+		addr:   c.LocalAddr(),
+		closed: make(chan struct{}),
+	}
+	l.conn = &listenerConn{Conn: c, l: l}
+	return l
+}
+
+type listenerConn struct {
+	*tls.Conn
+	l    *connListener
+	once sync.Once
+}
+
+func (c *listenerConn) Close() error {
+	c.once.Do(func() {
+		close(c.l.closed)
+	})
+	return c.Conn.Close()
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	if l.conn == nil {
+		<-l.closed
+		return nil, net.ErrClosed
+	}
+	c := l.conn
+	l.conn = nil
+	return c, nil
+}
+
+func (l *connListener) Close() error {
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+func TestDialCertPins(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.Close(websocket.StatusNormalClosure, "")
+	})
+	s := httptest.NewTLSServer(handler)
+	defer s.Close()
+
+	// other serves a certificate with a different key.
+	other := httptest.NewUnstartedServer(handler)
+	otherCert := selfSignedCert(t)
+	other.TLS = &tls.Config{Certificates: []tls.Certificate{otherCert}}
+	other.StartTLS()
+	defer other.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(s.Certificate())
+	roots.AddCert(otherCert.Leaf)
+
+	pin := sha256.Sum256(s.Certificate().RawSubjectPublicKeyInfo)
+	pins := [][]byte{bytes.Repeat([]byte{1}, sha256.Size), pin[:]}
+
+	dial := func(u string, opts *websocket.DialOptions) error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c, _, err := websocket.Dial(ctx, u, opts)
+		if err != nil {
+			return err
+		}
+		c.CloseNow()
+		return nil
+	}
+
+	t.Run("pinned", func(t *testing.T) {
+		err := dial(s.URL, &websocket.DialOptions{
+			TLSConfig: &tls.Config{RootCAs: roots},
+			CertPins:  pins,
+		})
+		assert.Success(t, err)
+	})
+
+	t.Run("mismatched", func(t *testing.T) {
+		err := dial(other.URL, &websocket.DialOptions{
+			TLSConfig: &tls.Config{RootCAs: roots},
+			CertPins:  pins,
+		})
+		assert.ErrorIs(t, websocket.ErrCertPinMismatch, err)
+	})
+
+	t.Run("mismatchedReuseTransport", func(t *testing.T) {
+		err := dial(other.URL, &websocket.DialOptions{
+			TLSConfig:      &tls.Config{RootCAs: roots},
+			CertPins:       pins,
+			ReuseTransport: true,
+		})
+		assert.ErrorIs(t, websocket.ErrCertPinMismatch, err)
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		// The pins do not replace the verification of the chain.
+		err := dial(s.URL, &websocket.DialOptions{
+			CertPins: pins,
+		})
+		var unknownAuthority x509.UnknownAuthorityError
+		if !errors.As(err, &unknownAuthority) {
+			t.Fatalf("expected an unknown authority error: %v", err)
+		}
+	})
+
+	t.Run("insecureSkipVerify", func(t *testing.T) {
+		err := dial(s.URL, &websocket.DialOptions{
+			TLSConfig: &tls.Config{InsecureSkipVerify: true},
+			CertPins:  pins,
+		})
+		assert.Success(t, err)
+
+		err = dial(other.URL, &websocket.DialOptions{
+			TLSConfig: &tls.Config{InsecureSkipVerify: true},
+			CertPins:  pins,
+		})
+		assert.ErrorIs(t, websocket.ErrCertPinMismatch, err)
+	})
+
+	t.Run("withHTTPClient", func(t *testing.T) {
+		err := dial(s.URL, &websocket.DialOptions{
+			HTTPClient: s.Client(),
+			CertPins:   pins,
+		})
+		assert.Contains(t, err, "cannot both be set")
+	})
+}
+
+// selfSignedCert returns a new self-signed certificate for 127.0.0.1.
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Success(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"websocket test"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Success(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	assert.Success(t, err)
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+}
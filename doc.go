@@ -13,7 +13,8 @@
 //
 // The examples are the best way to understand how to correctly use the library.
 //
-// The wsjson subpackage contain helpers for JSON and protobuf messages.
+// The wsjson subpackage contains helpers for JSON messages. The wspb module
+// contains helpers for protobuf messages so that this module has no dependencies.
 //
 // More documentation at https://github.com/oarkflow/websocket.
 //
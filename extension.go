@@ -0,0 +1,129 @@
+//go:build !js
+// +build !js
+
+package websocket
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Extension is a custom WebSocket extension negotiated in the handshake in
+// addition to permessage-deflate. Register it with AcceptOptions.Extensions
+// and DialOptions.Extensions.
+//
+// Once negotiated, Transform is applied to the payload of every data frame
+// written and Untransform to the payload of every data frame read. With
+// permessage-deflate, Transform applies to the compressed payload and
+// Untransform before decompressing. Control frames are never transformed.
+//
+// The payload of each frame read is buffered in full to be untransformed and so
+// frames larger than the read limit are rejected. RSV2 and RSV3 remain reserved
+// and a frame with either set is still a protocol error.
+//
+// The methods are called from the goroutines reading and writing the connection
+// and so an Extension must be safe for concurrent use by one reader and one writer.
+type Extension interface {
+	// Name returns the extension token of the Sec-WebSocket-Extensions header,
+	// e.g. "x-xor".
+	Name() string
+
+	// Offer returns the extension parameters, e.g. "key=42", or "" for none.
+	// The client offers them and the server responds with them once it has
+	// accepted the client's offer.
+	Offer() string
+
+	// Accept is called by the server with the parameters offered by the client
+	// and by the client with the parameters of the server's response. Multiple
+	// parameters are separated by "; ". It reports whether the extension is used.
+	// An error fails the handshake. A client that does not accept the response
+	// also fails the handshake as the server already uses the extension.
+	Accept(params string) (bool, error)
+
+	// Transform returns the payload written for a data frame with payload p.
+	// It must not modify p.
+	Transform(p []byte) ([]byte, error)
+
+	// Untransform returns the payload of a data frame read with payload p.
+	// It may modify p.
+	Untransform(p []byte) ([]byte, error)
+}
+
+// extensionOffer returns the Sec-WebSocket-Extensions element of ext.
+func extensionOffer(ext Extension) string {
+	if params := ext.Offer(); params != "" {
+		return ext.Name() + "; " + params
+	}
+	return ext.Name()
+}
+
+// extensionsHeader returns the Sec-WebSocket-Extensions header offering
+// permessage-deflate with copts if non nil and then exts.
+func extensionsHeader(copts *compressionOptions, exts []Extension) string {
+	var elems []string
+	if copts != nil {
+		elems = append(elems, copts.String())
+	}
+	for _, ext := range exts {
+		elems = append(elems, extensionOffer(ext))
+	}
+	return strings.Join(elems, ", ")
+}
+
+// acceptExtensions returns the extensions of exts accepted for the offers of
+// the client in their order and their elements of the Sec-WebSocket-Extensions
+// response header.
+func acceptExtensions(offers []websocketExtension, exts []Extension) (accepted []Extension, elems []string, err error) {
+	for _, offer := range offers {
+		ext := findExtension(exts, offer.name)
+		if ext == nil || findExtension(accepted, offer.name) != nil {
+			continue
+		}
+		ok, err := ext.Accept(strings.Join(offer.params, "; "))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to accept extension %q: %w", offer.name, err)
+		}
+		if ok {
+			accepted = append(accepted, ext)
+			elems = append(elems, extensionOffer(ext))
+		}
+	}
+	return accepted, elems, nil
+}
+
+// findExtension returns the extension of exts with the given name if any.
+func findExtension(exts []Extension, name string) Extension {
+	for _, ext := range exts {
+		if strings.EqualFold(ext.Name(), name) {
+			return ext
+		}
+	}
+	return nil
+}
+
+// transform applies the Transform of the negotiated extensions
+// in the order they were negotiated to the data frame payload p.
+func (c *Conn) transform(p []byte) ([]byte, error) {
+	for _, ext := range c.exts {
+		var err error
+		p, err = ext.Transform(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform payload with extension %q: %w", ext.Name(), err)
+		}
+	}
+	return p, nil
+}
+
+// untransform applies the Untransform of the negotiated extensions
+// in the reverse order of transform to the data frame payload p.
+func (c *Conn) untransform(p []byte) ([]byte, error) {
+	for i := len(c.exts) - 1; i >= 0; i-- {
+		ext := c.exts[i]
+		var err error
+		p, err = ext.Untransform(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to untransform payload with extension %q: %w", ext.Name(), err)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,208 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+// xorExtension XORs every payload byte with key.
+type xorExtension struct {
+	key byte
+}
+
+func (e xorExtension) Name() string {
+	return "x-xor"
+}
+
+func (e xorExtension) Offer() string {
+	return fmt.Sprintf("key=%d", e.key)
+}
+
+func (e xorExtension) Accept(params string) (bool, error) {
+	if params == "bad" {
+		return false, errors.New("bad params")
+	}
+	return params == e.Offer(), nil
+}
+
+func (e xorExtension) Transform(p []byte) ([]byte, error) {
+	b := make([]byte, len(p))
+	for i := range p {
+		b[i] = p[i] ^ e.key
+	}
+	return b, nil
+}
+
+func (e xorExtension) Untransform(p []byte) ([]byte, error) {
+	for i := range p {
+		p[i] ^= e.key
+	}
+	return p, nil
+}
+
+func TestExtension(t *testing.T) {
+	t.Parallel()
+
+	msg := []byte(strings.Repeat("hello extension ", 32))
+
+	modes := map[string]websocket.CompressionMode{
+		"disabled":        websocket.CompressionDisabled,
+		"contextTakeover": websocket.CompressionContextTakeover,
+	}
+	for name, mode := range modes {
+		mode := mode
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			c1, c2, rec := wstest.RecordingPipe(&websocket.DialOptions{
+				CompressionMode: mode,
+				Extensions:      []websocket.Extension{xorExtension{key: 42}},
+			}, &websocket.AcceptOptions{
+				CompressionMode: mode,
+				Extensions:      []websocket.Extension{xorExtension{key: 42}},
+			})
+			defer c1.CloseNow()
+			defer c2.CloseNow()
+
+			exp := "x-xor; key=42"
+			if mode != websocket.CompressionDisabled {
+				exp = "permessage-deflate, x-xor; key=42"
+			}
+			assert.Equal(t, "client extensions", exp, c1.Extensions())
+			assert.Equal(t, "server extensions", exp, c2.Extensions())
+
+			// A message written with several frames.
+			go func() {
+				w, err := c1.Writer(ctx, websocket.MessageText)
+				if err != nil {
+					return
+				}
+				w.Write(msg[:100])
+				w.(interface{ Flush() error }).Flush()
+				w.Write(msg[100:])
+				w.Close()
+			}()
+			_, p, err := c2.Read(ctx)
+			assert.Success(t, err)
+			assert.Equal(t, "client message", string(msg), string(p))
+
+			go c2.Write(ctx, websocket.MessageBinary, msg)
+			_, p, err = c1.Read(ctx)
+			assert.Success(t, err)
+			assert.Equal(t, "server message", string(msg), string(p))
+
+			for _, f := range rec.ClientFrames() {
+				if f.Length >= 8 && bytes.Contains(msg, f.Payload) {
+					t.Fatalf("untransformed payload on the wire: %q", f.Payload)
+				}
+			}
+			if mode == websocket.CompressionDisabled {
+				f := rec.ServerFrames()[0]
+				b, _ := xorExtension{key: 42}.Untransform(f.Payload)
+				assert.Equal(t, "wire payload", string(msg), string(b))
+			}
+		})
+	}
+
+	t.Run("notNegotiated", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(&websocket.DialOptions{
+			Extensions: []websocket.Extension{xorExtension{key: 42}},
+		}, &websocket.AcceptOptions{
+			Extensions: []websocket.Extension{xorExtension{key: 7}},
+		})
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		assert.Equal(t, "extensions", "", c1.Extensions())
+
+		go c1.Write(ctx, websocket.MessageText, msg)
+		_, p, err := c2.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "message", string(msg), string(p))
+	})
+
+	t.Run("acceptError", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+				Extensions: []websocket.Extension{xorExtension{key: 42}},
+			})
+			if err == nil {
+				c.CloseNow()
+			}
+		}))
+		defer s.Close()
+
+		_, resp, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+			Extensions: []websocket.Extension{badOfferExtension{}},
+		})
+		assert.Contains(t, err, "got 400")
+		assert.Equal(t, "status", http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("refusedResponse", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+				Extensions: []websocket.Extension{xorExtension{key: 42}},
+			})
+			if err == nil {
+				c.CloseNow()
+			}
+		}))
+		defer s.Close()
+
+		_, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+			Extensions: []websocket.Extension{refusingExtension{xorExtension{key: 42}}},
+		})
+		assert.Contains(t, err, `extension "x-xor" selected by the server was not accepted`)
+	})
+}
+
+// badOfferExtension offers parameters that xorExtension fails to accept.
+type badOfferExtension struct {
+	xorExtension
+}
+
+func (badOfferExtension) Offer() string {
+	return "bad"
+}
+
+// refusingExtension never accepts the response of the server.
+type refusingExtension struct {
+	xorExtension
+}
+
+func (refusingExtension) Accept(string) (bool, error) {
+	return false, nil
+}
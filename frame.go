@@ -47,9 +47,15 @@ type header struct {
 	maskKey uint32
 }
 
+// byteReader is implemented by *bufio.Reader and *bytes.Reader.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
 // readFrameHeader reads a header from the reader.
 // See https://tools.ietf.org/html/rfc6455#section-5.2.
-func readFrameHeader(r *bufio.Reader, readBuf []byte) (h header, err error) {
+func readFrameHeader(r byteReader, readBuf []byte) (h header, err error) {
 	defer errd.Wrap(&err, "failed to read frame header")
 
 	b, err := r.ReadByte()
@@ -101,9 +107,8 @@ func readFrameHeader(r *bufio.Reader, readBuf []byte) (h header, err error) {
 	return h, nil
 }
 
-// maxControlPayload is the maximum length of a control frame payload.
-// See https://tools.ietf.org/html/rfc6455#section-5.5.
-const maxControlPayload = 125
+// maxFrameHeaderSize is the length of the largest possible frame header.
+const maxFrameHeaderSize = 14
 
 // writeFrameHeader writes the bytes of the header to w.
 // See https://tools.ietf.org/html/rfc6455#section-5.2
@@ -0,0 +1,75 @@
+//go:build !js
+// +build !js
+
+package websocket
+
+import "strconv"
+
+// FrameHook observes every frame read or written on a connection.
+// It is called synchronously from the read and write paths so it
+// must not block.
+//
+// length is the payload length of the frame. rsv1 is set on the first
+// frame of compressed messages.
+type FrameHook func(dir Direction, op Opcode, fin bool, rsv1 bool, length int)
+
+// Direction is the direction of a frame passed to a FrameHook.
+type Direction int
+
+// Direction constants.
+const (
+	// DirectionRead is for frames read from the peer.
+	DirectionRead Direction = iota + 1
+	// DirectionWrite is for frames written to the peer.
+	DirectionWrite
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionRead:
+		return "read"
+	case DirectionWrite:
+		return "write"
+	default:
+		return "Direction(" + strconv.Itoa(int(d)) + ")"
+	}
+}
+
+// Opcode represents the opcode of a frame passed to a FrameHook.
+// See https://tools.ietf.org/html/rfc6455#section-11.8
+type Opcode int
+
+// Opcode constants.
+const (
+	OpContinuation = Opcode(opContinuation)
+	OpText         = Opcode(opText)
+	OpBinary       = Opcode(opBinary)
+	OpClose        = Opcode(opClose)
+	OpPing         = Opcode(opPing)
+	OpPong         = Opcode(opPong)
+)
+
+func (op Opcode) String() string {
+	switch op {
+	case OpContinuation:
+		return "continuation"
+	case OpText:
+		return "text"
+	case OpBinary:
+		return "binary"
+	case OpClose:
+		return "close"
+	case OpPing:
+		return "ping"
+	case OpPong:
+		return "pong"
+	default:
+		return "Opcode(" + strconv.Itoa(int(op)) + ")"
+	}
+}
+
+func (c *Conn) observeFrame(dir Direction, h header) {
+	if c.frameHook != nil {
+		c.frameHook(dir, Opcode(h.opcode), h.fin, h.rsv1, int(h.payloadLength))
+	}
+}
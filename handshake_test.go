@@ -0,0 +1,114 @@
+//go:build !js
+// +build !js
+
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket/internal/test/assert"
+)
+
+func TestHandshakeFixedNonce(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	keys := make(chan string, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys <- r.Header.Get("Sec-WebSocket-Key")
+		c, err := Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.CloseNow()
+	}))
+	defer s.Close()
+
+	// The example handshake of RFC 6455 section 1.3.
+	c, resp, err := dial(ctx, s.URL, nil, strings.NewReader("the sample nonce"))
+	assert.Success(t, err)
+	defer c.CloseNow()
+
+	assert.Equal(t, "Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==", <-keys)
+	assert.Equal(t, "Sec-WebSocket-Accept", "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+}
+
+func TestHandshakeDuration(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	const delay = time.Millisecond * 100
+	conns := make(chan *Conn, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Delays the response without counting towards the duration of Accept.
+		time.Sleep(delay)
+		c, err := Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		conns <- c
+	}))
+	defer s.Close()
+
+	before := time.Now()
+	c1, _, err := Dial(ctx, s.URL, nil)
+	assert.Success(t, err)
+	defer c1.CloseNow()
+	after := time.Now()
+
+	c2 := <-conns
+	defer c2.CloseNow()
+
+	if c1.HandshakeStart().Before(before) || c1.HandshakeStart().After(after) {
+		t.Fatalf("dial handshake start %v is not within [%v, %v]", c1.HandshakeStart(), before, after)
+	}
+	if d := c1.HandshakeDuration(); d < delay || d > after.Sub(before) {
+		t.Fatalf("dial handshake duration %v is not within [%v, %v]", d, delay, after.Sub(before))
+	}
+	if c2.HandshakeStart().Before(before.Add(delay)) {
+		t.Fatalf("accept handshake start %v is before the delay of the handler", c2.HandshakeStart())
+	}
+	if d := c2.HandshakeDuration(); d <= 0 || d >= delay {
+		t.Fatalf("accept handshake duration %v is not within (0, %v)", d, delay)
+	}
+}
+
+func TestSharedTransportEviction(t *testing.T) {
+	// Not parallel as the cache is global and TestDialReuseTransport uses it.
+
+	// A new *tls.Config per dial must not grow the cache without limit.
+	first := &tls.Config{}
+	firstTransport := sharedTransport(first, nil, nil)
+	for i := 0; i < maxSharedTransports*2; i++ {
+		sharedTransport(&tls.Config{}, nil, nil)
+
+		// Keeps first as the most recently used transport.
+		if sharedTransport(first, nil, nil) != firstTransport {
+			t.Fatal("the most recently used transport was evicted")
+		}
+	}
+
+	sharedTransports.Lock()
+	n, lru := len(sharedTransports.m), len(sharedTransports.lru)
+	sharedTransports.Unlock()
+	assert.Equal(t, "cached transports", maxSharedTransports, n)
+	assert.Equal(t, "lru keys", maxSharedTransports, lru)
+
+	// Evicting first once it is the least recently used gives it a new transport.
+	for i := 0; i < maxSharedTransports; i++ {
+		sharedTransport(&tls.Config{}, nil, nil)
+	}
+	if sharedTransport(first, nil, nil) == firstTransport {
+		t.Fatal("expected the least recently used transport to be evicted")
+	}
+}
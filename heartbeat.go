@@ -0,0 +1,70 @@
+//go:build !js
+// +build !js
+
+package websocket
+
+import (
+	"context"
+	"time"
+)
+
+// heartbeat holds the application heartbeat options
+// of AcceptOptions and DialOptions.
+type heartbeat struct {
+	interval time.Duration
+	message  func() (MessageType, []byte)
+	isAck    func(typ MessageType, p []byte) bool
+	onMiss   func()
+}
+
+func (hb heartbeat) enabled() bool {
+	return hb.interval > 0 && hb.message != nil && hb.isAck != nil
+}
+
+// observeHeartbeat records whether a message read in full
+// acknowledges the last heartbeat.
+func (c *Conn) observeHeartbeat(typ MessageType, p []byte) {
+	if c.heartbeat.enabled() && c.heartbeat.isAck(typ, p) {
+		c.heartbeatAcked.Store(true)
+	}
+}
+
+// heartbeatLoop writes a heartbeat every interval until the connection
+// is closed. If a heartbeat is not acknowledged by the time the
+// next one is due, it calls onMiss and closes the connection.
+func (c *Conn) heartbeatLoop() {
+	t := time.NewTicker(c.heartbeat.interval)
+	defer t.Stop()
+
+	sent := false
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-t.C:
+		}
+
+		if sent && !c.heartbeatAcked.Load() {
+			c.debugf("heartbeat not acknowledged within %v", c.heartbeat.interval)
+			if c.heartbeat.onMiss != nil {
+				c.heartbeat.onMiss()
+			}
+			c.Close(StatusPolicyViolation, "heartbeat not acknowledged")
+			return
+		}
+
+		// Reset before writing so that an ack read
+		// before Write returns is not lost.
+		c.heartbeatAcked.Store(false)
+		typ, p := c.heartbeat.message()
+		ctx, cancel := context.WithTimeout(context.Background(), c.heartbeat.interval)
+		// Waits for the message being written even with StrictConcurrency.
+		_, err := c.write(ctx, typ, p, false)
+		cancel()
+		if err != nil {
+			c.debugf("failed to write heartbeat: %v", err)
+			return
+		}
+		sent = true
+	}
+}
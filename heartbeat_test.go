@@ -0,0 +1,65 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	missed := make(chan struct{})
+	c1, c2 := wstest.Pipe(nil, &websocket.AcceptOptions{
+		HeartbeatInterval: time.Millisecond * 100,
+		HeartbeatMessage: func() (websocket.MessageType, []byte) {
+			return websocket.MessageText, []byte("heartbeat")
+		},
+		IsHeartbeatAck: func(typ websocket.MessageType, p []byte) bool {
+			return string(p) == "ack"
+		},
+		OnHeartbeatMiss: func() {
+			close(missed)
+		},
+	})
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	// The server reads to observe the acknowledgements.
+	go func() {
+		for {
+			_, _, err := c2.Read(ctx)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// The peer acknowledges the first two heartbeats and then stops.
+	for i := 0; i < 3; i++ {
+		_, p, err := c1.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "heartbeat", "heartbeat", string(p))
+		if i < 2 {
+			assert.Success(t, c1.Write(ctx, websocket.MessageText, []byte("ack")))
+		}
+	}
+
+	_, _, err := c1.Read(ctx)
+	assert.Equal(t, "close status", websocket.StatusPolicyViolation, websocket.CloseStatus(err))
+	select {
+	case <-missed:
+	default:
+		t.Fatal("OnHeartbeatMiss not called before the close")
+	}
+}
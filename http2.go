@@ -0,0 +1,164 @@
+//go:build !js
+// +build !js
+
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// errHTTP2Unavailable is returned by dialHTTP2 when the extended CONNECT
+// request could not be sent and Dial should fall back to HTTP/1.1.
+var errHTTP2Unavailable = errors.New("WebSocket over HTTP/2 unavailable")
+
+// dialHTTP2 performs the RFC 8441 extended CONNECT handshake.
+// See https://tools.ietf.org/html/rfc8441#section-4
+func dialHTTP2(ctx context.Context, urls string, opts *DialOptions, copts *compressionOptions, compressionMemory int64) (_ *Conn, _ *http.Response, err error) {
+	rt := opts.HTTPClient.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	if _, ok := rt.(*http.Transport); ok {
+		// See https://go.dev/issue/53208
+		return nil, nil, fmt.Errorf("%w: net/http.Transport rejects the :protocol pseudo header", errHTTP2Unavailable)
+	}
+
+	u, err := url.Parse(urls)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, nil, fmt.Errorf("unexpected url scheme: %q", u.Scheme)
+	}
+
+	// The stream lives as long as the request context and so it cannot be
+	// bound to ctx which only bounds the handshake.
+	streamCtx, streamCancel := context.WithCancel(context.Background())
+	handshakeDone := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			streamCancel()
+		case <-handshakeDone:
+		}
+	}()
+	defer func() {
+		close(handshakeDone)
+		if err != nil {
+			streamCancel()
+		}
+	}()
+
+	pr, pw := io.Pipe()
+	req, err := http.NewRequestWithContext(streamCtx, "CONNECT", u.String(), pr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create new http request: %w", err)
+	}
+	if len(opts.Host) > 0 {
+		req.Host = opts.Host
+	}
+	req.Header = opts.HTTPHeader.Clone()
+	opts.setBasicAuth(req)
+	req.Header.Set(":protocol", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if len(opts.Subprotocols) > 0 {
+		req.Header.Set("Sec-WebSocket-Protocol", strings.Join(opts.Subprotocols, ","))
+	}
+	if copts != nil || len(opts.Extensions) > 0 {
+		req.Header.Set("Sec-WebSocket-Extensions", extensionsHeader(copts, opts.Extensions))
+	}
+	err = opts.modifyRequest(req, ":protocol", "Sec-WebSocket-Version")
+	if err != nil {
+		pw.Close()
+		return nil, nil, err
+	}
+
+	handshakeStart := time.Now()
+	resp, err := opts.HTTPClient.Do(req)
+	handshakeDuration := time.Since(handshakeStart)
+	if err != nil {
+		pw.Close()
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("failed to send handshake request: %w", ctx.Err())
+		}
+		return nil, nil, fmt.Errorf("failed to send handshake request: %w", err)
+	}
+
+	if resp.ProtoMajor != 2 {
+		pw.Close()
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("%w: server responded with %v", errHTTP2Unavailable, resp.Proto)
+	}
+	switch resp.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		// The server does not support the extended CONNECT method.
+		pw.Close()
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("%w: server responded with %v", errHTTP2Unavailable, resp.Status)
+	}
+
+	copts, exts, err := verifyServerResponseHTTP2(opts, copts, resp)
+	if err != nil {
+		pw.Close()
+		readErrorBody(resp, resp.Body)
+		return nil, resp, err
+	}
+
+	rwc := &http2Stream{
+		ReadCloser: resp.Body,
+		pw:         pw,
+		cancel:     streamCancel,
+	}
+	resp.Body = nil
+
+	cfg := opts.connConfig(resp, rwc, copts, exts, compressionMemory)
+	cfg.handshakeStart = handshakeStart
+	cfg.handshakeDuration = handshakeDuration
+	return newConn(cfg), resp, nil
+}
+
+func verifyServerResponseHTTP2(opts *DialOptions, copts *compressionOptions, resp *http.Response) (*compressionOptions, []Extension, error) {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, fmt.Errorf("expected extended CONNECT response status code 2xx but got %v", resp.StatusCode)
+	}
+
+	err := verifySubprotocol(opts, resp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return verifyServerExtensions(copts, opts.Extensions, resp.Header)
+}
+
+// http2Stream is the io.ReadWriteCloser of an extended CONNECT stream.
+// Reads come from the response body and writes go to the request body.
+type http2Stream struct {
+	io.ReadCloser
+	pw     *io.PipeWriter
+	cancel context.CancelFunc
+}
+
+func (s *http2Stream) Write(p []byte) (int, error) {
+	return s.pw.Write(p)
+}
+
+func (s *http2Stream) Close() error {
+	s.pw.Close()
+	err := s.ReadCloser.Close()
+	s.cancel()
+	return err
+}
@@ -0,0 +1,98 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+)
+
+func TestDialHTTP2(t *testing.T) {
+	t.Parallel()
+
+	t.Run("fallback", func(t *testing.T) {
+		t.Parallel()
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := websocket.Accept(w, r, nil)
+			if err != nil {
+				return
+			}
+			c.Close(websocket.StatusNormalClosure, "")
+		}))
+		defer s.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c, resp, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+			AllowHTTP2: true,
+		})
+		assert.Success(t, err)
+		defer c.CloseNow()
+		assert.Equal(t, "status code", http.StatusSwitchingProtocols, resp.StatusCode)
+	})
+
+	t.Run("noFallbackOnOtherErrors", func(t *testing.T) {
+		t.Parallel()
+
+		var methods []string
+		rt := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			methods = append(methods, r.Method)
+			return nil, errors.New("x509: certificate signed by unknown authority")
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		_, _, err := websocket.Dial(ctx, "wss://example.com", &websocket.DialOptions{
+			HTTPClient: &http.Client{Transport: rt},
+			AllowHTTP2: true,
+		})
+		assert.Contains(t, err, "x509")
+		assert.Equal(t, "methods", []string{"CONNECT"}, methods)
+	})
+
+	t.Run("fallbackOnStatus", func(t *testing.T) {
+		t.Parallel()
+
+		var methods []string
+		rt := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			methods = append(methods, r.Method)
+			if r.Method == "CONNECT" {
+				return &http.Response{
+					Status:     "501 Not Implemented",
+					StatusCode: http.StatusNotImplemented,
+					ProtoMajor: 2,
+					Header:     http.Header{},
+					Body:       http.NoBody,
+				}, nil
+			}
+			return nil, errors.New("upgrade failed")
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		_, _, err := websocket.Dial(ctx, "wss://example.com", &websocket.DialOptions{
+			HTTPClient: &http.Client{Transport: rt},
+			AllowHTTP2: true,
+		})
+		assert.Contains(t, err, "upgrade failed")
+		assert.Equal(t, "methods", []string{"CONNECT", "GET"}, methods)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
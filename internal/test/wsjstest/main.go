@@ -0,0 +1,45 @@
+//go:build !js
+// +build !js
+
+// Command wsjstest starts an echo server for the tests of the
+// browser implementation and prints its URL on the first line.
+// The server negotiates permessage-deflate so that the tests can
+// inspect the extensions chosen by the browser.
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func main() {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			CompressionMode:    websocket.CompressionContextTakeover,
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = wstest.EchoLoop(r.Context(), c)
+		if websocket.CloseStatus(err) != websocket.StatusNormalClosure {
+			log.Fatalf("unexpected loop error: %+v", err)
+		}
+	}))
+
+	wsURL := s.URL
+	wsURL = "ws" + wsURL[len("http"):]
+	fmt.Printf("%v\n", wsURL)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	<-sigs
+}
@@ -0,0 +1,145 @@
+package wstest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/errd"
+)
+
+// ErrAutobahnUnavailable is returned by RunAutobahnClient when the
+// fuzzingserver cannot be reached. Tests should skip on it.
+var ErrAutobahnUnavailable = errors.New("autobahn fuzzingserver unavailable")
+
+// RunAutobahnClient runs every case of the Autobahn TestSuite fuzzingserver
+// at serverURL with agent as the client name and then asks the server to
+// update its reports. Each case is echoed with EchoLoop over a connection
+// dialed with dialOpts.
+//
+// The results are then checked with CheckAutobahnReport, e.g.
+//
+//	err := wstest.RunAutobahnClient(ctx, "ws://localhost:9001", "websocket", nil)
+//	if errors.Is(err, wstest.ErrAutobahnUnavailable) {
+//		t.Skip(err)
+//	}
+//	assert.Success(t, err)
+//	assert.Success(t, wstest.CheckAutobahnReport("ci/out/autobahn-report", "websocket"))
+func RunAutobahnClient(ctx context.Context, serverURL, agent string, dialOpts *websocket.DialOptions) (err error) {
+	defer errd.Wrap(&err, "failed to run autobahn client")
+
+	cases, err := autobahnCaseCount(ctx, serverURL)
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= cases; i++ {
+		err = runAutobahnCase(ctx, serverURL, agent, i, dialOpts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return updateAutobahnReports(ctx, serverURL, agent)
+}
+
+func autobahnCaseCount(ctx context.Context, serverURL string) (cases int, err error) {
+	c, _, err := websocket.Dial(ctx, serverURL+"/getCaseCount", nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrAutobahnUnavailable, err)
+	}
+	defer c.Close(websocket.StatusInternalError, "")
+
+	_, r, err := c.Reader(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read case count: %w", err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read case count: %w", err)
+	}
+	cases, err = strconv.Atoi(string(b))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse case count: %w", err)
+	}
+
+	c.Close(websocket.StatusNormalClosure, "")
+	return cases, nil
+}
+
+func runAutobahnCase(ctx context.Context, serverURL, agent string, i int, dialOpts *websocket.DialOptions) error {
+	u := fmt.Sprintf("%v/runCase?case=%v&agent=%v", serverURL, i, url.QueryEscape(agent))
+	c, _, err := websocket.Dial(ctx, u, dialOpts)
+	if err != nil {
+		return fmt.Errorf("failed to dial case %v: %w", i, err)
+	}
+	// The fuzzingserver closes the connection once the case is done
+	// and judges the behaviour itself so the error is irrelevant.
+	EchoLoop(ctx, c)
+	return nil
+}
+
+func updateAutobahnReports(ctx context.Context, serverURL, agent string) error {
+	u := fmt.Sprintf("%v/updateReports?agent=%v", serverURL, url.QueryEscape(agent))
+	c, _, err := websocket.Dial(ctx, u, nil)
+	if err != nil {
+		return fmt.Errorf("failed to update reports: %w", err)
+	}
+	c.Close(websocket.StatusNormalClosure, "")
+	return nil
+}
+
+// CheckAutobahnReport parses the index.json report written by the fuzzingserver
+// into reportDir and returns an error listing every case of agent whose behaviour
+// or close behaviour is not OK. NON-STRICT and INFORMATIONAL results are allowed.
+func CheckAutobahnReport(reportDir, agent string) (err error) {
+	defer errd.Wrap(&err, "failed to check autobahn report")
+
+	b, err := os.ReadFile(filepath.Join(reportDir, "index.json"))
+	if err != nil {
+		return err
+	}
+
+	var report map[string]map[string]struct {
+		Behavior      string `json:"behavior"`
+		BehaviorClose string `json:"behaviorClose"`
+	}
+	err = json.Unmarshal(b, &report)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal report: %w", err)
+	}
+
+	results, ok := report[agent]
+	if !ok {
+		return fmt.Errorf("no results for agent %q", agent)
+	}
+
+	var failed []string
+	for id, res := range results {
+		if !autobahnOK(res.Behavior) || !autobahnOK(res.BehaviorClose) {
+			failed = append(failed, fmt.Sprintf("%v (%v, close %v)", id, res.Behavior, res.BehaviorClose))
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("%v of %v cases failed: %q", len(failed), len(results), failed)
+	}
+	return nil
+}
+
+func autobahnOK(behavior string) bool {
+	switch behavior {
+	case "OK", "NON-STRICT", "INFORMATIONAL":
+		return true
+	default:
+		return false
+	}
+}
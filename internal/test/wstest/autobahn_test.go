@@ -0,0 +1,144 @@
+//go:build !js
+// +build !js
+
+package wstest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestRunAutobahnClient(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// A fake fuzzingserver whose cases each check that a message is echoed.
+	var mu sync.Mutex
+	var ran []string
+	var updated string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+
+		switch r.URL.Path {
+		case "/getCaseCount":
+			c.Write(ctx, websocket.MessageText, []byte("3"))
+		case "/runCase":
+			msg := "case " + r.URL.Query().Get("case")
+			err = c.Write(ctx, websocket.MessageText, []byte(msg))
+			if err != nil {
+				return
+			}
+			_, p, err := c.Read(ctx)
+			if err != nil || string(p) != msg {
+				return
+			}
+			mu.Lock()
+			ran = append(ran, r.URL.Query().Get("agent")+": "+string(p))
+			mu.Unlock()
+		case "/updateReports":
+			mu.Lock()
+			updated = r.URL.Query().Get("agent")
+			mu.Unlock()
+		}
+		c.Close(websocket.StatusNormalClosure, "")
+	}))
+	defer s.Close()
+
+	err := wstest.RunAutobahnClient(ctx, "ws"+strings.TrimPrefix(s.URL, "http"), "a b", nil)
+	assert.Success(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "echoed cases", []string{"a b: case 1", "a b: case 2", "a b: case 3"}, ran)
+	assert.Equal(t, "updated agent", "a b", updated)
+}
+
+func TestRunAutobahnClientUnavailable(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+
+	err := wstest.RunAutobahnClient(ctx, "ws"+strings.TrimPrefix(s.URL, "http"), "websocket", nil)
+	if !errors.Is(err, wstest.ErrAutobahnUnavailable) {
+		t.Fatalf("expected %v but got %v", wstest.ErrAutobahnUnavailable, err)
+	}
+}
+
+func TestCheckAutobahnReport(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		report string
+		errs   []string
+	}{
+		{
+			name: "ok",
+			report: `{"websocket": {
+				"1.1.1": {"behavior": "OK", "behaviorClose": "OK"},
+				"6.4.1": {"behavior": "NON-STRICT", "behaviorClose": "OK"},
+				"7.1.6": {"behavior": "INFORMATIONAL", "behaviorClose": "INFORMATIONAL"}
+			}}`,
+		},
+		{
+			name: "failed",
+			report: `{"websocket": {
+				"1.1.1": {"behavior": "OK", "behaviorClose": "OK"},
+				"2.1": {"behavior": "FAILED", "behaviorClose": "OK"},
+				"3.1": {"behavior": "OK", "behaviorClose": "UNCLEAN"}
+			}}`,
+			errs: []string{"2 of 3 cases failed", "2.1 (FAILED, close OK)", "3.1 (OK, close UNCLEAN)"},
+		},
+		{
+			name:   "missingAgent",
+			report: `{"other": {"1.1.1": {"behavior": "OK", "behaviorClose": "OK"}}}`,
+			errs:   []string{`no results for agent "websocket"`},
+		},
+		{
+			name:   "invalid",
+			report: `{`,
+			errs:   []string{"failed to unmarshal report"},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, "index.json"), []byte(tc.report), 0o644)
+			assert.Success(t, err)
+
+			err = wstest.CheckAutobahnReport(dir, "websocket")
+			if len(tc.errs) == 0 {
+				assert.Success(t, err)
+				return
+			}
+			for _, exp := range tc.errs {
+				assert.Contains(t, err, exp)
+			}
+		})
+	}
+}
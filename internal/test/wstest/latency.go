@@ -0,0 +1,136 @@
+//go:build !js
+// +build !js
+
+package wstest
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/oarkflow/websocket/internal/test/xrand"
+)
+
+// latencyConn delays every write to the underlying net.Conn.
+type latencyConn struct {
+	net.Conn
+	latency time.Duration
+	jitter  time.Duration
+
+	writes    chan latencyWrite
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu        sync.Mutex
+	lastWrite time.Time
+	err       error
+}
+
+type latencyWrite struct {
+	at time.Time
+	p  []byte
+}
+
+func newLatencyConn(c net.Conn, latency, jitter time.Duration) *latencyConn {
+	lc := &latencyConn{
+		Conn:    c,
+		latency: latency,
+		jitter:  jitter,
+		writes:  make(chan latencyWrite, 1024),
+		closed:  make(chan struct{}),
+	}
+	go lc.writeLoop()
+	return lc
+}
+
+func (lc *latencyConn) Write(p []byte) (int, error) {
+	lc.mu.Lock()
+	if lc.err != nil {
+		lc.mu.Unlock()
+		return 0, lc.err
+	}
+	at := time.Now().Add(lc.latency)
+	if lc.jitter > 0 {
+		at = at.Add(time.Duration(xrand.Int(int(lc.jitter))))
+	}
+	// Keep the order of writes.
+	if at.Before(lc.lastWrite) {
+		at = lc.lastWrite
+	}
+	lc.lastWrite = at
+	lc.mu.Unlock()
+
+	w := latencyWrite{
+		at: at,
+		p:  append([]byte(nil), p...),
+	}
+	select {
+	case <-lc.closed:
+		return 0, net.ErrClosed
+	case lc.writes <- w:
+		return len(p), nil
+	}
+}
+
+func (lc *latencyConn) writeLoop() {
+	for {
+		var w latencyWrite
+		select {
+		case <-lc.closed:
+			lc.drain()
+			return
+		case w = <-lc.writes:
+		}
+
+		time.Sleep(time.Until(w.at))
+		_, err := lc.Conn.Write(w.p)
+		if err != nil {
+			lc.setErr(err)
+			lc.Conn.Close()
+			return
+		}
+	}
+}
+
+// drain delivers the queued writes before closing the underlying
+// connection like the TCP stack would.
+func (lc *latencyConn) drain() {
+	defer lc.Conn.Close()
+
+	lc.mu.Lock()
+	deadline := lc.lastWrite.Add(time.Second)
+	lc.mu.Unlock()
+	lc.Conn.SetWriteDeadline(deadline)
+
+	for {
+		select {
+		case w := <-lc.writes:
+			time.Sleep(time.Until(w.at))
+			_, err := lc.Conn.Write(w.p)
+			if err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (lc *latencyConn) setErr(err error) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.err == nil {
+		lc.err = err
+	}
+}
+
+// Close stops reads immediately while the queued writes are still delivered.
+func (lc *latencyConn) Close() error {
+	err := net.ErrClosed
+	lc.closeOnce.Do(func() {
+		lc.setErr(net.ErrClosed)
+		close(lc.closed)
+		err = lc.Conn.SetReadDeadline(time.Now())
+	})
+	return err
+}
@@ -0,0 +1,75 @@
+//go:build !js
+// +build !js
+
+package wstest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestPipeWithLatencyPing(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	const latency = time.Millisecond * 50
+	c1, c2 := wstest.PipeWithLatency(nil, nil, latency, 0)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	// Both sides must read for the ping and pong to be handled.
+	c1.CloseRead(ctx)
+	c2.CloseRead(ctx)
+
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		err := c1.Ping(ctx)
+		assert.Success(t, err)
+
+		// The ping and the pong are each delayed by latency.
+		rtt := time.Since(start)
+		if rtt < latency*2 || rtt > latency*3 {
+			t.Fatalf("expected a ping RTT of about %v but got %v", latency*2, rtt)
+		}
+	}
+}
+
+func TestPipeWithLatencyOrder(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.PipeWithLatency(nil, nil, time.Millisecond, time.Millisecond*10)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	const n = 50
+	errs := make(chan error, 1)
+	go func() {
+		for i := 0; i < n; i++ {
+			err := c1.Write(ctx, websocket.MessageText, []byte(fmt.Sprint(i)))
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+		errs <- nil
+	}()
+
+	// The jitter delays writes by different amounts but never reorders them.
+	for i := 0; i < n; i++ {
+		_, p, err := c2.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "message", fmt.Sprint(i), string(p))
+	}
+	assert.Success(t, <-errs)
+}
@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	"github.com/oarkflow/websocket"
 )
@@ -16,10 +17,22 @@ import (
 // Pipe is used to create an in memory connection
 // between two websockets analogous to net.Pipe.
 func Pipe(dialOpts *websocket.DialOptions, acceptOpts *websocket.AcceptOptions) (clientConn, serverConn *websocket.Conn) {
-	tt := fakeTransport{
-		h: func(w http.ResponseWriter, r *http.Request) {
-			serverConn, _ = websocket.Accept(w, r, acceptOpts)
-		},
+	return PipeWithLatency(dialOpts, acceptOpts, 0, 0)
+}
+
+// PipeWithLatency is like Pipe but delays the delivery of every write in both
+// directions by latency plus a random duration in [0, jitter) to simulate a network.
+// Writes are never reordered.
+func PipeWithLatency(dialOpts *websocket.DialOptions, acceptOpts *websocket.AcceptOptions, latency, jitter time.Duration) (clientConn, serverConn *websocket.Conn) {
+	return pipe(dialOpts, acceptOpts, fakeTransport{
+		latency: latency,
+		jitter:  jitter,
+	})
+}
+
+func pipe(dialOpts *websocket.DialOptions, acceptOpts *websocket.AcceptOptions, tt fakeTransport) (clientConn, serverConn *websocket.Conn) {
+	tt.h = func(w http.ResponseWriter, r *http.Request) {
+		serverConn, _ = websocket.Accept(w, r, acceptOpts)
 	}
 
 	if dialOpts == nil {
@@ -36,11 +49,22 @@ func Pipe(dialOpts *websocket.DialOptions, acceptOpts *websocket.AcceptOptions)
 }
 
 type fakeTransport struct {
-	h http.HandlerFunc
+	h       http.HandlerFunc
+	latency time.Duration
+	jitter  time.Duration
+	rec     *Recording
 }
 
 func (t fakeTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	clientConn, serverConn := net.Pipe()
+	if t.latency > 0 || t.jitter > 0 {
+		clientConn = newLatencyConn(clientConn, t.latency, t.jitter)
+		serverConn = newLatencyConn(serverConn, t.latency, t.jitter)
+	}
+	if t.rec != nil {
+		clientConn = &recordingConn{Conn: clientConn, rec: t.rec, client: true}
+		serverConn = &recordingConn{Conn: serverConn, rec: t.rec}
+	}
 
 	hj := testHijacker{
 		ResponseRecorder: httptest.NewRecorder(),
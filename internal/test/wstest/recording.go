@@ -0,0 +1,146 @@
+//go:build !js
+// +build !js
+
+package wstest
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+
+	"github.com/oarkflow/websocket"
+)
+
+// RecordingPipe is like Pipe but also returns a Recording of the raw bytes
+// written in each direction after the handshake.
+func RecordingPipe(dialOpts *websocket.DialOptions, acceptOpts *websocket.AcceptOptions) (clientConn, serverConn *websocket.Conn, rec *Recording) {
+	rec = &Recording{}
+	clientConn, serverConn = pipe(dialOpts, acceptOpts, fakeTransport{rec: rec})
+	return clientConn, serverConn, rec
+}
+
+// Recording holds the raw bytes written by each side of a RecordingPipe.
+type Recording struct {
+	mu     sync.Mutex
+	client []byte
+	server []byte
+}
+
+// Frame is a frame parsed from a Recording.
+type Frame struct {
+	Opcode websocket.Opcode
+	Fin    bool
+	RSV1   bool
+	RSV2   bool
+	RSV3   bool
+	Masked bool
+	// Length is the payload length from the frame header.
+	Length int
+	// Payload is the unmasked payload.
+	Payload []byte
+}
+
+// ClientBytes returns a copy of the raw bytes written by the client.
+func (rec *Recording) ClientBytes() []byte {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]byte(nil), rec.client...)
+}
+
+// ServerBytes returns a copy of the raw bytes written by the server.
+func (rec *Recording) ServerBytes() []byte {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]byte(nil), rec.server...)
+}
+
+// ClientFrames returns the complete frames written by the client so far.
+func (rec *Recording) ClientFrames() []Frame {
+	return parseFrames(rec.ClientBytes())
+}
+
+// ServerFrames returns the complete frames written by the server so far.
+func (rec *Recording) ServerFrames() []Frame {
+	return parseFrames(rec.ServerBytes())
+}
+
+func (rec *Recording) record(client bool, p []byte) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if client {
+		rec.client = append(rec.client, p...)
+	} else {
+		rec.server = append(rec.server, p...)
+	}
+}
+
+// parseFrames parses the frames in b. A trailing incomplete frame is ignored.
+// See https://tools.ietf.org/html/rfc6455#section-5.2
+func parseFrames(b []byte) []Frame {
+	var frames []Frame
+	for len(b) >= 2 {
+		f := Frame{
+			Fin:    b[0]&(1<<7) != 0,
+			RSV1:   b[0]&(1<<6) != 0,
+			RSV2:   b[0]&(1<<5) != 0,
+			RSV3:   b[0]&(1<<4) != 0,
+			Opcode: websocket.Opcode(b[0] & 0xf),
+			Masked: b[1]&(1<<7) != 0,
+		}
+
+		n := 2
+		length := uint64(b[1] & 0x7f)
+		switch length {
+		case 126:
+			if len(b) < n+2 {
+				return frames
+			}
+			length = uint64(binary.BigEndian.Uint16(b[n:]))
+			n += 2
+		case 127:
+			if len(b) < n+8 {
+				return frames
+			}
+			length = binary.BigEndian.Uint64(b[n:])
+			n += 8
+		}
+
+		var maskKey []byte
+		if f.Masked {
+			if len(b) < n+4 {
+				return frames
+			}
+			maskKey = b[n : n+4]
+			n += 4
+		}
+
+		if uint64(len(b)-n) < length {
+			return frames
+		}
+		f.Length = int(length)
+		f.Payload = append([]byte(nil), b[n:n+f.Length]...)
+		for i := range f.Payload {
+			if maskKey != nil {
+				f.Payload[i] ^= maskKey[i%4]
+			}
+		}
+
+		frames = append(frames, f)
+		b = b[n+f.Length:]
+	}
+	return frames
+}
+
+// recordingConn records every write to the underlying net.Conn.
+type recordingConn struct {
+	net.Conn
+	rec    *Recording
+	client bool
+}
+
+func (rc *recordingConn) Write(p []byte) (int, error) {
+	// Record before writing so that the bytes are recorded
+	// by the time the peer has read them.
+	rc.rec.record(rc.client, p)
+	return rc.Conn.Write(p)
+}
@@ -0,0 +1,106 @@
+package wstest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/oarkflow/websocket"
+)
+
+// sequenceTagSize is the size of the sequence number
+// prepended to each message by SequenceChecker.
+const sequenceTagSize = 8
+
+// SequenceChecker wraps a *websocket.Conn to diagnose lost or reordered messages.
+// Write prepends a sequence number to each message and Read verifies that the
+// messages written by the SequenceChecker of the peer are delivered in order and
+// without gaps.
+//
+// Both peers must use a SequenceChecker as the sequence number is part of the
+// message payload.
+type SequenceChecker struct {
+	c *websocket.Conn
+
+	writeMu  sync.Mutex
+	writeSeq uint64
+
+	readMu  sync.Mutex
+	readSeq uint64
+}
+
+// NewSequenceChecker returns a SequenceChecker for c. The first message
+// written and expected to be read has the sequence number 0.
+func NewSequenceChecker(c *websocket.Conn) *SequenceChecker {
+	return &SequenceChecker{
+		c: c,
+	}
+}
+
+// SequenceError is returned by SequenceChecker.Read when a message
+// is not the one expected next.
+type SequenceError struct {
+	// Expected is the sequence number of the message expected next.
+	Expected uint64
+	// Got is the sequence number of the message read.
+	Got uint64
+}
+
+func (e *SequenceError) Error() string {
+	if e.Got > e.Expected {
+		return fmt.Sprintf("gap in message sequence: expected %v but got %v, %v messages missing", e.Expected, e.Got, e.Got-e.Expected)
+	}
+	return fmt.Sprintf("message out of order: expected %v but got %v", e.Expected, e.Got)
+}
+
+// Write writes p as a message of type typ tagged with the next sequence number.
+func (sc *SequenceChecker) Write(ctx context.Context, typ websocket.MessageType, p []byte) error {
+	sc.writeMu.Lock()
+	defer sc.writeMu.Unlock()
+
+	b := make([]byte, sequenceTagSize+len(p))
+	binary.BigEndian.PutUint64(b, sc.writeSeq)
+	copy(b[sequenceTagSize:], p)
+
+	err := sc.c.Write(ctx, typ, b)
+	if err != nil {
+		return err
+	}
+	sc.writeSeq++
+	return nil
+}
+
+// Read reads a message and returns its payload without the sequence number.
+//
+// If the message is not the one expected next, the message is still returned
+// along with a *SequenceError. After a gap, the message following the one read
+// is expected next. A message that arrives late is reported as out of order
+// without changing the message expected next. Thus every gap and reordering is
+// reported once.
+func (sc *SequenceChecker) Read(ctx context.Context) (websocket.MessageType, []byte, error) {
+	sc.readMu.Lock()
+	defer sc.readMu.Unlock()
+
+	typ, b, err := sc.c.Read(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(b) < sequenceTagSize {
+		return typ, b, errors.New("message too short for a sequence number")
+	}
+
+	seq := binary.BigEndian.Uint64(b)
+	b = b[sequenceTagSize:]
+	if seq != sc.readSeq {
+		err = &SequenceError{
+			Expected: sc.readSeq,
+			Got:      seq,
+		}
+	}
+	if seq >= sc.readSeq {
+		sc.readSeq = seq + 1
+	}
+	return typ, b, err
+}
@@ -0,0 +1,96 @@
+//go:build !js
+// +build !js
+
+package thirdparty
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws/wsutil"
+	"golang.org/x/net/http2"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+)
+
+func TestDialHTTP2(t *testing.T) {
+	t.Parallel()
+
+	if !strings.Contains(os.Getenv("GODEBUG"), "http2xconnect=1") {
+		// x/net/http2 only advertises SETTINGS_ENABLE_CONNECT_PROTOCOL with
+		// the setting which is read once when the package is initialized.
+		cmd := exec.Command(os.Args[0], "-test.run=^TestDialHTTP2$", "-test.v")
+		cmd.Env = append(os.Environ(), "GODEBUG="+os.Getenv("GODEBUG")+",http2xconnect=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v:\n%s", err, out)
+		}
+		return
+	}
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" || r.Header.Get(":protocol") != "websocket" {
+			http.Error(w, "expected extended CONNECT", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		// Echoes a single message over the stream.
+		rw := struct {
+			io.Reader
+			io.Writer
+		}{r.Body, flushWriter{w}}
+		p, op, err := wsutil.ReadClientData(rw)
+		if err != nil {
+			return
+		}
+		wsutil.WriteServerMessage(rw, op, p)
+	}))
+	err := http2.ConfigureServer(s.Config, &http2.Server{})
+	assert.Success(t, err)
+	s.TLS = s.Config.TLSConfig
+	s.StartTLS()
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	tr := &http2.Transport{
+		TLSClientConfig: s.Client().Transport.(*http.Transport).TLSClientConfig,
+	}
+	defer tr.CloseIdleConnections()
+	c, resp, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		HTTPClient: &http.Client{Transport: tr},
+		AllowHTTP2: true,
+	})
+	assert.Success(t, err)
+	defer c.CloseNow()
+	assert.Equal(t, "proto", "HTTP/2.0", resp.Proto)
+	assert.Equal(t, "status code", http.StatusOK, resp.StatusCode)
+
+	err = c.Write(ctx, websocket.MessageText, []byte("hello"))
+	assert.Success(t, err)
+	typ, p, err := c.Read(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "type", websocket.MessageText, typ)
+	assert.Equal(t, "message", "hello", string(p))
+}
+
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.w.(http.Flusher).Flush()
+	return n, err
+}
@@ -0,0 +1,34 @@
+//go:build !js
+// +build !js
+
+package websocket
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// setTCPKeepAlive applies the TCPKeepAlive option d to the TCP connection
+// underlying nc. It does nothing for other connections.
+func setTCPKeepAlive(nc net.Conn, d time.Duration) error {
+	if d == 0 {
+		return nil
+	}
+	if tc, ok := nc.(*tls.Conn); ok {
+		nc = tc.NetConn()
+	}
+	tcp, ok := nc.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	if d < 0 {
+		return tcp.SetKeepAlive(false)
+	}
+	err := tcp.SetKeepAlive(true)
+	if err != nil {
+		return err
+	}
+	return tcp.SetKeepAlivePeriod(d)
+}
@@ -0,0 +1,92 @@
+//go:build linux
+// +build linux
+
+package websocket_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+)
+
+func TestTCPKeepAlive(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	serverConns := make(chan net.Conn, 1)
+	accepted := make(chan struct{})
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			TCPKeepAlive: time.Second * 11,
+		})
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+		close(accepted)
+		c.CloseRead(ctx)
+		<-c.Closed()
+	}))
+	s.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			serverConns <- c
+		}
+	}
+	s.Start()
+	defer s.Close()
+
+	clientConns := make(chan net.Conn, 1)
+	c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					// Keep-alives are disabled so that only the option enables them.
+					nc, err := (&net.Dialer{KeepAlive: -1}).DialContext(ctx, network, addr)
+					if err == nil {
+						clientConns <- nc
+					}
+					return nc, err
+				},
+			},
+		},
+		TCPKeepAlive: time.Second * 7,
+	})
+	assert.Success(t, err)
+	defer c.CloseNow()
+	<-accepted
+
+	assertKeepAlive(t, "client", <-clientConns, 7)
+	assertKeepAlive(t, "server", <-serverConns, 11)
+}
+
+// assertKeepAlive asserts that keep-alives are enabled on nc
+// with an idle time of idleSeconds.
+func assertKeepAlive(t *testing.T, name string, nc net.Conn, idleSeconds int) {
+	t.Helper()
+
+	sc, err := nc.(*net.TCPConn).SyscallConn()
+	assert.Success(t, err)
+
+	var keepAlive, idle int
+	var sockErr error
+	err = sc.Control(func(fd uintptr) {
+		keepAlive, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_KEEPALIVE)
+		if sockErr != nil {
+			return
+		}
+		idle, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE)
+	})
+	assert.Success(t, err)
+	assert.Success(t, sockErr)
+	assert.Equal(t, name+" keep-alive", 1, keepAlive)
+	assert.Equal(t, name+" keep-alive idle", idleSeconds, idle)
+}
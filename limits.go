@@ -0,0 +1,13 @@
+package websocket
+
+// DefaultReadLimit is the message read limit of a new connection in bytes.
+// See SetReadLimit.
+const DefaultReadLimit = 32768
+
+// maxControlPayload is the maximum length of a control frame payload.
+// See https://tools.ietf.org/html/rfc6455#section-5.5.
+const maxControlPayload = 125
+
+// maxCloseReason is the maximum length of a close reason as the
+// close frame payload starts with the 2 byte status code.
+const maxCloseReason = maxControlPayload - 2
@@ -45,6 +45,20 @@ import (
 // io.EOF when reading.
 //
 // Furthermore, the ReadLimit is set to -1 to disable it.
+//
+// The net.Conn has a CloseWrite method like *net.TCPConn to half-close the
+// connection. It signals the end of the stream to the peer by writing an empty
+// message of the other data type, e.g. an empty MessageText for MessageBinary.
+// Reads from a net.Conn returned by NetConn return io.EOF once it is received
+// while the peer may keep writing. Close must still be called to close the
+// *websocket.Conn.
+//
+// The net.Conn implements io.ReaderFrom and io.WriterTo so that io.Copy streams
+// data without an intermediate buffer. ReadFrom writes everything read as a single
+// message and flushes every chunk read to the peer so that an interactive source
+// is not held back until it ends. WriteTo copies every message to the io.Writer
+// as it is read. When running as WASM, the message of ReadFrom is only sent once
+// the source ends as the browser API cannot send part of a message.
 func NetConn(ctx context.Context, c *Conn, msgType MessageType) net.Conn {
 	c.SetReadLimit(-1)
 
@@ -102,6 +116,7 @@ type netConn struct {
 	writeExpired atomic.Int64
 	writeCtx     context.Context
 	writeCancel  context.CancelFunc
+	writeClosed  bool
 
 	readTimer   *time.Timer
 	readMu      *mu
@@ -129,6 +144,9 @@ func (nc *netConn) Write(p []byte) (int, error) {
 	if nc.writeExpired.Load() == 1 {
 		return 0, fmt.Errorf("failed to write: %w", context.DeadlineExceeded)
 	}
+	if nc.writeClosed {
+		return 0, fmt.Errorf("failed to write: %w", net.ErrClosed)
+	}
 
 	err := nc.c.Write(nc.writeCtx, nc.msgType, p)
 	if err != nil {
@@ -137,6 +155,118 @@ func (nc *netConn) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// CloseWrite writes the end of stream message. Further writes fail with
+// net.ErrClosed but reads continue until the peer closes its side.
+func (nc *netConn) CloseWrite() error {
+	nc.writeMu.forceLock()
+	defer nc.writeMu.unlock()
+
+	if nc.writeClosed {
+		return nil
+	}
+	if nc.writeExpired.Load() == 1 {
+		return fmt.Errorf("failed to close write: %w", context.DeadlineExceeded)
+	}
+
+	err := nc.c.Write(nc.writeCtx, eofMessageType(nc.msgType), nil)
+	if err != nil {
+		return fmt.Errorf("failed to close write: %w", err)
+	}
+	nc.writeClosed = true
+	return nil
+}
+
+// eofMessageType returns the data message type used to signal
+// the end of a stream of msgType messages.
+func eofMessageType(msgType MessageType) MessageType {
+	if msgType == MessageBinary {
+		return MessageText
+	}
+	return MessageBinary
+}
+
+var (
+	_ io.ReaderFrom = &netConn{}
+	_ io.WriterTo   = &netConn{}
+)
+
+// ReadFrom writes everything read from r until io.EOF as a single message,
+// flushing every chunk read. If r returns an error, the message is aborted as
+// with WriteFrom which closes the connection once part of it was flushed.
+func (nc *netConn) ReadFrom(r io.Reader) (int64, error) {
+	nc.writeMu.forceLock()
+	defer nc.writeMu.unlock()
+
+	if nc.writeExpired.Load() == 1 {
+		return 0, fmt.Errorf("failed to write: %w", context.DeadlineExceeded)
+	}
+	if nc.writeClosed {
+		return 0, fmt.Errorf("failed to write: %w", net.ErrClosed)
+	}
+
+	w, err := nc.c.Writer(nc.writeCtx, nc.msgType)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(flushWriter{w}, r)
+	if err != nil {
+		err2 := w.(interface{ Abort() error }).Abort()
+		if err2 != nil {
+			return n, fmt.Errorf("%w; failed to abort message: %v", err, err2)
+		}
+		return n, err
+	}
+	return n, w.Close()
+}
+
+// flushWriter flushes every write to w so that it reaches the peer.
+type flushWriter struct {
+	w io.Writer
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if f, ok := fw.w.(interface{ Flush() error }); ok {
+		err = f.Flush()
+	}
+	return n, err
+}
+
+// WriteTo copies every message read to w until the peer ends the stream.
+func (nc *netConn) WriteTo(w io.Writer) (int64, error) {
+	nc.readMu.forceLock()
+	defer nc.readMu.unlock()
+
+	var written int64
+	for {
+		if nc.readExpired.Load() == 1 {
+			return written, fmt.Errorf("failed to read: %w", context.DeadlineExceeded)
+		}
+		if nc.readEOFed {
+			return written, nil
+		}
+		if nc.reader == nil {
+			err := nc.nextReader()
+			if err == io.EOF {
+				return written, nil
+			}
+			if err != nil {
+				return written, err
+			}
+		}
+
+		n, err := io.Copy(w, nc.reader)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		nc.reader = nil
+	}
+}
+
 func (nc *netConn) Read(p []byte) (int, error) {
 	nc.readMu.forceLock()
 	defer nc.readMu.unlock()
@@ -163,21 +293,10 @@ func (nc *netConn) read(p []byte) (int, error) {
 	}
 
 	if nc.reader == nil {
-		typ, r, err := nc.c.Reader(nc.readCtx)
+		err := nc.nextReader()
 		if err != nil {
-			switch CloseStatus(err) {
-			case StatusNormalClosure, StatusGoingAway:
-				nc.readEOFed = true
-				return 0, io.EOF
-			}
 			return 0, err
 		}
-		if typ != nc.msgType {
-			err := fmt.Errorf("unexpected frame type read (expected %v): %v", nc.msgType, typ)
-			nc.c.Close(StatusUnsupportedData, err.Error())
-			return 0, err
-		}
-		nc.reader = r
 	}
 
 	n, err := nc.reader.Read(p)
@@ -188,6 +307,44 @@ func (nc *netConn) read(p []byte) (int, error) {
 	return n, err
 }
 
+// nextReader sets nc.reader to the reader of the next message.
+// It returns io.EOF once the peer has ended the stream.
+func (nc *netConn) nextReader() error {
+	var typ MessageType
+	var r io.Reader
+	for {
+		var err error
+		typ, r, err = nc.c.Reader(nc.readCtx)
+		if err != nil {
+			switch CloseStatus(err) {
+			case StatusNormalClosure, StatusGoingAway:
+				nc.readEOFed = true
+				return io.EOF
+			}
+			return err
+		}
+		// Skip the control frames delivered with DeliverControlFrames.
+		if typ != MessagePing && typ != MessagePong {
+			break
+		}
+	}
+	if typ != nc.msgType {
+		if typ == eofMessageType(nc.msgType) {
+			var b [1]byte
+			_, err := io.ReadFull(r, b[:])
+			if err == io.EOF {
+				nc.readEOFed = true
+				return io.EOF
+			}
+		}
+		err := fmt.Errorf("unexpected frame type read (expected %v): %v", nc.msgType, typ)
+		nc.c.Close(StatusUnsupportedData, err.Error())
+		return err
+	}
+	nc.reader = r
+	return nil
+}
+
 type websocketAddr struct {
 }
 
@@ -0,0 +1,116 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestNetConnCopy(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	n1 := websocket.NetConn(ctx, c1, websocket.MessageBinary)
+	n2 := websocket.NetConn(ctx, c2, websocket.MessageBinary)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	msg := strings.Repeat("hello", 10000)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- func() error {
+			n, err := io.Copy(n1, strings.NewReader(msg))
+			if err != nil {
+				return err
+			}
+			if n != int64(len(msg)) {
+				return io.ErrShortWrite
+			}
+			return n1.(interface{ CloseWrite() error }).CloseWrite()
+		}()
+	}()
+
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, n2)
+	assert.Success(t, err)
+	assert.Equal(t, "copied", int64(len(msg)), n)
+	assert.Equal(t, "msg", msg, buf.String())
+	assert.Success(t, <-errs)
+}
+
+func TestNetConnReadFrom(t *testing.T) {
+	t.Parallel()
+
+	t.Run("interactive", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+		n1 := websocket.NetConn(ctx, c1, websocket.MessageBinary)
+		n2 := websocket.NetConn(ctx, c2, websocket.MessageBinary)
+
+		// The source never ends and so each chunk must be flushed as it is read.
+		pr, pw := io.Pipe()
+		defer pw.Close()
+		go io.Copy(n1, pr)
+
+		for _, msg := range []string{"ping", "pong"} {
+			go pw.Write([]byte(msg))
+
+			n2.SetReadDeadline(time.Now().Add(time.Second * 2))
+			b := make([]byte, len(msg))
+			_, err := io.ReadFull(n2, b)
+			assert.Success(t, err)
+			assert.Equal(t, "chunk", msg, string(b))
+		}
+	})
+
+	t.Run("sourceError", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+		n1 := websocket.NetConn(ctx, c1, websocket.MessageBinary)
+		n2 := websocket.NetConn(ctx, c2, websocket.MessageBinary)
+
+		pr, pw := io.Pipe()
+		errs := make(chan error, 1)
+		go func() {
+			_, err := io.Copy(n1, pr)
+			errs <- err
+		}()
+
+		go pw.Write([]byte("partial"))
+		b := make([]byte, len("partial"))
+		_, err := io.ReadFull(n2, b)
+		assert.Success(t, err)
+
+		// The truncated message must not be read as complete.
+		pw.CloseWithError(errors.New("source failed"))
+		assert.Contains(t, <-errs, "source failed")
+		_, err = io.ReadAll(n2)
+		assert.Error(t, err)
+	})
+}
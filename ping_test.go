@@ -0,0 +1,95 @@
+//go:build !js
+// +build !js
+
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipe returns a connected client and server Conn over a net.Pipe.
+func pipe() (client, server *Conn) {
+	c1, c2 := net.Pipe()
+	client = newConn(connConfig{
+		rwc:    c1,
+		client: true,
+		br:     bufio.NewReader(c1),
+		bw:     bufio.NewWriter(c1),
+	})
+	server = newConn(connConfig{
+		rwc: c2,
+		br:  bufio.NewReader(c2),
+		bw:  bufio.NewWriter(c2),
+	})
+	return client, server
+}
+
+func TestPongEchoesPing(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client, server := pipe()
+	defer client.CloseNow()
+	defer server.CloseNow()
+
+	p := make([]byte, maxControlPayload)
+	for i := range p {
+		p[i] = byte(255 - i)
+	}
+
+	pong := make(chan struct{}, 1)
+	client.activePingsMu.Lock()
+	client.activePings[string(p)] = pong
+	client.activePingsMu.Unlock()
+
+	server.CloseRead(ctx)
+	client.CloseRead(ctx)
+
+	err := client.writeControl(ctx, opPing, append([]byte(nil), p...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-pong:
+	case <-ctx.Done():
+		t.Fatal("no pong with the ping payload received")
+	}
+}
+
+func TestOversizedPing(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client, server := pipe()
+	defer client.CloseNow()
+	defer server.CloseNow()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.writeFrame(ctx, true, false, opPing, make([]byte, maxControlPayload+1))
+		if err == nil {
+			_, _, err = client.Read(ctx)
+		}
+		errs <- err
+	}()
+
+	_, _, err := server.Read(ctx)
+	if err == nil {
+		t.Fatal("expected an error reading an oversized ping")
+	}
+	server.CloseNow()
+
+	err = <-errs
+	if CloseStatus(err) != StatusProtocolError {
+		t.Fatalf("expected close status %v: %v", StatusProtocolError, err)
+	}
+}
@@ -0,0 +1,80 @@
+//go:build !js
+// +build !js
+
+package websocket
+
+import "strconv"
+
+// ProtocolErrorReason is the category of a ProtocolError.
+type ProtocolErrorReason int
+
+// ProtocolErrorReason constants.
+const (
+	// UnexpectedContinuation is for a continuation frame without a message to continue.
+	UnexpectedContinuation ProtocolErrorReason = iota + 1
+	// UnfinishedMessage is for a new data message before the previous one is finished.
+	UnfinishedMessage
+	// ReservedBitSet is for a frame with a reserved bit set that no extension defines.
+	ReservedBitSet
+	// InvalidOpcode is for a frame with a reserved opcode.
+	InvalidOpcode
+	// ControlFrameTooLong is for a control frame with a payload longer than 125 bytes.
+	ControlFrameTooLong
+	// FragmentedControlFrame is for a control frame without the fin bit set.
+	FragmentedControlFrame
+	// InvalidClosePayload is for a close frame with a malformed payload or invalid status code.
+	InvalidClosePayload
+	// FragmentedMessage is for a fragmented data message with RejectFragmentedMessages.
+	FragmentedMessage
+)
+
+func (r ProtocolErrorReason) String() string {
+	switch r {
+	case UnexpectedContinuation:
+		return "unexpected continuation"
+	case UnfinishedMessage:
+		return "unfinished message"
+	case ReservedBitSet:
+		return "reserved bit set"
+	case InvalidOpcode:
+		return "invalid opcode"
+	case ControlFrameTooLong:
+		return "control frame too long"
+	case FragmentedControlFrame:
+		return "fragmented control frame"
+	case InvalidClosePayload:
+		return "invalid close payload"
+	case FragmentedMessage:
+		return "fragmented message"
+	default:
+		return "ProtocolErrorReason(" + strconv.Itoa(int(r)) + ")"
+	}
+}
+
+// ProtocolError is returned when the peer violates the WebSocket protocol.
+// The connection is closed with StatusProtocolError.
+//
+// Use errors.As to get the Reason of an error returned by the read methods.
+type ProtocolError struct {
+	Reason ProtocolErrorReason
+	Err    error
+}
+
+func (pe ProtocolError) Error() string {
+	return pe.Err.Error()
+}
+
+func (pe ProtocolError) Unwrap() error {
+	return pe.Err
+}
+
+// protocolError writes a close frame with StatusProtocolError
+// and returns err as a ProtocolError with the given reason.
+func (c *Conn) protocolError(reason ProtocolErrorReason, err error) error {
+	err = ProtocolError{
+		Reason: reason,
+		Err:    err,
+	}
+	c.writeError(StatusProtocolError, err)
+	return err
+}
@@ -0,0 +1,108 @@
+//go:build !js
+// +build !js
+
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket/internal/test/assert"
+)
+
+func TestProtocolError(t *testing.T) {
+	t.Parallel()
+
+	// Every frame is masked with the zero key so the payload is sent as is.
+	frame := func(b0 byte, payload ...byte) []byte {
+		p := []byte{b0}
+		if len(payload) < 126 {
+			p = append(p, 0x80|byte(len(payload)))
+		} else {
+			p = append(p, 0x80|126, byte(len(payload)>>8), byte(len(payload)))
+		}
+		p = append(p, 0, 0, 0, 0)
+		return append(p, payload...)
+	}
+	join := func(frames ...[]byte) []byte {
+		var p []byte
+		for _, f := range frames {
+			p = append(p, f...)
+		}
+		return p
+	}
+
+	for name, tc := range map[string]struct {
+		raw    []byte
+		reason ProtocolErrorReason
+	}{
+		"unexpectedContinuation": {frame(0x80), UnexpectedContinuation},
+		"unfinishedMessage":      {join(frame(0x01), frame(0x81)), UnfinishedMessage},
+		"reservedBitSet":         {frame(0x81 | 0x20), ReservedBitSet},
+		"invalidOpcode":          {frame(0x83), InvalidOpcode},
+		"controlFrameTooLong":    {frame(0x89, make([]byte, 126)...), ControlFrameTooLong},
+		"fragmentedControlFrame": {frame(0x09), FragmentedControlFrame},
+		"invalidClosePayload":    {frame(0x88, 0), InvalidClosePayload},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			client, server := pipe()
+			defer client.CloseNow()
+			defer server.CloseNow()
+
+			// The raw frames are written directly to the underlying connection
+			// and everything the server writes back, e.g. its close frame, is discarded.
+			go client.rwc.Write(tc.raw)
+			go io.Copy(io.Discard, client.rwc)
+
+			_, _, err := server.Read(ctx)
+			var pe ProtocolError
+			if !errors.As(err, &pe) {
+				t.Fatalf("expected a ProtocolError but got %v", err)
+			}
+			assert.Equal(t, "reason", tc.reason, pe.Reason)
+		})
+	}
+}
+
+func TestProtocolErrorLogf(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client, server := pipe()
+	defer client.CloseNow()
+	defer server.CloseNow()
+
+	logs := make(chan string, 1)
+	server.logf = func(format string, v ...interface{}) {
+		select {
+		case logs <- fmt.Sprintf(format, v...):
+		default:
+		}
+	}
+
+	// A ping without the fin bit is a malformed control frame.
+	go client.rwc.Write([]byte{0x09, 0x80, 0, 0, 0, 0})
+	go io.Copy(io.Discard, client.rwc)
+
+	_, _, err := server.Read(ctx)
+	assert.Error(t, err)
+	select {
+	case log := <-logs:
+		assert.Contains(t, log, "closing connection with StatusProtocolError")
+		assert.Contains(t, log, "fragmented control frame")
+	case <-ctx.Done():
+		t.Fatal("expected the protocol violation to be logged")
+	}
+}
@@ -0,0 +1,66 @@
+//go:build !js
+// +build !js
+
+package websocket
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrReadRateLimited is returned by Reader and Read when the peer
+// exceeds the rate configured with AcceptOptions.ReadRateLimit.
+var ErrReadRateLimited = errors.New("read rate limit exceeded")
+
+// RateLimit configures a message rate limit enforced with a token bucket.
+type RateLimit struct {
+	// Rate is the average number of messages allowed per second.
+	// A Rate <= 0 disables the limit.
+	Rate float64
+
+	// Burst is the maximum number of messages allowed in a burst.
+	// Defaults to 1.
+	Burst int
+}
+
+// tokenBucket implements RateLimit.
+// It is only used while holding readMu and so is not safe for concurrent use.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// tripped is set once the limit is exceeded so that later reads
+	// keep failing instead of reading past the rejected message.
+	tripped bool
+}
+
+func newTokenBucket(rl *RateLimit) *tokenBucket {
+	burst := float64(rl.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rl.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+func (tb *tokenBucket) allow() bool {
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+
+	if tb.tokens < 1 {
+		tb.tripped = true
+		return false
+	}
+	tb.tokens--
+	return true
+}
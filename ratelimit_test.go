@@ -0,0 +1,99 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestReadRateLimit(t *testing.T) {
+	t.Parallel()
+
+	t.Run("trip", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		// A real TCP connection is used so that both peers can write their
+		// close frames without waiting for the other to read.
+		errs := make(chan error, 1)
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+				ReadRateLimit: &websocket.RateLimit{Rate: 0.001, Burst: 1},
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer c.CloseNow()
+
+			errs <- func() error {
+				_, b, err := c.Read(ctx)
+				if err != nil {
+					return err
+				}
+				if string(b) != "a" {
+					return fmt.Errorf("unexpected message %q", b)
+				}
+				for i := 0; i < 2; i++ {
+					_, _, err = c.Read(ctx)
+					if !errors.Is(err, websocket.ErrReadRateLimited) {
+						return fmt.Errorf("expected ErrReadRateLimited: %v", err)
+					}
+				}
+				// The close handshake must skip the rejected payload.
+				return c.Close(websocket.StatusPolicyViolation, "")
+			}()
+		}))
+		defer s.Close()
+
+		c, _, err := websocket.Dial(ctx, s.URL, nil)
+		assert.Success(t, err)
+		defer c.CloseNow()
+
+		for _, p := range []string{"a", "bb"} {
+			err = c.Write(ctx, websocket.MessageText, []byte(p))
+			assert.Success(t, err)
+		}
+		err = c.Close(websocket.StatusPolicyViolation, "")
+		assert.Success(t, err)
+
+		assert.Success(t, <-errs)
+	})
+
+	t.Run("zeroRate", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, &websocket.AcceptOptions{
+			ReadRateLimit: &websocket.RateLimit{Rate: 0, Burst: 1},
+		})
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		go func() {
+			for i := 0; i < 3; i++ {
+				c1.Write(ctx, websocket.MessageText, []byte("a"))
+			}
+		}()
+
+		for i := 0; i < 3; i++ {
+			_, _, err := c2.Read(ctx)
+			assert.Success(t, err)
+		}
+	})
+}
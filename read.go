@@ -5,6 +5,7 @@ package websocket
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -21,10 +22,18 @@ import (
 // Reader reads from the connection until there is a WebSocket
 // data message to be read. It will handle ping, pong and close frames as appropriate.
 //
+// A close frame from the peer is replied to with a close frame of the same status
+// code and reason, as is typical per RFC 6455 section 5.5.1, unless
+// ManualCloseHandshake is set. It is then returned as a CloseError.
+//
 // It returns the type of the message and an io.Reader to read it.
 // The passed context will also bound the reader.
 // Ensure you read to EOF otherwise the connection will hang.
 //
+// Reader returns as soon as the header of the first frame of a data message
+// has been read, before any of the payload is read. Thus the message type can be
+// used to decide how to decode the message before consuming the io.Reader.
+//
 // Call CloseRead if you do not expect any data messages from the peer.
 //
 // Only one Reader may be open at a time.
@@ -34,21 +43,244 @@ import (
 // See https://github.com/nhooyr/websocket/issues/87#issue-451703332
 // Most users should not need this.
 func (c *Conn) Reader(ctx context.Context) (MessageType, io.Reader, error) {
-	return c.reader(ctx)
+	return c.reader(ctx, readStream)
 }
 
 // Read is a convenience method around Reader to read a single message
 // from the connection.
 func (c *Conn) Read(ctx context.Context) (MessageType, []byte, error) {
-	typ, r, err := c.Reader(ctx)
+	typ, r, err := c.bufferedReader(ctx)
 	if err != nil {
 		return 0, nil, err
 	}
 
-	b, err := io.ReadAll(r)
+	b, err := c.readAll(r)
+	if err == nil {
+		c.observeHeartbeat(typ, b)
+	}
+	return typ, b, err
+}
+
+// maxPooledBufferSize is the capacity beyond which buffers
+// are not returned to the BufferPool.
+const maxPooledBufferSize = 1 << 20
+
+// readAll is io.ReadAll that reads into a buffer from c.bufferPool if set
+// and then copies the message out of it.
+func (c *Conn) readAll(r io.Reader) ([]byte, error) {
+	if c.bufferPool == nil {
+		return io.ReadAll(r)
+	}
+
+	buf, _ := c.bufferPool.Get().(*bytes.Buffer)
+	if buf == nil {
+		buf = &bytes.Buffer{}
+	}
+	defer func() {
+		if buf.Cap() <= maxPooledBufferSize {
+			buf.Reset()
+			c.bufferPool.Put(buf)
+		}
+	}()
+
+	_, err := buf.ReadFrom(r)
+	b := make([]byte, buf.Len())
+	copy(b, buf.Bytes())
+	return b, err
+}
+
+// MessageInfo describes how a message was received.
+type MessageInfo struct {
+	// Compressed is set if the message was compressed with permessage-deflate.
+	Compressed bool
+	// WireSize is the sum of the payload lengths of the frames of the message.
+	// For a compressed message, it is the compressed size.
+	WireSize int
+}
+
+// ReadWithInfo is Read that also returns the MessageInfo of the message.
+func (c *Conn) ReadWithInfo(ctx context.Context) (MessageType, []byte, MessageInfo, error) {
+	typ, r, err := c.bufferedReader(ctx)
+	if err != nil {
+		return 0, nil, MessageInfo{}, err
+	}
+
+	b, err := c.readAll(r)
+	if err != nil {
+		return typ, b, MessageInfo{}, err
+	}
+	c.observeHeartbeat(typ, b)
+	return typ, b, MessageInfo{
+		Compressed: c.msgReader.flate,
+		WireSize:   int(c.msgReader.wireSize),
+	}, nil
+}
+
+// TryRead reads a single message from the connection without blocking
+// if a complete message has not already been received.
+//
+// If no complete message has been received, or another Reader is in progress, it returns
+// with ok set to false without consuming any of the message.
+// Otherwise it reads the message as Read would and returns it with ok set to true.
+//
+// To check for received bytes, TryRead sets a read deadline of 1ms on the underlying
+// net.Conn and so it waits at most that long. Only connections from Accept expose
+// the net.Conn. With connections from Dial, only bytes already buffered by previous
+// reads are considered.
+//
+// A message larger than the read buffer can never be fully buffered. Once the read
+// buffer is full and holds the start of such a message, TryRead reads the message
+// as Read would, blocking until the rest of it arrives or ctx is done.
+//
+// Control frames received before the message are handled as usual.
+func (c *Conn) TryRead(ctx context.Context) (_ MessageType, _ []byte, ok bool, err error) {
+	if c.isClosed() {
+		return 0, nil, false, net.ErrClosed
+	}
+
+	if !c.readMu.tryLock() {
+		return 0, nil, false, nil
+	}
+	defer c.readMu.unlock()
+
+	if !c.msgReader.fin {
+		return 0, nil, false, nil
+	}
+	c.fillBuffer()
+	if !c.bufferedMessage() {
+		return 0, nil, false, nil
+	}
+
+	// The message is read with readMu held so that no other
+	// reader can take it between the check and the read.
+	typ, p, err := c.readLocked(ctx)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	return typ, p, true, nil
+}
+
+// readLocked is Read with readMu held.
+func (c *Conn) readLocked(ctx context.Context) (_ MessageType, _ []byte, err error) {
+	ctx, cancel := withDeadline(ctx, &c.readDeadline)
+	if cancel != nil {
+		defer func() {
+			if err != nil {
+				cancel()
+			}
+		}()
+	}
+
+	typ, r, err := c.nextReader(ctx, cancel, readBuffered)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get reader: %w", err)
+	}
+
+	if typ != MessagePing && typ != MessagePong {
+		r = readerFunc(c.msgReader.readLocked)
+	}
+	b, err := c.readAll(r)
+	if err == nil {
+		c.observeHeartbeat(typ, b)
+	}
 	return typ, b, err
 }
 
+// readerFunc implements io.Reader with a function.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// fillBuffer reads the bytes already received on the underlying connection into c.br
+// if the connection supports read deadlines.
+func (c *Conn) fillBuffer() {
+	conn, ok := c.rwc.(interface {
+		SetReadDeadline(time.Time) error
+	})
+	if !ok {
+		return
+	}
+
+	err := conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	if err != nil {
+		return
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	// Peek returns and clears the deadline error so the next read is unaffected.
+	for c.br.Buffered() < c.br.Size() {
+		_, err = c.br.Peek(c.br.Buffered() + 1)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// bufferedMessage reports whether reading the next message can complete
+// from the bytes buffered in c.br alone. That is if a complete data
+// message or a close frame is buffered.
+//
+// It also reports true if c.br is full but does not hold a complete
+// message as the message can then never be buffered in full.
+func (c *Conn) bufferedMessage() bool {
+	b, _ := c.br.Peek(c.br.Buffered())
+	full := len(b) == c.br.Size()
+	r := bytes.NewReader(b)
+	var readBuf [8]byte
+	for {
+		h, err := readFrameHeader(r, readBuf[:])
+		if err != nil {
+			return full
+		}
+		if int64(r.Len()) < h.payloadLength {
+			return full
+		}
+		r.Seek(h.payloadLength, io.SeekCurrent)
+
+		switch h.opcode {
+		case opPing, opPong:
+			continue
+		case opContinuation, opText, opBinary:
+			if !h.fin {
+				continue
+			}
+		}
+		// A close frame or an unknown opcode will also
+		// result in Read returning immediately.
+		return true
+	}
+}
+
+// Discard reads and discards the rest of the message of the current Reader
+// so that the next message can be read. It is a no-op if no message is being read.
+//
+// The rest of the message is read with ctx instead of the context passed to Reader.
+func (c *Conn) Discard(ctx context.Context) (err error) {
+	defer errd.Wrap(&err, "failed to discard message")
+
+	err = c.readMu.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.readMu.unlock()
+
+	mr := c.msgReader
+	if mr.fin && mr.payloadLength == 0 && len(mr.extPayload) == 0 && mr.flateReader == nil {
+		return nil
+	}
+
+	readerCtx := mr.ctx
+	mr.ctx = ctx
+	defer func() {
+		mr.ctx = readerCtx
+	}()
+
+	_, err = io.Copy(io.Discard, readerFunc(mr.readLocked))
+	return err
+}
+
 // CloseRead starts a goroutine to read from the connection until it is closed
 // or a data message is received.
 //
@@ -63,6 +295,21 @@ func (c *Conn) Read(ctx context.Context) (MessageType, []byte, error) {
 //
 // This function is idempotent.
 func (c *Conn) CloseRead(ctx context.Context) context.Context {
+	return c.closeRead(ctx, nil)
+}
+
+// CloseReadWithCallback is like CloseRead but calls onClose with the status code
+// and reason of the close frame received from the peer. That is either the
+// close frame of a peer initiated close or the peer's reply to Close.
+//
+// onClose is not called if the connection is closed without a close frame
+// from the peer. If CloseRead or CloseReadWithCallback has already been called,
+// onClose is ignored.
+func (c *Conn) CloseReadWithCallback(ctx context.Context, onClose func(StatusCode, string)) context.Context {
+	return c.closeRead(ctx, onClose)
+}
+
+func (c *Conn) closeRead(ctx context.Context, onClose func(StatusCode, string)) context.Context {
 	c.closeReadMu.Lock()
 	ctx2 := c.closeReadCtx
 	if ctx2 != nil {
@@ -81,30 +328,125 @@ func (c *Conn) CloseRead(ctx context.Context) context.Context {
 		_, _, err := c.Reader(ctx)
 		if err == nil {
 			c.Close(StatusPolicyViolation, "unexpected data message")
+			return
+		}
+		var ce CloseError
+		if onClose != nil && errors.As(err, &ce) {
+			onClose(ce.Code, ce.Reason)
 		}
 	}()
 	return ctx
 }
 
+// Drain reads and discards every data message, including the rest of the message
+// being read, until the close frame of the peer is received. It is for shutting
+// down a consumer so that the close handshake completes and the peer sees a clean
+// close instead of a reset connection.
+//
+// Unlike CloseRead, Drain blocks and the connection is closed once it returns.
+// The close frame of the peer is replied to as usual, with Close and the status code
+// and reason of the frame if ManualCloseHandshake is set, and Drain returns nil.
+// It also returns nil if the close frame is the peer's reply to Close or InitiateClose.
+//
+// If ctx expires first, the connection is closed and an error wrapping the ctx
+// error is returned.
+func (c *Conn) Drain(ctx context.Context) (err error) {
+	defer errd.Wrap(&err, "failed to drain")
+
+	err = c.Discard(ctx)
+	for err == nil {
+		var r io.Reader
+		_, r, err = c.Reader(ctx)
+		if err == nil {
+			_, err = io.Copy(io.Discard, r)
+		}
+	}
+
+	code, reason, ok := CloseReason(err)
+	if !ok {
+		return err
+	}
+	if c.manualClose {
+		err = c.Close(code, reason)
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrConcurrentReader is returned by Reader and Read when the previous message
+// has not been read to completion and, with the StrictConcurrency option, when
+// another goroutine is reading.
+var ErrConcurrentReader = errors.New("another message is being read")
+
 // SetReadLimit sets the max number of bytes to read for a single message.
-// It applies to the Reader and Read methods.
+// It applies to the Reader and Read methods unless SetStreamReadLimit has been
+// called in which case it only applies to Read and the other methods that read
+// the whole message into memory.
 //
-// By default, the connection has a message read limit of 32768 bytes.
+// By default, the connection has a message read limit of DefaultReadLimit bytes.
 //
 // When the limit is hit, the connection will be closed with StatusMessageTooBig.
 //
 // Set to -1 to disable.
+//
+// It is safe to call SetReadLimit concurrently with reads. The new limit takes
+// effect at the next message boundary and so does not apply to a message being
+// read. Use SetReadLimitNow to also limit it.
 func (c *Conn) SetReadLimit(n int64) {
+	c.msgReader.limitReader.limit.Store(readLimitValue(n))
+}
+
+// SetReadLimitNow is like SetReadLimit but the new limit also applies to the
+// message being read, if any, counting the bytes of it read so far. If they
+// already exceed the new limit, the next read of the message hits the limit.
+//
+// A message read with Reader while a limit is set with SetStreamReadLimit is
+// bound by the stream read limit and so is not affected.
+func (c *Conn) SetReadLimitNow(n int64) {
+	n = readLimitValue(n)
+	c.msgReader.limitReader.limit.Store(n)
+	c.msgReader.limitReader.limitNow.Store(n)
+}
+
+// readLimitValue returns the value stored for the read limit n.
+func readLimitValue(n int64) int64 {
 	if n >= 0 {
 		// We read one more byte than the limit in case
 		// there is a fin frame that needs to be read.
 		n++
 	}
+	return n
+}
 
-	c.msgReader.limitReader.limit.Store(n)
+// ReadLimit returns the read limit set with SetReadLimit.
+// It is -1 if the limit is disabled.
+func (c *Conn) ReadLimit() int64 {
+	n := c.msgReader.limitReader.limit.Load()
+	if n > 0 {
+		n--
+	}
+	return n
 }
 
-const defaultReadLimit = 32768
+// SetStreamReadLimit sets the max number of bytes to read for a single message
+// read with Reader, apart from the read limit of SetReadLimit that then only
+// applies to Read. Thus large messages can be processed incrementally with Reader
+// while Read, which buffers the whole message, stays bounded.
+//
+// By default, Reader uses the read limit.
+//
+// When the limit is hit, the connection will be closed with StatusMessageTooBig.
+//
+// Set to -1 to disable.
+func (c *Conn) SetStreamReadLimit(n int64) {
+	if n >= 0 {
+		n++
+	}
+
+	c.msgReader.limitReader.streamLimit.Store(n)
+}
 
 func newMsgReader(c *Conn) *msgReader {
 	mr := &msgReader{
@@ -113,7 +455,7 @@ func newMsgReader(c *Conn) *msgReader {
 	}
 	mr.readFunc = mr.read
 
-	mr.limitReader = newLimitReader(c, mr.readFunc, defaultReadLimit+1)
+	mr.limitReader = newLimitReader(c, mr.readFunc, DefaultReadLimit+1)
 	return mr
 }
 
@@ -121,8 +463,9 @@ func (mr *msgReader) resetFlate() {
 	if mr.flateContextTakeover() {
 		if mr.dict == nil {
 			mr.dict = &slidingWindow{}
+			mr.dict.init(32768)
+			mr.dict.write(mr.c.copts.dictionary)
 		}
-		mr.dict.init(32768)
 	}
 	if mr.flateBufio == nil {
 		mr.flateBufio = getBufioReader(mr.readFunc)
@@ -131,7 +474,7 @@ func (mr *msgReader) resetFlate() {
 	if mr.flateContextTakeover() {
 		mr.flateReader = getFlateReader(mr.flateBufio, mr.dict.buf)
 	} else {
-		mr.flateReader = getFlateReader(mr.flateBufio, nil)
+		mr.flateReader = getFlateReader(mr.flateBufio, mr.c.copts.dictionary)
 	}
 	mr.limitReader.r = mr.flateReader
 	mr.flateTail.Reset(deflateMessageTail)
@@ -146,6 +489,7 @@ func (mr *msgReader) putFlateReader() {
 
 func (mr *msgReader) close() {
 	mr.c.readMu.forceLock()
+	mr.cancelCtx()
 	mr.putFlateReader()
 	if mr.dict != nil {
 		mr.dict.close()
@@ -180,20 +524,23 @@ func (c *Conn) readRSV1Illegal(h header) bool {
 	return false
 }
 
-func (c *Conn) readLoop(ctx context.Context) (header, error) {
+// readLoop reads frames until a data frame and returns its header. Control frames
+// are handled in the loop. If stopAtControl is set, it also returns once a control
+// frame to be returned by Reader with DeliverControlFrames has been handled.
+func (c *Conn) readLoop(ctx context.Context, stopAtControl bool) (header, error) {
 	for {
 		h, err := c.readFrameHeader(ctx)
 		if err != nil {
 			return header{}, err
 		}
+		c.observeFrame(DirectionRead, h)
 
 		if h.rsv1 && c.readRSV1Illegal(h) || h.rsv2 || h.rsv3 {
 			err := fmt.Errorf("received header with unexpected rsv bits set: %v:%v:%v", h.rsv1, h.rsv2, h.rsv3)
-			c.writeError(StatusProtocolError, err)
-			return header{}, err
+			return header{}, c.protocolError(ReservedBitSet, err)
 		}
 
-		if !c.client && !h.masked {
+		if !c.client && !h.masked && !c.allowUnmasked {
 			return header{}, errors.New("received unmasked frame from client")
 		}
 
@@ -207,12 +554,14 @@ func (c *Conn) readLoop(ctx context.Context) (header, error) {
 				}
 				return header{}, fmt.Errorf("failed to handle control frame %v: %w", h.opcode, err)
 			}
+			if stopAtControl && len(c.controlEvents) > 0 {
+				return h, nil
+			}
 		case opContinuation, opText, opBinary:
 			return h, nil
 		default:
 			err := fmt.Errorf("received unknown opcode %v", h.opcode)
-			c.writeError(StatusProtocolError, err)
-			return header{}, err
+			return header{}, c.protocolError(InvalidOpcode, err)
 		}
 	}
 }
@@ -226,14 +575,7 @@ func (c *Conn) readFrameHeader(ctx context.Context) (header, error) {
 
 	h, err := readFrameHeader(c.br, c.readHeaderBuf[:])
 	if err != nil {
-		select {
-		case <-c.closed:
-			return header{}, net.ErrClosed
-		case <-ctx.Done():
-			return header{}, ctx.Err()
-		default:
-			return header{}, err
-		}
+		return header{}, c.ioErr(ctx, err)
 	}
 
 	select {
@@ -254,14 +596,7 @@ func (c *Conn) readFramePayload(ctx context.Context, p []byte) (int, error) {
 
 	n, err := io.ReadFull(c.br, p)
 	if err != nil {
-		select {
-		case <-c.closed:
-			return n, net.ErrClosed
-		case <-ctx.Done():
-			return n, ctx.Err()
-		default:
-			return n, fmt.Errorf("failed to read frame payload: %w", err)
-		}
+		return n, c.ioErr(ctx, fmt.Errorf("failed to read frame payload: %w", err))
 	}
 
 	select {
@@ -276,14 +611,12 @@ func (c *Conn) readFramePayload(ctx context.Context, p []byte) (int, error) {
 func (c *Conn) handleControl(ctx context.Context, h header) (err error) {
 	if h.payloadLength < 0 || h.payloadLength > maxControlPayload {
 		err := fmt.Errorf("received control frame payload with invalid length: %d", h.payloadLength)
-		c.writeError(StatusProtocolError, err)
-		return err
+		return c.protocolError(ControlFrameTooLong, err)
 	}
 
 	if !h.fin {
 		err := errors.New("received fragmented control frame")
-		c.writeError(StatusProtocolError, err)
-		return err
+		return c.protocolError(FragmentedControlFrame, err)
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
@@ -299,8 +632,15 @@ func (c *Conn) handleControl(ctx context.Context, h header) (err error) {
 		mask(b, h.maskKey)
 	}
 
+	if c.deliverControl && h.opcode != opClose {
+		c.queueControlEvent(h.opcode, b)
+	}
+
 	switch h.opcode {
 	case opPing:
+		if c.noAutoPong {
+			return nil
+		}
 		return c.writeControl(ctx, opPong, b)
 	case opPong:
 		c.activePingsMu.Lock()
@@ -311,6 +651,8 @@ func (c *Conn) handleControl(ctx context.Context, h header) (err error) {
 			case pong <- struct{}{}:
 			default:
 			}
+		} else {
+			c.debugf("discarded unsolicited pong %q", b)
 		}
 		return nil
 	}
@@ -320,42 +662,165 @@ func (c *Conn) handleControl(ctx context.Context, h header) (err error) {
 	ce, err := parseClosePayload(b)
 	if err != nil {
 		err = fmt.Errorf("received invalid close payload: %w", err)
-		c.writeError(StatusProtocolError, err)
-		return err
+		return c.protocolError(InvalidClosePayload, err)
 	}
 
+	c.stats.closeStatus.CompareAndSwap(0, int64(ce.Code))
 	err = fmt.Errorf("received close frame: %w", ce)
+	if c.manualClose {
+		// The application replies with Close.
+		c.closeRcvd.Store(true)
+		return err
+	}
 	c.writeClose(ce.Code, ce.Reason)
 	c.readMu.unlock()
 	c.close()
 	return err
 }
 
-func (c *Conn) reader(ctx context.Context) (_ MessageType, _ io.Reader, err error) {
+// maxControlEvents is the maximum number of control frames held
+// to be returned by Reader with DeliverControlFrames.
+const maxControlEvents = 16
+
+type controlEvent struct {
+	typ MessageType
+	p   []byte
+}
+
+// reader returns the event as the next message of Reader.
+func (ev controlEvent) reader(cancel context.CancelFunc) (MessageType, io.Reader, error) {
+	if cancel != nil {
+		cancel()
+	}
+	return ev.typ, bytes.NewReader(ev.p), nil
+}
+
+// queueControlEvent holds the ping or pong frame with payload p
+// to be returned by Reader. readMu must be held.
+func (c *Conn) queueControlEvent(opcode opcode, p []byte) {
+	if len(c.controlEvents) >= maxControlEvents {
+		c.debugf("dropped %v frame as %v are held already", opcode, maxControlEvents)
+		return
+	}
+	typ := MessagePing
+	if opcode == opPong {
+		typ = MessagePong
+	}
+	c.controlEvents = append(c.controlEvents, controlEvent{
+		typ: typ,
+		p:   append([]byte(nil), p...),
+	})
+}
+
+// nextControlEvent removes and returns the oldest held control frame.
+// readMu must be held.
+func (c *Conn) nextControlEvent() (controlEvent, bool) {
+	if len(c.controlEvents) == 0 {
+		return controlEvent{}, false
+	}
+	ev := c.controlEvents[0]
+	n := copy(c.controlEvents, c.controlEvents[1:])
+	c.controlEvents[n] = controlEvent{}
+	c.controlEvents = c.controlEvents[:n]
+	return ev, true
+}
+
+// readMode selects whether a message is bound by the read limit
+// or by the stream read limit.
+type readMode int
+
+const (
+	readBuffered readMode = iota
+	readStream
+	// readStreamBinary streams binary messages and buffers text messages.
+	readStreamBinary
+)
+
+func (c *Conn) reader(ctx context.Context, mode readMode) (_ MessageType, _ io.Reader, err error) {
 	defer errd.Wrap(&err, "failed to get reader")
 
-	err = c.readMu.lock(ctx)
-	if err != nil {
-		return 0, nil, err
+	ctx, cancel := withDeadline(ctx, &c.readDeadline)
+	if cancel != nil {
+		defer func() {
+			if err != nil {
+				cancel()
+			}
+		}()
+	}
+
+	if c.strictConcurrency {
+		if !c.readMu.tryLock() {
+			if c.isClosed() {
+				return 0, nil, net.ErrClosed
+			}
+			return 0, nil, ErrConcurrentReader
+		}
+	} else {
+		err = c.readMu.lock(ctx)
+		if err != nil {
+			return 0, nil, err
+		}
 	}
 	defer c.readMu.unlock()
 
+	return c.nextReader(ctx, cancel, mode)
+}
+
+// bufferedReader is Reader for messages that are read in full into memory
+// and so are bound by the read limit instead of the stream read limit.
+func (c *Conn) bufferedReader(ctx context.Context) (MessageType, io.Reader, error) {
+	return c.reader(ctx, readBuffered)
+}
+
+// streamBinaryReader is Reader for binary messages and bufferedReader
+// for text messages.
+func (c *Conn) streamBinaryReader(ctx context.Context) (MessageType, io.Reader, error) {
+	return c.reader(ctx, readStreamBinary)
+}
+
+// nextReader is reader with readMu held.
+func (c *Conn) nextReader(ctx context.Context, cancel context.CancelFunc, mode readMode) (MessageType, io.Reader, error) {
 	if !c.msgReader.fin {
-		return 0, nil, errors.New("previous message not read to completion")
+		return 0, nil, fmt.Errorf("previous message not read to completion: %w", ErrConcurrentReader)
+	}
+
+	if c.readLimiter != nil && c.readLimiter.tripped {
+		return 0, nil, ErrReadRateLimited
 	}
 
-	h, err := c.readLoop(ctx)
+	if ev, ok := c.nextControlEvent(); ok {
+		return ev.reader(cancel)
+	}
+
+	h, err := c.readLoop(ctx, c.deliverControl)
 	if err != nil {
 		return 0, nil, err
 	}
+	if h.opcode == opPing || h.opcode == opPong {
+		ev, _ := c.nextControlEvent()
+		return ev.reader(cancel)
+	}
 
 	if h.opcode == opContinuation {
 		err := errors.New("received continuation frame without text or binary frame")
-		c.writeError(StatusProtocolError, err)
-		return 0, nil, err
+		return 0, nil, c.protocolError(UnexpectedContinuation, err)
+	}
+	if c.rejectFragmented && !h.fin {
+		err := errors.New("received fragmented message")
+		return 0, nil, c.protocolError(FragmentedMessage, err)
+	}
+
+	// The frame is recorded before the rate limit is checked so that the
+	// close handshake skips its payload instead of parsing it as a header.
+	stream := mode == readStream || mode == readStreamBinary && h.opcode == opBinary
+	c.msgReader.reset(ctx, cancel, h, stream)
+
+	if c.readLimiter != nil && !c.readLimiter.allow() {
+		c.writeError(StatusPolicyViolation, ErrReadRateLimited)
+		return 0, nil, ErrReadRateLimited
 	}
 
-	c.msgReader.reset(ctx, h)
+	c.stats.messagesRead.Add(1)
 
 	return MessageType(h.opcode), c.msgReader, nil
 }
@@ -364,6 +829,7 @@ type msgReader struct {
 	c *Conn
 
 	ctx         context.Context
+	cancel      context.CancelFunc
 	flate       bool
 	flateReader io.Reader
 	flateBufio  *bufio.Reader
@@ -374,27 +840,56 @@ type msgReader struct {
 	fin           bool
 	payloadLength int64
 	maskKey       uint32
+	// wireSize is the sum of the payload lengths of the frames
+	// of the message read so far.
+	wireSize int64
+	// eof is set once the message has been read to completion.
+	eof bool
+
+	// extPayload is the rest of the untransformed payload of the current
+	// frame with custom extensions. extFrameRead is set once the payload of
+	// the current frame has been read and untransformed.
+	extPayload   []byte
+	extFrameRead bool
+	extBuf       []byte
 
 	// util.ReaderFunc(mr.Read) to avoid continuous allocations.
 	readFunc util.ReaderFunc
 }
 
-func (mr *msgReader) reset(ctx context.Context, h header) {
+func (mr *msgReader) reset(ctx context.Context, cancel context.CancelFunc, h header, stream bool) {
+	mr.cancelCtx()
 	mr.ctx = ctx
+	mr.cancel = cancel
 	mr.flate = h.rsv1
-	mr.limitReader.reset(mr.readFunc)
+	mr.limitReader.reset(mr.readFunc, stream)
 
 	if mr.flate {
 		mr.resetFlate()
 	}
 
+	mr.wireSize = 0
+	mr.eof = false
+	mr.extPayload = nil
 	mr.setFrame(h)
 }
 
+// cancelCtx releases the deadline context of the previous message if any.
+// It is deferred until the next message as the reader may still be read
+// after returning io.EOF.
+func (mr *msgReader) cancelCtx() {
+	if mr.cancel != nil {
+		mr.cancel()
+		mr.cancel = nil
+	}
+}
+
 func (mr *msgReader) setFrame(h header) {
+	mr.extFrameRead = false
 	mr.fin = h.fin
 	mr.payloadLength = h.payloadLength
 	mr.maskKey = h.maskKey
+	mr.wireSize += h.payloadLength
 }
 
 func (mr *msgReader) Read(p []byte) (n int, err error) {
@@ -404,13 +899,23 @@ func (mr *msgReader) Read(p []byte) (n int, err error) {
 	}
 	defer mr.c.readMu.unlock()
 
+	return mr.readLocked(p)
+}
+
+// readLocked is Read with readMu held.
+func (mr *msgReader) readLocked(p []byte) (n int, err error) {
 	n, err = mr.limitReader.Read(p)
+	mr.c.stats.bytesRead.Add(int64(n))
 	if mr.flate && mr.flateContextTakeover() {
 		p = p[:n]
 		mr.dict.write(p)
 	}
 	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) && mr.fin && mr.flate {
 		mr.putFlateReader()
+		if !mr.eof {
+			mr.eof = true
+			mr.pongOnData()
+		}
 		return n, io.EOF
 	}
 	if err != nil {
@@ -419,7 +924,24 @@ func (mr *msgReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+// pongOnData writes the pong of the PongOnData option
+// for the message that has been read to completion.
+func (mr *msgReader) pongOnData() {
+	if !mr.c.pongOnData {
+		return
+	}
+	err := mr.c.writeControl(mr.ctx, opPong, nil)
+	if err != nil {
+		// The message has been read and so is still returned.
+		mr.c.debugf("failed to write pong on data: %v", err)
+	}
+}
+
 func (mr *msgReader) read(p []byte) (int, error) {
+	if len(mr.c.exts) > 0 {
+		return mr.readUntransformed(p)
+	}
+
 	for {
 		if mr.payloadLength == 0 {
 			if mr.fin {
@@ -429,14 +951,13 @@ func (mr *msgReader) read(p []byte) (int, error) {
 				return 0, io.EOF
 			}
 
-			h, err := mr.c.readLoop(mr.ctx)
+			h, err := mr.c.readLoop(mr.ctx, false)
 			if err != nil {
 				return 0, err
 			}
 			if h.opcode != opContinuation {
 				err := errors.New("received new data message without finishing the previous message")
-				mr.c.writeError(StatusProtocolError, err)
-				return 0, err
+				return 0, mr.c.protocolError(UnfinishedMessage, err)
 			}
 			mr.setFrame(h)
 
@@ -462,11 +983,93 @@ func (mr *msgReader) read(p []byte) (int, error) {
 	}
 }
 
+// readUntransformed is read for connections with custom extensions.
+// The payload of each frame is read in full and untransformed first.
+func (mr *msgReader) readUntransformed(p []byte) (int, error) {
+	for {
+		if len(mr.extPayload) > 0 {
+			n := copy(p, mr.extPayload)
+			mr.extPayload = mr.extPayload[n:]
+			return n, nil
+		}
+
+		if !mr.extFrameRead {
+			err := mr.readExtFrame()
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		if mr.fin {
+			if mr.flate {
+				return mr.flateTail.Read(p)
+			}
+			return 0, io.EOF
+		}
+
+		h, err := mr.c.readLoop(mr.ctx, false)
+		if err != nil {
+			return 0, err
+		}
+		if h.opcode != opContinuation {
+			err := errors.New("received new data message without finishing the previous message")
+			return 0, mr.c.protocolError(UnfinishedMessage, err)
+		}
+		mr.setFrame(h)
+	}
+}
+
+// readExtFrame reads the payload of the current frame into mr.extPayload
+// and untransforms it.
+func (mr *msgReader) readExtFrame() error {
+	max := mr.limitReader.max
+	if max >= 0 && mr.payloadLength > max {
+		err := fmt.Errorf("read limited at %v bytes", max)
+		mr.c.writeError(StatusMessageTooBig, err)
+		return err
+	}
+
+	if int64(cap(mr.extBuf)) < mr.payloadLength {
+		mr.extBuf = make([]byte, mr.payloadLength)
+	}
+	b := mr.extBuf[:mr.payloadLength]
+	n, err := mr.c.readFramePayload(mr.ctx, b)
+	mr.payloadLength -= int64(n)
+	if err != nil {
+		return err
+	}
+	if !mr.c.client {
+		mr.maskKey = mask(b, mr.maskKey)
+	}
+
+	b, err = mr.c.untransform(b)
+	if err != nil {
+		mr.c.writeError(StatusProtocolError, err)
+		return err
+	}
+	mr.extPayload = b
+	mr.extFrameRead = true
+	return nil
+}
+
 type limitReader struct {
 	c     *Conn
 	r     io.Reader
 	limit atomic.Int64
-	n     int64
+	// streamLimit is the limit for messages read with Reader.
+	// It is 0 until set with SetStreamReadLimit and limit applies.
+	streamLimit atomic.Int64
+	// limitNow is the limit set with SetReadLimitNow to apply to the
+	// current message on its next read. It is 0 if there is none.
+	limitNow atomic.Int64
+	// max is the limit of the current message.
+	max int64
+	n   int64
+	// read is the number of bytes of the current message read so far.
+	read int64
+	// stream is set if the current message is bound by streamLimit.
+	stream bool
 }
 
 func newLimitReader(c *Conn, r io.Reader, limit int64) *limitReader {
@@ -474,22 +1077,54 @@ func newLimitReader(c *Conn, r io.Reader, limit int64) *limitReader {
 		c: c,
 	}
 	lr.limit.Store(limit)
-	lr.reset(r)
+	lr.reset(r, false)
 	return lr
 }
 
-func (lr *limitReader) reset(r io.Reader) {
-	lr.n = lr.limit.Load()
+func (lr *limitReader) reset(r io.Reader, stream bool) {
+	// The limit loaded below includes any set with SetReadLimitNow.
+	lr.limitNow.Store(0)
+	lr.max = lr.limit.Load()
+	lr.stream = false
+	if stream {
+		if n := lr.streamLimit.Load(); n != 0 {
+			lr.max = n
+			lr.stream = true
+		}
+	}
+	lr.n = lr.max
+	lr.read = 0
 	lr.r = r
 }
 
+// applyLimitNow applies the limit set with SetReadLimitNow, if any,
+// to the current message.
+func (lr *limitReader) applyLimitNow() {
+	max := lr.limitNow.Swap(0)
+	if max == 0 || lr.stream {
+		return
+	}
+	lr.max = max
+	lr.n = -1
+	if max >= 0 {
+		lr.n = max - lr.read
+		if lr.n < 0 {
+			lr.n = 0
+		}
+	}
+}
+
 func (lr *limitReader) Read(p []byte) (int, error) {
+	lr.applyLimitNow()
+
 	if lr.n < 0 {
-		return lr.r.Read(p)
+		n, err := lr.r.Read(p)
+		lr.read += int64(n)
+		return n, err
 	}
 
 	if lr.n == 0 {
-		err := fmt.Errorf("read limited at %v bytes", lr.limit.Load())
+		err := fmt.Errorf("read limited at %v bytes", lr.max)
 		lr.c.writeError(StatusMessageTooBig, err)
 		return 0, err
 	}
@@ -499,6 +1134,7 @@ func (lr *limitReader) Read(p []byte) (int, error) {
 	}
 	n, err := lr.r.Read(p)
 	lr.n -= int64(n)
+	lr.read += int64(n)
 	if lr.n < 0 {
 		lr.n = 0
 	}
@@ -0,0 +1,1034 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+	"github.com/oarkflow/websocket/internal/test/xrand"
+)
+
+func TestTryRead(t *testing.T) {
+	t.Parallel()
+
+	for _, n := range []int{5, 8192} {
+		n := n
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			c1, c2 := wstest.Pipe(nil, nil)
+			defer c1.CloseNow()
+			defer c2.CloseNow()
+			c2.SetReadLimit(-1)
+
+			// Only connections from Accept expose the net.Conn to TryRead.
+			_, _, ok, err := c2.TryRead(ctx)
+			assert.Success(t, err)
+			assert.Equal(t, "ok", false, ok)
+
+			msg := strings.Repeat("x", n)
+			errs := make(chan error, 1)
+			go func() {
+				errs <- c1.Write(ctx, websocket.MessageText, []byte(msg))
+			}()
+
+			for {
+				typ, b, ok, err := c2.TryRead(ctx)
+				assert.Success(t, err)
+				if !ok {
+					select {
+					case <-ctx.Done():
+						t.Fatal("message was never reported")
+					case <-time.After(time.Millisecond):
+					}
+					continue
+				}
+				assert.Equal(t, "type", websocket.MessageText, typ)
+				assert.Equal(t, "msg", msg, string(b))
+				break
+			}
+			assert.Success(t, <-errs)
+
+			_, _, ok, err = c2.TryRead(ctx)
+			assert.Success(t, err)
+			assert.Equal(t, "ok", false, ok)
+		})
+	}
+}
+
+func TestCloseReadWithCallback(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	type closeFrame struct {
+		code   websocket.StatusCode
+		reason string
+	}
+	frames := make(chan closeFrame, 1)
+	c2.CloseReadWithCallback(ctx, func(code websocket.StatusCode, reason string) {
+		frames <- closeFrame{code, reason}
+	})
+
+	err := c1.Close(websocket.StatusGoingAway, "bye")
+	assert.Success(t, err)
+
+	select {
+	case f := <-frames:
+		assert.Equal(t, "close frame", closeFrame{websocket.StatusGoingAway, "bye"}, f)
+	case <-ctx.Done():
+		t.Fatal("onClose was not called")
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	t.Parallel()
+
+	modes := map[string]websocket.CompressionMode{
+		"disabled":        websocket.CompressionDisabled,
+		"contextTakeover": websocket.CompressionContextTakeover,
+	}
+	for name, mode := range modes {
+		mode := mode
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			c1, c2 := wstest.Pipe(&websocket.DialOptions{
+				CompressionMode: mode,
+			}, &websocket.AcceptOptions{
+				CompressionMode: mode,
+			})
+			defer c1.CloseNow()
+			defer c2.CloseNow()
+
+			// No message is being read.
+			err := c2.Discard(ctx)
+			assert.Success(t, err)
+
+			msg := strings.Repeat("hello ", 1000)
+			errs := make(chan error, 1)
+			go func() {
+				err := c1.Write(ctx, websocket.MessageText, []byte(msg))
+				if err == nil {
+					err = c1.Write(ctx, websocket.MessageText, []byte(msg+"next"))
+				}
+				errs <- err
+			}()
+
+			_, r, err := c2.Reader(ctx)
+			assert.Success(t, err)
+			p := make([]byte, 5)
+			_, err = io.ReadFull(r, p)
+			assert.Success(t, err)
+			assert.Equal(t, "peek", "hello", string(p))
+
+			err = c2.Discard(ctx)
+			assert.Success(t, err)
+
+			_, b, err := c2.Read(ctx)
+			assert.Success(t, err)
+			assert.Equal(t, "next msg", msg+"next", string(b))
+			assert.Success(t, <-errs)
+		})
+	}
+}
+
+func TestStreamReadLimit(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	msg := make([]byte, 1<<20)
+
+	// A real TCP connection is used so that the rejected message
+	// can be written in full while the server stops reading it.
+	errs := make(chan error, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer c.CloseNow()
+		c.SetStreamReadLimit(-1)
+
+		errs <- func() error {
+			// Larger than the default read limit but streamed.
+			_, r, err := c.Reader(ctx)
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(io.Discard, r)
+			if err != nil {
+				return err
+			}
+			if n != int64(len(msg)) {
+				return fmt.Errorf("streamed %v bytes", n)
+			}
+
+			// The same message is rejected by Read.
+			_, _, err = c.Read(ctx)
+			if err == nil || !strings.Contains(err.Error(), "read limited at 32769 bytes") {
+				return fmt.Errorf("expected the read limit to be hit: %v", err)
+			}
+			return nil
+		}()
+	}))
+	defer s.Close()
+
+	c, _, err := websocket.Dial(ctx, s.URL, nil)
+	assert.Success(t, err)
+	defer c.CloseNow()
+
+	err = c.Write(ctx, websocket.MessageBinary, msg)
+	assert.Success(t, err)
+	// The server may close the connection once the read limit is hit before the
+	// second message is written in full and so its write may fail.
+	go c.Write(ctx, websocket.MessageBinary, msg)
+	assert.Success(t, <-errs)
+}
+
+func TestReadWithInfo(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(&websocket.DialOptions{
+		CompressionMode:      websocket.CompressionContextTakeover,
+		CompressionThreshold: 128,
+	}, &websocket.AcceptOptions{
+		CompressionMode: websocket.CompressionContextTakeover,
+	})
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	compressible := strings.Repeat("compressible ", 100)
+	go c1.Write(ctx, websocket.MessageText, []byte(compressible))
+	_, p, info, err := c2.ReadWithInfo(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "message", compressible, string(p))
+	assert.Equal(t, "compressed", true, info.Compressed)
+	if info.WireSize == 0 || info.WireSize >= len(compressible) {
+		t.Fatalf("expected a wire size below %v: %v", len(compressible), info.WireSize)
+	}
+
+	// Below the threshold and so not compressed.
+	go c1.Write(ctx, websocket.MessageText, []byte("small"))
+	_, p, info, err = c2.ReadWithInfo(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "message", "small", string(p))
+	assert.Equal(t, "info", websocket.MessageInfo{Compressed: false, WireSize: len("small")}, info)
+}
+
+func TestReadBufferPool(t *testing.T) {
+	// Not parallel as AllocsPerRun counts the allocations of every goroutine.
+
+	msg := []byte(strings.Repeat("x", 16<<10))
+
+	// allocsPerRead returns the average number of allocations
+	// for reading msg with Read.
+	allocsPerRead := func(t *testing.T, pool *sync.Pool) float64 {
+		c1, c2 := wstest.Pipe(nil, &websocket.AcceptOptions{
+			BufferPool: pool,
+		})
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		writes := make(chan struct{})
+		defer close(writes)
+		go func() {
+			for range writes {
+				c1.Write(ctx, websocket.MessageBinary, msg)
+			}
+		}()
+
+		return testing.AllocsPerRun(20, func() {
+			writes <- struct{}{}
+			_, p, err := c2.Read(ctx)
+			assert.Success(t, err)
+			assert.Equal(t, "message length", len(msg), len(p))
+		})
+	}
+
+	without := allocsPerRead(t, nil)
+	with := allocsPerRead(t, &sync.Pool{})
+	if with >= without {
+		t.Fatalf("expected the pool to reduce allocations per message: %v >= %v", with, without)
+	}
+	t.Logf("allocations per message: %v without a pool and %v with a pool", without, with)
+}
+
+func TestReadLimitAccessor(t *testing.T) {
+	t.Parallel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	assert.Equal(t, "default read limit", int64(websocket.DefaultReadLimit), c1.ReadLimit())
+
+	c1.SetReadLimit(4 * websocket.DefaultReadLimit)
+	assert.Equal(t, "read limit", int64(4*websocket.DefaultReadLimit), c1.ReadLimit())
+
+	c1.SetReadLimit(0)
+	assert.Equal(t, "zero read limit", int64(0), c1.ReadLimit())
+
+	c1.SetReadLimit(-1)
+	assert.Equal(t, "disabled read limit", int64(-1), c1.ReadLimit())
+}
+
+func TestDeliverControlFrames(t *testing.T) {
+	t.Parallel()
+
+	t.Run("autoPong", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, &websocket.AcceptOptions{
+			DeliverControlFrames: true,
+		})
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+		c1.CloseRead(ctx)
+
+		errs := make(chan error, 1)
+		go func() {
+			err := c1.WriteControl(ctx, websocket.ControlPing, []byte("liveness token"))
+			if err != nil {
+				errs <- err
+				return
+			}
+			errs <- c1.Write(ctx, websocket.MessageText, []byte("hello"))
+		}()
+
+		typ, p, err := c2.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "message type", websocket.MessagePing, typ)
+		assert.Equal(t, "ping payload", "liveness token", string(p))
+
+		typ, p, err = c2.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "message type", websocket.MessageText, typ)
+		assert.Equal(t, "message", "hello", string(p))
+		assert.Success(t, <-errs)
+
+		// The ping is still replied to.
+		go func() {
+			errs <- c1.Ping(ctx)
+		}()
+		typ, _, err = c2.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "message type", websocket.MessagePing, typ)
+		assert.Success(t, <-errs)
+	})
+
+	t.Run("disableAutoPong", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, &websocket.AcceptOptions{
+			DeliverControlFrames: true,
+			DisableAutoPong:      true,
+		})
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+		c1.CloseRead(ctx)
+
+		pingCtx, pingCancel := context.WithTimeout(ctx, time.Millisecond*100)
+		defer pingCancel()
+		errs := make(chan error, 1)
+		go func() {
+			errs <- c1.Ping(pingCtx)
+		}()
+
+		typ, p, err := c2.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "message type", websocket.MessagePing, typ)
+		assert.Equal(t, "ping payload", "1", string(p))
+		assert.ErrorIs(t, context.DeadlineExceeded, <-errs)
+	})
+}
+
+func TestReadStrictConcurrency(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(&websocket.DialOptions{
+		StrictConcurrency: true,
+	}, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	// Whichever Read loses the race fails at once while
+	// the other waits for the message.
+	type result struct {
+		p   []byte
+		err error
+	}
+	results := make(chan result, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, p, err := c1.Read(ctx)
+			results <- result{p, err}
+		}()
+	}
+
+	res := <-results
+	assert.ErrorIs(t, websocket.ErrConcurrentReader, res.err)
+
+	err := c2.Write(ctx, websocket.MessageText, []byte("hello world"))
+	assert.Success(t, err)
+	res = <-results
+	assert.Success(t, res.err)
+	assert.Equal(t, "message", "hello world", string(res.p))
+}
+
+func TestReadToSink(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	ring := websocket.NewRingBuffer(256)
+	type result struct {
+		n   int64
+		err error
+	}
+	results := make(chan result, 1)
+	go func() {
+		n, err := c1.ReadToSink(ctx, ring)
+		results <- result{n, err}
+	}()
+
+	var sent []byte
+	for i := 0; i < 10; i++ {
+		p := bytes.Repeat([]byte{byte('a' + i)}, 100)
+		sent = append(sent, p...)
+		err := c2.Write(ctx, websocket.MessageBinary, p)
+		assert.Success(t, err)
+	}
+	err := c2.Close(websocket.StatusNormalClosure, "")
+	assert.Success(t, err)
+
+	res := <-results
+	assert.Success(t, res.err)
+	assert.Equal(t, "bytes written", int64(len(sent)), res.n)
+
+	assert.Equal(t, "unread", 256, ring.Len())
+	assert.Equal(t, "overwritten", int64(len(sent)-256), ring.Overwritten())
+	b, err := io.ReadAll(ring)
+	assert.Success(t, err)
+	assert.Equal(t, "latest data", string(sent[len(sent)-256:]), string(b))
+}
+
+func TestReadInto(t *testing.T) {
+	t.Parallel()
+
+	t.Run("multiMB", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		// Far beyond the default read limit which only bounds Read.
+		msg := xrand.Bytes(4 << 20)
+		c1.SetStreamReadLimit(8 << 20)
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- c2.Write(ctx, websocket.MessageBinary, msg)
+		}()
+
+		var b bytes.Buffer
+		typ, n, err := c1.ReadInto(ctx, &b)
+		assert.Success(t, err)
+		assert.Success(t, <-errs)
+		assert.Equal(t, "type", websocket.MessageBinary, typ)
+		assert.Equal(t, "bytes copied", int64(len(msg)), n)
+		if !bytes.Equal(msg, b.Bytes()) {
+			t.Fatal("unexpected message contents")
+		}
+	})
+
+	t.Run("streamReadLimit", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		c1.SetStreamReadLimit(1 << 20)
+		go c2.Write(ctx, websocket.MessageBinary, xrand.Bytes(2<<20))
+		go c2.CloseRead(ctx)
+
+		_, _, err := c1.ReadInto(ctx, io.Discard)
+		assert.Contains(t, err, "read limited at 1048577 bytes")
+	})
+}
+
+func TestReadAppend(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	const n = 100
+	errs := make(chan error, 1)
+	go func() {
+		for i := 0; i < n; i++ {
+			err := c2.Write(ctx, websocket.MessageText, []byte(strings.Repeat(strconv.Itoa(i%10), 1+i%512)))
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+		errs <- nil
+	}()
+
+	// The buffer grows to the largest message once and is then reused.
+	buf := make([]byte, 3, 1024)
+	copy(buf, "pre")
+	typ, buf, err := c1.ReadAppend(ctx, buf)
+	assert.Success(t, err)
+	assert.Equal(t, "type", websocket.MessageText, typ)
+	assert.Equal(t, "appended", "pre0", string(buf))
+
+	base := &buf[:cap(buf)][0]
+	for i := 1; i < n; i++ {
+		_, buf, err = c1.ReadAppend(ctx, buf[:0])
+		assert.Success(t, err)
+		assert.Equal(t, "message", strings.Repeat(strconv.Itoa(i%10), 1+i%512), string(buf))
+		if &buf[:cap(buf)][0] != base {
+			t.Fatalf("message %v did not reuse the buffer", i)
+		}
+	}
+	assert.Success(t, <-errs)
+	assert.Equal(t, "capacity", 1024, cap(buf))
+}
+
+func TestReadAppendAllocs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+	c2.CloseRead(ctx)
+
+	msg := []byte(strings.Repeat("x", 512))
+	go func() {
+		for {
+			err := c2.Write(ctx, websocket.MessageBinary, msg)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, 0, len(msg))
+	allocs := testing.AllocsPerRun(100, func() {
+		var err error
+		_, buf, err = c1.ReadAppend(ctx, buf[:0])
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > 0 {
+		t.Fatalf("expected no allocations per message with a reused buffer but got %v", allocs)
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	t.Parallel()
+
+	rb := websocket.NewRingBuffer(4)
+	b := make([]byte, 4)
+
+	rb.Write([]byte("ab"))
+	n, err := rb.Read(b[:1])
+	assert.Success(t, err)
+	assert.Equal(t, "read", "a", string(b[:n]))
+
+	// Wraps around the end of the buffer.
+	rb.Write([]byte("cde"))
+	n, err = rb.Read(b)
+	assert.Success(t, err)
+	assert.Equal(t, "read", "bcde", string(b[:n]))
+	assert.Equal(t, "overwritten", int64(0), rb.Overwritten())
+
+	_, err = rb.Read(b)
+	assert.ErrorIs(t, io.EOF, err)
+
+	rb.Write([]byte("fg"))
+	rb.Write([]byte("hijkl"))
+	n, err = rb.Read(b)
+	assert.Success(t, err)
+	assert.Equal(t, "read", "ijkl", string(b[:n]))
+	assert.Equal(t, "overwritten", int64(3), rb.Overwritten())
+}
+
+func TestSetReadLimitMidMessage(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	// Answers the close handshake started by the limit.
+	c2.CloseRead(ctx)
+
+	msgs := [][]byte{
+		bytes.Repeat([]byte("a"), 16),
+		bytes.Repeat([]byte("b"), 64),
+		bytes.Repeat([]byte("c"), 64),
+		bytes.Repeat([]byte("d"), 8),
+		bytes.Repeat([]byte("e"), 64),
+	}
+	go func() {
+		for _, p := range msgs {
+			err := c2.Write(ctx, websocket.MessageBinary, p)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// readHalf reads the first half of the next message and returns the rest of it.
+	readHalf := func(exp []byte) io.Reader {
+		_, r, err := c1.Reader(ctx)
+		assert.Success(t, err)
+		b := make([]byte, len(exp)/2)
+		_, err = io.ReadFull(r, b)
+		assert.Success(t, err)
+		assert.Equal(t, "first half", string(exp[:len(b)]), string(b))
+		return r
+	}
+
+	c1.SetReadLimit(16)
+	r := readHalf(msgs[0])
+	// Raising the limit applies from the next message.
+	c1.SetReadLimit(64)
+	b, err := io.ReadAll(r)
+	assert.Success(t, err)
+	assert.Equal(t, "second half", string(msgs[0][8:]), string(b))
+
+	_, b, err = c1.Read(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "message under the raised limit", string(msgs[1]), string(b))
+
+	// Lowering the limit does not cut the current message short.
+	r = readHalf(msgs[2])
+	c1.SetReadLimit(4)
+	b, err = io.ReadAll(r)
+	assert.Success(t, err)
+	assert.Equal(t, "second half", string(msgs[2][32:]), string(b))
+
+	c1.SetReadLimit(8)
+	_, b, err = c1.Read(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "message under the limit", string(msgs[3]), string(b))
+
+	// SetReadLimitNow caps the current message.
+	c1.SetReadLimit(64)
+	r = readHalf(msgs[4])
+	c1.SetReadLimitNow(48)
+	b, err = io.ReadAll(r)
+	assert.Contains(t, err, "read limited at 49 bytes")
+	assert.Equal(t, "bytes read up to the limit", 49-32, len(b))
+	assert.Equal(t, "read limit", int64(48), c1.ReadLimit())
+}
+
+func TestPongOnData(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	pongs := make(chan int, 16)
+	c1, c2 := wstest.Pipe(&websocket.DialOptions{
+		PongOnData: true,
+	}, &websocket.AcceptOptions{
+		FrameHook: func(dir websocket.Direction, op websocket.Opcode, fin, rsv1 bool, length int) {
+			if dir == websocket.DirectionRead && op == websocket.OpPong {
+				pongs <- length
+			}
+		},
+	})
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	// Reads the pongs.
+	c2.CloseRead(ctx)
+
+	for i := 0; i < 3; i++ {
+		go c2.Write(ctx, websocket.MessageText, []byte("hello"))
+		_, p, err := c1.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "message", "hello", string(p))
+
+		select {
+		case n := <-pongs:
+			assert.Equal(t, "pong length", 0, n)
+		case <-ctx.Done():
+			t.Fatal("no pong after message")
+		}
+	}
+
+	// Pings are still answered.
+	go c1.Read(ctx)
+	err := c2.Ping(ctx)
+	assert.Success(t, err)
+	select {
+	case n := <-pongs:
+		if n == 0 {
+			t.Fatal("expected the pong to echo the ping payload")
+		}
+	default:
+		t.Fatal("no pong after ping")
+	}
+}
+
+func TestSequenceChecker(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// Records the tagged messages of a SequenceChecker.
+	c1, c2, rec := wstest.RecordingPipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	writer := wstest.NewSequenceChecker(c1)
+	reader := wstest.NewSequenceChecker(c2)
+	for i := 0; i < 4; i++ {
+		go writer.Write(ctx, websocket.MessageText, []byte(strconv.Itoa(i)))
+		_, p, err := reader.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "message", strconv.Itoa(i), string(p))
+	}
+
+	frames := rec.ClientFrames()
+	assert.Equal(t, "frames", 4, len(frames))
+
+	// Replays the recorded messages out of order.
+	c3, c4 := wstest.Pipe(nil, nil)
+	defer c3.CloseNow()
+	defer c4.CloseNow()
+	go func() {
+		for _, i := range []int{0, 2, 1, 3} {
+			err := c3.Write(ctx, websocket.MessageText, frames[i].Payload)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	checker := wstest.NewSequenceChecker(c4)
+	_, p, err := checker.Read(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "message", "0", string(p))
+
+	_, p, err = checker.Read(ctx)
+	var seqErr *wstest.SequenceError
+	if !errors.As(err, &seqErr) {
+		t.Fatalf("expected a sequence error for the gap: %v", err)
+	}
+	assert.Equal(t, "gap", wstest.SequenceError{Expected: 1, Got: 2}, *seqErr)
+	assert.Equal(t, "message after the gap", "2", string(p))
+
+	_, p, err = checker.Read(ctx)
+	if !errors.As(err, &seqErr) {
+		t.Fatalf("expected a sequence error for the late message: %v", err)
+	}
+	assert.Equal(t, "late message", wstest.SequenceError{Expected: 3, Got: 1}, *seqErr)
+	assert.Contains(t, err, "out of order")
+	assert.Equal(t, "late message", "1", string(p))
+
+	_, p, err = checker.Read(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "message", "3", string(p))
+}
+
+func TestRejectFragmentedMessages(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, &websocket.AcceptOptions{
+		RejectFragmentedMessages: true,
+	})
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	type readResult struct {
+		p   []byte
+		err error
+	}
+	reads := make(chan readResult, 2)
+	go func() {
+		for {
+			_, p, err := c2.Read(ctx)
+			reads <- readResult{p, err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Handles the pongs and the close frame of the server.
+	clientErr := make(chan error, 1)
+	go func() {
+		_, _, err := c1.Read(ctx)
+		clientErr <- err
+	}()
+
+	// Control frames and messages in a single frame are allowed.
+	err := c1.Ping(ctx)
+	assert.Success(t, err)
+	err = c1.Write(ctx, websocket.MessageText, []byte("single frame"))
+	assert.Success(t, err)
+	r := <-reads
+	assert.Success(t, r.err)
+	assert.Equal(t, "message", "single frame", string(r.p))
+
+	// A message in two frames.
+	go func() {
+		w, err := c1.Writer(ctx, websocket.MessageText)
+		if err != nil {
+			return
+		}
+		w.Write([]byte("first "))
+		w.(interface{ Flush() error }).Flush()
+		w.Write([]byte("second"))
+		w.Close()
+	}()
+
+	r = <-reads
+	var pe websocket.ProtocolError
+	if !errors.As(r.err, &pe) {
+		t.Fatalf("expected a ProtocolError but got %v", r.err)
+	}
+	assert.Equal(t, "reason", websocket.FragmentedMessage, pe.Reason)
+
+	// The server has stopped reading and so the rest of the message
+	// and the reply to the close frame are not read over the net.Pipe.
+	c2.CloseNow()
+	err = <-clientErr
+	assert.Equal(t, "client close status", websocket.StatusProtocolError, websocket.CloseStatus(err))
+}
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+
+	t.Run("peerClose", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		closed := make(chan error, 1)
+		go func() {
+			for i := 0; i < 3; i++ {
+				err := c1.Write(ctx, websocket.MessageText, []byte(strconv.Itoa(i)))
+				if err != nil {
+					closed <- err
+					return
+				}
+			}
+			closed <- c1.Close(websocket.StatusNormalClosure, "done")
+		}()
+
+		// Stops in the middle of the first message.
+		_, r, err := c2.Reader(ctx)
+		assert.Success(t, err)
+		_, err = r.Read(make([]byte, 0))
+		assert.Success(t, err)
+
+		err = c2.Drain(ctx)
+		assert.Success(t, err)
+		// The peer's close handshake completed cleanly.
+		assert.Success(t, <-closed)
+
+		select {
+		case <-c2.Closed():
+		default:
+			t.Fatal("expected connection to be closed after Drain")
+		}
+		assert.Equal(t, "close status", websocket.StatusNormalClosure, c2.Stats().CloseStatus)
+	})
+
+	t.Run("manualCloseHandshake", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, &websocket.AcceptOptions{
+			ManualCloseHandshake: true,
+		})
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		closed := make(chan error, 1)
+		go func() {
+			c1.Write(ctx, websocket.MessageBinary, []byte("ignored"))
+			closed <- c1.Close(websocket.StatusGoingAway, "bye")
+		}()
+
+		err := c2.Drain(ctx)
+		assert.Success(t, err)
+		assert.Success(t, <-closed)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		// The peer never closes.
+		err := c2.Drain(ctx)
+		assert.ErrorIs(t, context.DeadlineExceeded, err)
+		select {
+		case <-c2.Closed():
+		case <-time.After(time.Second):
+			t.Fatal("expected connection to be closed after Drain")
+		}
+	})
+}
+
+func TestReadChan(t *testing.T) {
+	t.Parallel()
+
+	t.Run("close", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- func() error {
+				for i := 0; i < 3; i++ {
+					err := c1.Write(ctx, websocket.MessageText, []byte(strconv.Itoa(i)))
+					if err != nil {
+						return err
+					}
+				}
+				return c1.Close(websocket.StatusNormalClosure, "bye")
+			}()
+		}()
+
+		msgs, readErrs := c2.ReadChan(ctx)
+		var i int
+		for msg := range msgs {
+			assert.Equal(t, "type", websocket.MessageText, msg.Type)
+			assert.Equal(t, "data", strconv.Itoa(i), string(msg.Data))
+			i++
+		}
+		assert.Equal(t, "messages", 3, i)
+
+		err := <-readErrs
+		assert.Equal(t, "close status", websocket.StatusNormalClosure, websocket.CloseStatus(err))
+		_, ok := <-readErrs
+		assert.Equal(t, "error channel open", false, ok)
+		assert.Success(t, <-errs)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		readCtx, readCancel := context.WithCancel(ctx)
+		msgs, readErrs := c2.ReadChan(readCtx)
+
+		// The message may be read or not when ReadChan is cancelled
+		// but it is never received.
+		go c1.Write(ctx, websocket.MessageText, []byte("pending"))
+		readCancel()
+
+		// Cancelling ctx closes the connection and so the read may fail with either.
+		err := <-readErrs
+		if !errors.Is(err, context.Canceled) && !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("expected the read to be cancelled: %v", err)
+		}
+		_, ok := <-msgs
+		assert.Equal(t, "message channel open", false, ok)
+	})
+}
@@ -0,0 +1,52 @@
+package websocket
+
+import "context"
+
+// InboundMessage is a message read by ReadChan.
+type InboundMessage struct {
+	Type MessageType
+	Data []byte
+}
+
+// ReadChan starts a goroutine that reads messages from the connection
+// and delivers them on the returned message channel.
+//
+// The message channel is unbuffered so the next message is not read until
+// the previous one has been received. Once reading fails, the error is sent on the
+// buffered error channel and both channels are closed. Reading stops when ctx is
+// cancelled or the connection is closed.
+//
+// As with Read, if ctx is cancelled or expires while a message is being read,
+// the connection is closed. Cancelling ctx is therefore not a way to pause
+// reading. Pass a ctx that lives as long as the connection.
+//
+// The goroutine blocks until each message is received or ctx is cancelled.
+// Either drain the message channel until it is closed or cancel ctx to avoid leaking it.
+//
+// As with Reader, ReadChan cannot be used concurrently with any other read.
+func (c *Conn) ReadChan(ctx context.Context) (<-chan InboundMessage, <-chan error) {
+	msgs := make(chan InboundMessage)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(msgs)
+		defer close(errs)
+
+		for {
+			typ, p, err := c.Read(ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			select {
+			case msgs <- InboundMessage{Type: typ, Data: p}:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return msgs, errs
+}
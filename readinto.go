@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// ReadInto is a convenience method around Reader to copy a single message
+// from the connection into w without buffering it in memory.
+// It returns the type of the message and the number of bytes copied.
+//
+// The message is streamed with Reader and so the stream read limit applies
+// if set with SetStreamReadLimit. Otherwise the read limit applies.
+func (c *Conn) ReadInto(ctx context.Context, w io.Writer) (MessageType, int64, error) {
+	typ, r, err := c.Reader(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	n, err := io.Copy(w, r)
+	return typ, n, err
+}
+
+// ReadAppend is like Read but appends the payload of the message to dst,
+// growing it as needed, and returns the extended slice. Reusing the returned
+// slice across reads, e.g. with buf, err = c.ReadAppend(ctx, buf[:0]),
+// avoids allocating for every message.
+//
+// The read limit still applies.
+func (c *Conn) ReadAppend(ctx context.Context, dst []byte) (MessageType, []byte, error) {
+	typ, r, err := c.bufferedReader(ctx)
+	if err != nil {
+		return 0, dst, err
+	}
+
+	for {
+		if len(dst) == cap(dst) {
+			// Let append pick the growth.
+			dst = append(dst, 0)[:len(dst)]
+		}
+		n, err := r.Read(dst[len(dst):cap(dst)])
+		dst = dst[:len(dst)+n]
+		if err == io.EOF {
+			return typ, dst, nil
+		}
+		if err != nil {
+			return typ, dst, err
+		}
+	}
+}
+
+// ReadToSink copies the payload of every data message read from the connection
+// to sink until reading fails. It is for continuous streams such as audio where
+// the message boundaries do not matter. One buffer is reused for the lifetime of
+// the call so that the copy loop does not allocate per message.
+//
+// ReadToSink reads as fast as sink accepts the data. A sink that blocks in Write
+// applies backpressure to the peer as the connection is then not read. To never
+// hold up the connection, use a sink that does not block such as RingBuffer
+// which overwrites the oldest unread data when the consumer lags.
+//
+// Pings and pongs delivered with DeliverControlFrames are not written to sink.
+//
+// It returns the number of bytes written to sink. A received StatusNormalClosure
+// or StatusGoingAway close frame ends the stream and nil is returned. If sink
+// fails, its error is returned and the connection is left open.
+func (c *Conn) ReadToSink(ctx context.Context, sink io.Writer) (int64, error) {
+	buf := make([]byte, 32<<10)
+	var written int64
+	for {
+		typ, r, err := c.Reader(ctx)
+		if err != nil {
+			switch CloseStatus(err) {
+			case StatusNormalClosure, StatusGoingAway:
+				return written, nil
+			}
+			return written, err
+		}
+		if typ == MessagePing || typ == MessagePong {
+			continue
+		}
+
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				m, err := sink.Write(buf[:n])
+				written += int64(m)
+				if err != nil {
+					return written, fmt.Errorf("failed to write to sink: %w", err)
+				}
+				if m < n {
+					return written, fmt.Errorf("failed to write to sink: %w", io.ErrShortWrite)
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+}
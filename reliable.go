@@ -0,0 +1,233 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrAckTimeout is returned by ReliableConn.Send, wrapped with the number of
+// attempts, when no acknowledgment was read within AckTimeout on the last attempt.
+var ErrAckTimeout = errors.New("timed out waiting for acknowledgment")
+
+// ReliableConn sends messages with at-least-once delivery over a connection
+// that is redialed when it drops. A message whose write fails or that is not
+// acknowledged before the connection drops is resent on a new connection and
+// so messages must be idempotent.
+//
+// ReliableConn reads every connection it dials. Inbound messages are checked
+// with IsAck and the others are passed to OnMessage.
+//
+// Set Dial before the first Send. The other fields are optional and must not be
+// changed after the first Send.
+type ReliableConn struct {
+	// Dial returns a new connection. It is called by the first Send and
+	// by the Send following a dropped connection.
+	Dial func(ctx context.Context) (*Conn, error)
+
+	// MaxAttempts bounds the number of times Send writes a message,
+	// including the first. Defaults to 3.
+	MaxAttempts int
+
+	// IsAck reports whether the inbound message of type typ and payload p
+	// acknowledges the message sent. If nil, Send returns once the message
+	// is written.
+	IsAck func(sent []byte, typ MessageType, p []byte) bool
+
+	// AckTimeout bounds the wait for the acknowledgment of each attempt.
+	// Once exceeded, the connection is dropped and the message resent.
+	// Defaults to 5s.
+	AckTimeout time.Duration
+
+	// OnMessage is called from the goroutine reading the connection with every
+	// inbound message that is not an acknowledgment. It must not block for long
+	// as acknowledgments are not read meanwhile.
+	OnMessage func(typ MessageType, p []byte)
+
+	// sendMu serializes Send.
+	sendMu sync.Mutex
+
+	mu sync.Mutex
+	c  *Conn
+	// dead is closed once c can no longer be read.
+	dead    chan struct{}
+	pending *pendingSend
+	closed  bool
+}
+
+// pendingSend is the message waiting for its acknowledgment.
+type pendingSend struct {
+	p     []byte
+	acked chan struct{}
+}
+
+// Send writes the message of type typ with payload p and waits for its
+// acknowledgment if IsAck is set. If the write fails or the connection drops
+// before the acknowledgment is read, the connection is redialed and the message
+// resent up to MaxAttempts times in total.
+//
+// Send calls are serialized so that messages are sent in order.
+func (rc *ReliableConn) Send(ctx context.Context, typ MessageType, p []byte) error {
+	rc.sendMu.Lock()
+	defer rc.sendMu.Unlock()
+
+	maxAttempts := rc.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		var c *Conn
+		var dead chan struct{}
+		c, dead, err = rc.conn(ctx)
+		if err == nil {
+			err = rc.send(ctx, c, dead, typ, p)
+			if err == nil {
+				return nil
+			}
+			rc.drop(c)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to send message: %w", ctx.Err())
+		}
+		if attempt >= maxAttempts {
+			return fmt.Errorf("failed to send message after %v attempts: %w", attempt, err)
+		}
+	}
+}
+
+// send performs a single attempt of Send on c.
+func (rc *ReliableConn) send(ctx context.Context, c *Conn, dead <-chan struct{}, typ MessageType, p []byte) error {
+	var ps *pendingSend
+	if rc.IsAck != nil {
+		// Set before the write as the acknowledgment may be read before it returns.
+		ps = &pendingSend{
+			p:     p,
+			acked: make(chan struct{}),
+		}
+		rc.mu.Lock()
+		rc.pending = ps
+		rc.mu.Unlock()
+		defer func() {
+			rc.mu.Lock()
+			rc.pending = nil
+			rc.mu.Unlock()
+		}()
+	}
+
+	err := c.Write(ctx, typ, p)
+	if err != nil {
+		return err
+	}
+	if ps == nil {
+		return nil
+	}
+
+	ackTimeout := rc.AckTimeout
+	if ackTimeout <= 0 {
+		ackTimeout = time.Second * 5
+	}
+	t := time.NewTimer(ackTimeout)
+	defer t.Stop()
+
+	select {
+	case <-ps.acked:
+		return nil
+	case <-dead:
+		return errors.New("connection dropped before acknowledgment")
+	case <-t.C:
+		return ErrAckTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// conn returns the current connection and dials a new one if there is none.
+func (rc *ReliableConn) conn(ctx context.Context) (*Conn, chan struct{}, error) {
+	rc.mu.Lock()
+	c, dead, closed := rc.c, rc.dead, rc.closed
+	rc.mu.Unlock()
+	if closed {
+		return nil, nil, net.ErrClosed
+	}
+	if c != nil {
+		return c, dead, nil
+	}
+
+	c, err := rc.Dial(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to dial: %w", err)
+	}
+	dead = make(chan struct{})
+
+	rc.mu.Lock()
+	if rc.closed {
+		rc.mu.Unlock()
+		c.CloseNow()
+		return nil, nil, net.ErrClosed
+	}
+	rc.c, rc.dead = c, dead
+	rc.mu.Unlock()
+
+	go rc.readLoop(c, dead)
+	return c, dead, nil
+}
+
+// readLoop reads c until it fails to dispatch the acknowledgments and the other
+// inbound messages.
+func (rc *ReliableConn) readLoop(c *Conn, dead chan struct{}) {
+	defer close(dead)
+	for {
+		typ, p, err := c.Read(context.Background())
+		if err != nil {
+			rc.drop(c)
+			return
+		}
+
+		rc.mu.Lock()
+		ps := rc.pending
+		rc.mu.Unlock()
+		if ps != nil && rc.IsAck(ps.p, typ, p) {
+			rc.mu.Lock()
+			if rc.pending == ps {
+				rc.pending = nil
+				close(ps.acked)
+			}
+			rc.mu.Unlock()
+			continue
+		}
+
+		if rc.OnMessage != nil {
+			rc.OnMessage(typ, p)
+		}
+	}
+}
+
+// drop closes c so that the next Send dials a new connection.
+func (rc *ReliableConn) drop(c *Conn) {
+	rc.mu.Lock()
+	if rc.c == c {
+		rc.c, rc.dead = nil, nil
+	}
+	rc.mu.Unlock()
+	c.CloseNow()
+}
+
+// Close closes the current connection with StatusNormalClosure.
+// Send fails with net.ErrClosed once Close has been called.
+func (rc *ReliableConn) Close() error {
+	rc.mu.Lock()
+	c := rc.c
+	rc.closed = true
+	rc.c, rc.dead = nil, nil
+	rc.mu.Unlock()
+
+	if c == nil {
+		return nil
+	}
+	return c.Close(StatusNormalClosure, "")
+}
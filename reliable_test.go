@@ -0,0 +1,194 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+// reliableServer dials a wstest.Pipe for every connection of a ReliableConn
+// and serves its server side with serve and the number of the connection.
+type reliableServer struct {
+	serve func(n int, c *websocket.Conn)
+
+	mu    sync.Mutex
+	dials int
+	wg    sync.WaitGroup
+}
+
+func (s *reliableServer) dial(ctx context.Context) (*websocket.Conn, error) {
+	s.mu.Lock()
+	s.dials++
+	n := s.dials
+	s.mu.Unlock()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer c2.CloseNow()
+		s.serve(n, c2)
+	}()
+	return c1, nil
+}
+
+func (s *reliableServer) dialCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dials
+}
+
+func isAckOf(sent []byte, typ websocket.MessageType, p []byte) bool {
+	return string(p) == "ack:"+string(sent)
+}
+
+func TestReliableConn(t *testing.T) {
+	t.Parallel()
+
+	t.Run("redeliver", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		var receivedMu sync.Mutex
+		var received []string
+		s := &reliableServer{
+			serve: func(n int, c *websocket.Conn) {
+				for {
+					_, p, err := c.Read(ctx)
+					if err != nil {
+						return
+					}
+					receivedMu.Lock()
+					received = append(received, string(p))
+					receivedMu.Unlock()
+					if n == 1 {
+						// Drops the connection before acknowledging.
+						return
+					}
+					c.Write(ctx, websocket.MessageText, []byte("unrelated"))
+					c.Write(ctx, websocket.MessageText, append([]byte("ack:"), p...))
+				}
+			},
+		}
+
+		messages := make(chan string, 1)
+		rc := &websocket.ReliableConn{
+			Dial:  s.dial,
+			IsAck: isAckOf,
+			OnMessage: func(typ websocket.MessageType, p []byte) {
+				messages <- string(p)
+			},
+		}
+
+		err := rc.Send(ctx, websocket.MessageText, []byte("order-1"))
+		assert.Success(t, err)
+		assert.Equal(t, "dials", 2, s.dialCount())
+		assert.Equal(t, "unrelated message", "unrelated", <-messages)
+
+		// The connection is reused once acknowledged.
+		err = rc.Send(ctx, websocket.MessageText, []byte("order-2"))
+		assert.Success(t, err)
+		assert.Equal(t, "dials", 2, s.dialCount())
+		assert.Equal(t, "unrelated message", "unrelated", <-messages)
+
+		err = rc.Close()
+		assert.Success(t, err)
+		s.wg.Wait()
+		assert.Equal(t, "received", []string{"order-1", "order-1", "order-2"}, received)
+
+		err = rc.Send(ctx, websocket.MessageText, []byte("order-3"))
+		assert.Contains(t, err, "closed")
+	})
+
+	t.Run("maxAttempts", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		s := &reliableServer{
+			serve: func(n int, c *websocket.Conn) {
+				// Always drops the connection after reading the message.
+				c.Read(ctx)
+			},
+		}
+		rc := &websocket.ReliableConn{
+			Dial:        s.dial,
+			MaxAttempts: 2,
+			IsAck:       isAckOf,
+		}
+		defer rc.Close()
+
+		err := rc.Send(ctx, websocket.MessageText, []byte("lost"))
+		assert.Contains(t, err, "after 2 attempts")
+		assert.Equal(t, "dials", 2, s.dialCount())
+	})
+
+	t.Run("ackTimeout", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		s := &reliableServer{
+			serve: func(n int, c *websocket.Conn) {
+				// Never acknowledges.
+				for {
+					_, _, err := c.Read(ctx)
+					if err != nil {
+						return
+					}
+				}
+			},
+		}
+		rc := &websocket.ReliableConn{
+			Dial:        s.dial,
+			MaxAttempts: 1,
+			IsAck:       isAckOf,
+			AckTimeout:  time.Millisecond * 50,
+		}
+		defer rc.Close()
+
+		err := rc.Send(ctx, websocket.MessageText, []byte("unacknowledged"))
+		assert.ErrorIs(t, websocket.ErrAckTimeout, err)
+	})
+
+	t.Run("noAck", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		received := make(chan string, 1)
+		s := &reliableServer{
+			serve: func(n int, c *websocket.Conn) {
+				_, p, err := c.Read(ctx)
+				if err == nil {
+					received <- string(p)
+				}
+				<-c.CloseRead(ctx).Done()
+			},
+		}
+		rc := &websocket.ReliableConn{
+			Dial: s.dial,
+		}
+
+		err := rc.Send(ctx, websocket.MessageText, []byte("fire and forget"))
+		assert.Success(t, err)
+		assert.Equal(t, "received", "fire and forget", <-received)
+
+		err = rc.Close()
+		assert.Success(t, err)
+		s.wg.Wait()
+	})
+}
@@ -0,0 +1,96 @@
+package websocket
+
+import (
+	"io"
+	"sync"
+)
+
+// RingBuffer is a fixed size byte buffer that overwrites its oldest unread data
+// once full. It is a sink for ReadToSink that never blocks the connection when
+// the consumer lags, e.g. for real-time audio where only the latest data matters.
+//
+// It is safe for concurrent use by one writer and one reader.
+type RingBuffer struct {
+	mu          sync.Mutex
+	buf         []byte
+	start       int
+	n           int
+	overwritten int64
+}
+
+var _ io.ReadWriter = &RingBuffer{}
+
+// NewRingBuffer returns a RingBuffer holding up to size bytes.
+func NewRingBuffer(size int) *RingBuffer {
+	if size <= 0 {
+		panic("websocket: ring buffer size must be positive")
+	}
+	return &RingBuffer{
+		buf: make([]byte, size),
+	}
+}
+
+// Write appends p to the buffer, overwriting the oldest unread data if there is
+// not enough space. If p is longer than the buffer, only its last bytes are kept.
+// It never blocks and always returns len(p) and nil.
+func (rb *RingBuffer) Write(p []byte) (int, error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	n := len(p)
+	if len(p) > len(rb.buf) {
+		rb.overwritten += int64(len(p) - len(rb.buf))
+		p = p[len(p)-len(rb.buf):]
+	}
+	if over := rb.n + len(p) - len(rb.buf); over > 0 {
+		// Drops the oldest unread bytes.
+		rb.overwritten += int64(over)
+		rb.start = (rb.start + over) % len(rb.buf)
+		rb.n -= over
+	}
+
+	end := (rb.start + rb.n) % len(rb.buf)
+	m := copy(rb.buf[end:], p)
+	copy(rb.buf, p[m:])
+	rb.n += len(p)
+	return n, nil
+}
+
+// Read reads the oldest unread data into p. It does not block. As with
+// bytes.Buffer, io.EOF is returned if there is no unread data even though
+// more may be written later.
+func (rb *RingBuffer) Read(p []byte) (int, error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if rb.n == 0 {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+
+	if len(p) > rb.n {
+		p = p[:rb.n]
+	}
+	m := copy(p, rb.buf[rb.start:])
+	copy(p[m:], rb.buf)
+	rb.start = (rb.start + len(p)) % len(rb.buf)
+	rb.n -= len(p)
+	return len(p), nil
+}
+
+// Len returns the number of unread bytes.
+func (rb *RingBuffer) Len() int {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.n
+}
+
+// Overwritten returns the number of bytes dropped unread
+// as they were overwritten by newer data.
+func (rb *RingBuffer) Overwritten() int64 {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.overwritten
+}
@@ -0,0 +1,93 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Router reads messages from a connection and dispatches them to the
+// handler registered for their type.
+//
+// Text messages are buffered as with Read and binary messages are streamed
+// as with Reader so that large binary messages are not held in memory. Thus
+// text messages are bound by the read limit and binary messages by the
+// stream read limit.
+//
+// The zero value is a Router without any handlers.
+type Router struct {
+	onText   func(ctx context.Context, p []byte) error
+	onBinary func(ctx context.Context, r io.Reader) error
+}
+
+// OnText sets the handler for text messages.
+func (rt *Router) OnText(fn func(ctx context.Context, p []byte) error) {
+	rt.onText = fn
+}
+
+// OnBinary sets the handler for binary messages. The reader is only valid
+// until the handler returns. Whatever the handler does not read is discarded.
+func (rt *Router) OnBinary(fn func(ctx context.Context, r io.Reader) error) {
+	rt.onBinary = fn
+}
+
+// Run reads messages from c and dispatches them until the connection is
+// closed or ctx is cancelled.
+//
+// As with Serve, Run returns nil if the peer closes the connection with
+// StatusNormalClosure or StatusGoingAway and any other read error is returned.
+// If a handler returns an error, the connection is closed with StatusInternalError
+// and the error as the reason. The error is then returned.
+//
+// If a message is read for which no handler is set, the connection is closed
+// with StatusUnsupportedData and an error is returned.
+func (rt *Router) Run(ctx context.Context, c *Conn) error {
+	for {
+		typ, r, err := c.streamBinaryReader(ctx)
+		if err != nil {
+			switch CloseStatus(err) {
+			case StatusNormalClosure, StatusGoingAway:
+				return nil
+			}
+			return err
+		}
+
+		err = rt.dispatch(ctx, c, typ, r)
+		if err != nil {
+			return err
+		}
+
+		// The next Reader fails if the message was not read to completion.
+		_, err = io.Copy(io.Discard, r)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (rt *Router) dispatch(ctx context.Context, c *Conn, typ MessageType, r io.Reader) error {
+	var err error
+	switch {
+	case typ == MessageText && rt.onText != nil:
+		var p []byte
+		p, err = io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		err = rt.onText(ctx, p)
+	case typ == MessageBinary && rt.onBinary != nil:
+		err = rt.onBinary(ctx, r)
+	case typ == MessagePing || typ == MessagePong:
+		// Delivered with DeliverControlFrames.
+		return nil
+	default:
+		err = fmt.Errorf("no handler for %v messages", typ)
+		c.Close(StatusUnsupportedData, err.Error())
+		return err
+	}
+	if err != nil {
+		c.Close(StatusInternalError, handlerCloseReason(err))
+		return fmt.Errorf("failed to handle message: %w", err)
+	}
+	return nil
+}
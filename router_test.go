@@ -0,0 +1,82 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestRouter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("mixed", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+
+		var got []string
+		var rt websocket.Router
+		rt.OnText(func(ctx context.Context, p []byte) error {
+			got = append(got, "text "+string(p))
+			return nil
+		})
+		rt.OnBinary(func(ctx context.Context, r io.Reader) error {
+			// Only part of the message is read, the rest is discarded.
+			p := make([]byte, 3)
+			_, err := io.ReadFull(r, p)
+			got = append(got, "binary "+string(p))
+			return err
+		})
+
+		runErr := make(chan error, 1)
+		go func() {
+			runErr <- rt.Run(ctx, c2)
+		}()
+
+		assert.Success(t, c1.Write(ctx, websocket.MessageText, []byte("hello")))
+		assert.Success(t, c1.Write(ctx, websocket.MessageBinary, []byte("media stream")))
+		assert.Success(t, c1.Write(ctx, websocket.MessageText, []byte("bye")))
+
+		c1.CloseRead(ctx)
+		assert.Success(t, c1.Close(websocket.StatusNormalClosure, ""))
+		assert.Success(t, <-runErr)
+		assert.Equal(t, "messages", []string{"text hello", "binary med", "text bye"}, got)
+	})
+
+	t.Run("noHandler", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+
+		var rt websocket.Router
+		rt.OnText(func(ctx context.Context, p []byte) error {
+			return nil
+		})
+
+		runErr := make(chan error, 1)
+		go func() {
+			runErr <- rt.Run(ctx, c2)
+		}()
+
+		go c1.Write(ctx, websocket.MessageBinary, []byte("media"))
+		_, _, err := c1.Read(ctx)
+		assert.Equal(t, "close status", websocket.StatusUnsupportedData, websocket.CloseStatus(err))
+		assert.Contains(t, <-runErr, "no handler for MessageBinary messages")
+	})
+}
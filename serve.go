@@ -0,0 +1,53 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Serve reads messages from c and calls handler with each of them until
+// the connection is closed or ctx is cancelled.
+//
+// Messages are handled in order as the next message is not read until
+// handler returns.
+//
+// Serve returns nil if the peer closes the connection with StatusNormalClosure
+// or StatusGoingAway. Any other read error is returned.
+//
+// If handler returns an error, the connection is closed with StatusInternalError
+// and the error as the reason. The error is then returned.
+func Serve(ctx context.Context, c *Conn, handler func(ctx context.Context, typ MessageType, p []byte) error) error {
+	for {
+		typ, p, err := c.Read(ctx)
+		if err != nil {
+			switch CloseStatus(err) {
+			case StatusNormalClosure, StatusGoingAway:
+				return nil
+			}
+			return err
+		}
+
+		err = handler(ctx, typ, p)
+		if err != nil {
+			c.Close(StatusInternalError, handlerCloseReason(err))
+			return fmt.Errorf("failed to handle message: %w", err)
+		}
+	}
+}
+
+// handlerCloseReason returns the error message as a valid close reason.
+// Invalid UTF-8 is replaced and the message is truncated to the max length
+// of a close reason without splitting a UTF-8 sequence.
+func handlerCloseReason(err error) string {
+	reason := strings.ToValidUTF8(err.Error(), "\uFFFD")
+	if len(reason) <= maxCloseReason {
+		return reason
+	}
+	reason = reason[:maxCloseReason]
+	for !utf8.ValidString(reason) {
+		reason = reason[:len(reason)-1]
+	}
+	return reason
+}
@@ -0,0 +1,73 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestServe(t *testing.T) {
+	t.Parallel()
+
+	t.Run("normalClosure", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+
+		serveErr := make(chan error, 1)
+		go func() {
+			serveErr <- websocket.Serve(ctx, c2, func(ctx context.Context, typ websocket.MessageType, p []byte) error {
+				return c2.Write(ctx, typ, p)
+			})
+		}()
+
+		go c1.Write(ctx, websocket.MessageText, []byte("hello"))
+		_, p, err := c1.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "message", "hello", string(p))
+
+		c1.CloseRead(ctx)
+		assert.Success(t, c1.Close(websocket.StatusNormalClosure, ""))
+		assert.Success(t, <-serveErr)
+	})
+
+	t.Run("handlerError", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+
+		// Invalid UTF-8 and too long to be a close reason as is.
+		handlerErr := errors.New("bad \xff " + strings.Repeat("é", 100))
+		serveErr := make(chan error, 1)
+		go func() {
+			serveErr <- websocket.Serve(ctx, c2, func(ctx context.Context, typ websocket.MessageType, p []byte) error {
+				return handlerErr
+			})
+		}()
+
+		go c1.Write(ctx, websocket.MessageText, []byte("hello"))
+		_, _, err := c1.Read(ctx)
+		assert.Equal(t, "close status", websocket.StatusInternalError, websocket.CloseStatus(err))
+		_, reason, _ := websocket.CloseReason(err)
+		assert.Contains(t, reason, "bad �")
+
+		assert.ErrorIs(t, handlerErr, <-serveErr)
+	})
+}
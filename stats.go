@@ -0,0 +1,44 @@
+package websocket
+
+import "sync/atomic"
+
+// Stats holds statistics about a connection.
+// See the Stats method on Conn.
+type Stats struct {
+	// MessagesRead is the number of data messages read.
+	MessagesRead int64
+	// BytesRead is the number of message payload bytes read after decompression.
+	BytesRead int64
+
+	// MessagesWritten is the number of data messages written.
+	MessagesWritten int64
+	// BytesWritten is the number of message payload bytes written before compression.
+	BytesWritten int64
+
+	// CloseStatus is the status code of the first close frame sent or received.
+	// It is -1 if no close frame has been sent or received.
+	CloseStatus StatusCode
+}
+
+type connStats struct {
+	messagesRead    atomic.Int64
+	bytesRead       atomic.Int64
+	messagesWritten atomic.Int64
+	bytesWritten    atomic.Int64
+	// closeStatus is 0 until a close frame is sent or received.
+	closeStatus atomic.Int64
+}
+
+func (s *connStats) load() Stats {
+	closeStatus := StatusCode(s.closeStatus.Load())
+	if closeStatus == 0 {
+		closeStatus = -1
+	}
+	return Stats{
+		MessagesRead:    s.messagesRead.Load(),
+		BytesRead:       s.bytesRead.Load(),
+		MessagesWritten: s.messagesWritten.Load(),
+		BytesWritten:    s.bytesWritten.Load(),
+		CloseStatus:     closeStatus,
+	}
+}
@@ -43,11 +43,13 @@ func _() {
 	var x [1]struct{}
 	_ = x[MessageText-1]
 	_ = x[MessageBinary-2]
+	_ = x[MessagePing-3]
+	_ = x[MessagePong-4]
 }
 
-const _MessageType_name = "MessageTextMessageBinary"
+const _MessageType_name = "MessageTextMessageBinaryMessagePingMessagePong"
 
-var _MessageType_index = [...]uint8{0, 11, 24}
+var _MessageType_index = [...]uint8{0, 11, 24, 35, 46}
 
 func (i MessageType) String() string {
 	i -= 1
@@ -13,22 +13,53 @@ import (
 	"io"
 	"net"
 	"time"
+	"unicode/utf8"
 
 	"compress/flate"
 
+	"github.com/oarkflow/websocket/internal/bpool"
 	"github.com/oarkflow/websocket/internal/errd"
 	"github.com/oarkflow/websocket/internal/util"
 )
 
+// ErrConcurrentWriter is returned by Writer and Write with the StrictConcurrency
+// option when another message is being written.
+var ErrConcurrentWriter = errors.New("another message is being written")
+
+// errCloseSent is returned by writes of data and close frames
+// once the close frame has been written.
+var errCloseSent = errors.New("close frame already sent")
+
 // Writer returns a writer bounded by the context that will write
 // a WebSocket message of type dataType to the connection.
 //
 // You must close the writer once you have written the entire message.
 //
 // Only one writer can be open at a time, multiple calls will block until the previous writer
-// is closed.
+// is closed. With the StrictConcurrency option, they fail with ErrConcurrentWriter instead.
+//
+// The returned writer also implements
+//
+//	Flush() error
+//
+// Flush sends the data written so far to the peer without ending the message.
+// This allows progressively streaming a large message. Close still ends the message.
+//
+// It also implements
+//
+//	Abort() error
+//
+// Abort cancels the message instead of ending it. If none of its frames have
+// reached the connection yet, they are discarded and the connection remains usable
+// for the next message. Otherwise the peer has already received part of the
+// message which cannot be ended without it being read as complete and so the
+// connection is closed and an error is returned.
+//
+// Once ctx is cancelled, the message cannot be completed. Write and Flush return
+// the context error and Close aborts the message as Abort would.
+// If ctx expires during a write of a frame, the connection is closed.
 func (c *Conn) Writer(ctx context.Context, typ MessageType) (io.WriteCloser, error) {
-	w, err := c.writer(ctx, typ)
+	w, err := c.writer(ctx, typ, c.strictConcurrency)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get writer: %w", err)
 	}
@@ -39,10 +70,11 @@ func (c *Conn) Writer(ctx context.Context, typ MessageType) (io.WriteCloser, err
 //
 // See the Writer method if you want to stream a message.
 //
-// If compression is disabled or the compression threshold is not met, then it
-// will write the message in a single frame.
+// If compression is disabled or the message is not to be compressed per the
+// compression threshold or CompressionOptions.ShouldCompress, then it will
+// write the message in a single frame.
 func (c *Conn) Write(ctx context.Context, typ MessageType, p []byte) error {
-	_, err := c.write(ctx, typ, p)
+	_, err := c.write(ctx, typ, p, c.strictConcurrency)
 	if err != nil {
 		return fmt.Errorf("failed to write msg: %w", err)
 	}
@@ -57,9 +89,16 @@ type msgWriter struct {
 	closed  bool
 
 	ctx    context.Context
+	cancel context.CancelFunc
 	opcode opcode
 	flate  bool
 
+	// typ is the type of the message and uncompressed and compressed
+	// are the lengths of its payload before and after compression.
+	typ          MessageType
+	uncompressed int
+	compressed   int
+
 	trimWriter  *trimLastFourBytesWriter
 	flateWriter *flate.Writer
 }
@@ -81,7 +120,7 @@ func (mw *msgWriter) ensureFlate() {
 	}
 
 	if mw.flateWriter == nil {
-		mw.flateWriter = getFlateWriter(mw.trimWriter)
+		mw.flateWriter = getFlateWriter(mw.trimWriter, mw.c.copts.dictionary)
 	}
 	mw.flate = true
 }
@@ -93,23 +132,49 @@ func (mw *msgWriter) flateContextTakeover() bool {
 	return !mw.c.copts.serverNoContextTakeover
 }
 
-func (c *Conn) writer(ctx context.Context, typ MessageType) (io.WriteCloser, error) {
-	err := c.msgWriter.reset(ctx, typ)
+// writeContext bounds ctx with the write deadline if set or else with the
+// WriteTimeout option if ctx has no deadline of its own.
+// The returned cancel func is nil if ctx is returned as is.
+func (c *Conn) writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := withDeadline(ctx, &c.writeDeadline)
+	if cancel != nil || c.defaultWriteTimeout <= 0 {
+		return ctx, cancel
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, nil
+	}
+	return context.WithTimeout(ctx, c.defaultWriteTimeout)
+}
+
+// writer returns the message writer. If exclusive is set, it fails with
+// ErrConcurrentWriter instead of waiting for the message being written.
+func (c *Conn) writer(ctx context.Context, typ MessageType, exclusive bool) (io.WriteCloser, error) {
+	ctx, cancel := c.writeContext(ctx)
+	err := c.msgWriter.reset(ctx, cancel, typ, exclusive)
 	if err != nil {
+		if cancel != nil {
+			cancel()
+		}
 		return nil, err
 	}
 	return c.msgWriter, nil
 }
 
-func (c *Conn) write(ctx context.Context, typ MessageType, p []byte) (int, error) {
-	mw, err := c.writer(ctx, typ)
+func (c *Conn) write(ctx context.Context, typ MessageType, p []byte, exclusive bool) (int, error) {
+	mw, err := c.writer(ctx, typ, exclusive)
 	if err != nil {
 		return 0, err
 	}
 
-	if !c.flate() {
-		defer c.msgWriter.mu.unlock()
-		return c.writeFrame(ctx, true, false, c.msgWriter.opcode, p)
+	// Messages that are not compressed are written directly from p, in a
+	// single frame unless MaxFrameSize splits them, instead of as a data
+	// frame and an empty fin frame through mw. Neither allocates.
+	if !c.flate() || !c.msgWriter.shouldCompress(len(p)) {
+		return c.writeMessage(false, p, p)
+	}
+
+	if c.copts.minRatio > 0 {
+		return c.msgWriter.writeMinRatio(p)
 	}
 
 	n, err := mw.Write(p)
@@ -121,16 +186,107 @@ func (c *Conn) write(ctx context.Context, typ MessageType, p []byte) (int, error
 	return n, err
 }
 
-func (mw *msgWriter) reset(ctx context.Context, typ MessageType) error {
-	err := mw.mu.lock(ctx)
+// writeMessage writes payload as the whole message msg with c.msgWriter held.
+// payload is the compressed msg if flate is set.
+func (c *Conn) writeMessage(flate bool, payload, msg []byte) (int, error) {
+	typ := c.msgWriter.typ
+	n, err := c.writeFrames(c.msgWriter.ctx, c.msgWriter.opcode, flate, payload)
+	if flate {
+		n = 0
+		if err == nil {
+			n = len(msg)
+		}
+	}
+	c.stats.bytesWritten.Add(int64(n))
+	c.msgWriter.mu.unlock()
 	if err != nil {
-		return err
+		return n, err
+	}
+	c.stats.messagesWritten.Add(1)
+	c.writeComplete(typ, len(msg), len(payload))
+	return n, nil
+}
+
+// writeComplete calls the OnWriteComplete option once a message of type typ
+// has been written. It must be called without c.msgWriter held so that the
+// callback may write.
+func (c *Conn) writeComplete(typ MessageType, uncompressed, compressed int) {
+	if c.onWriteComplete != nil {
+		c.onWriteComplete(typ, uncompressed, compressed)
+	}
+}
+
+// writeMinRatio compresses p into a pooled buffer with the flate writer of the
+// message, i.e. with context takeover and the dictionary, and writes the result
+// if it shrinks to at most copts.minRatio of the size of p. Otherwise p is written
+// uncompressed.
+func (mw *msgWriter) writeMinRatio(p []byte) (int, error) {
+	b := bpool.Get()
+	defer bpool.Put(b)
+
+	mw.ensureFlate()
+	w := mw.trimWriter.w
+	mw.trimWriter.w = b
+	// Writes to a bytes.Buffer do not fail.
+	mw.flateWriter.Write(p)
+	mw.flateWriter.Flush()
+	mw.trimWriter.w = w
+	// The tail held back by the trim writer is the deflate message tail.
+	mw.trimWriter.reset()
+
+	ok := float64(b.Len()) <= mw.c.copts.minRatio*float64(len(p))
+	switch {
+	case !mw.flateContextTakeover():
+		if len(mw.c.copts.dictionary) > 0 {
+			mw.flateWriter.Reset(mw.trimWriter)
+		} else {
+			mw.putFlateWriter()
+		}
+	case !ok:
+		// The peer never sees p and so the history of the flate writer
+		// must be dropped. A writer without the dictionary refers to
+		// no earlier data which the peer understands with any window.
+		if len(mw.c.copts.dictionary) > 0 {
+			mw.flateWriter, _ = flate.NewWriter(mw.trimWriter, flate.BestSpeed)
+		} else {
+			mw.putFlateWriter()
+		}
 	}
 
+	if !ok {
+		return mw.c.writeMessage(false, p, p)
+	}
+	return mw.c.writeMessage(true, b.Bytes(), p)
+}
+
+func (mw *msgWriter) reset(ctx context.Context, cancel context.CancelFunc, typ MessageType, exclusive bool) error {
+	if exclusive {
+		if !mw.mu.tryLock() {
+			if mw.c.isClosed() {
+				return net.ErrClosed
+			}
+			return ErrConcurrentWriter
+		}
+	} else {
+		err := mw.mu.lock(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The deadline context of the previous message is released
+	// here as its writer may be used after Close.
+	if mw.cancel != nil {
+		mw.cancel()
+	}
 	mw.ctx = ctx
+	mw.cancel = cancel
 	mw.opcode = opcode(typ)
 	mw.flate = false
 	mw.closed = false
+	mw.typ = typ
+	mw.uncompressed = 0
+	mw.compressed = 0
 
 	mw.trimWriter.reset()
 
@@ -139,13 +295,19 @@ func (mw *msgWriter) reset(ctx context.Context, typ MessageType) error {
 
 func (mw *msgWriter) putFlateWriter() {
 	if mw.flateWriter != nil {
-		putFlateWriter(mw.flateWriter)
+		if len(mw.c.copts.dictionary) == 0 {
+			putFlateWriter(mw.flateWriter)
+		}
 		mw.flateWriter = nil
 	}
 }
 
 // Write writes the given bytes to the WebSocket connection.
-func (mw *msgWriter) Write(p []byte) (_ int, err error) {
+func (mw *msgWriter) Write(p []byte) (n int, err error) {
+	err = mw.ctx.Err()
+	if err != nil {
+		return 0, fmt.Errorf("failed to write: %w", err)
+	}
 	err = mw.writeMu.lock(mw.ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to write: %w", err)
@@ -157,15 +319,17 @@ func (mw *msgWriter) Write(p []byte) (_ int, err error) {
 	}
 
 	defer func() {
+		mw.c.stats.bytesWritten.Add(int64(n))
+		mw.uncompressed += n
 		if err != nil {
 			err = fmt.Errorf("failed to write: %w", err)
 		}
 	}()
 
 	if mw.c.flate() {
-		// Only enables flate if the length crosses the
-		// threshold on the first frame
-		if mw.opcode != opContinuation && len(p) >= mw.c.flateThreshold {
+		// Only enables flate if the first frame
+		// is to be compressed.
+		if mw.opcode != opContinuation && mw.shouldCompress(len(p)) {
 			mw.ensureFlate()
 		}
 	}
@@ -177,19 +341,99 @@ func (mw *msgWriter) Write(p []byte) (_ int, err error) {
 	return mw.write(p)
 }
 
-func (mw *msgWriter) write(p []byte) (int, error) {
-	n, err := mw.c.writeFrame(mw.ctx, false, mw.flate, mw.opcode, p)
+// shouldCompress reports whether the message is compressed given
+// the length of its first frame.
+func (mw *msgWriter) shouldCompress(size int) bool {
+	if fn := mw.c.copts.shouldCompress; fn != nil {
+		return fn(MessageType(mw.opcode), size)
+	}
+	return size >= mw.c.flateThreshold
+}
+
+// writeFrames writes p as the payload of a whole message
+// in frames of at most c.maxFrameSize bytes.
+func (c *Conn) writeFrames(ctx context.Context, opcode opcode, flate bool, p []byte) (n int, err error) {
+	for {
+		fin := c.maxFrameSize <= 0 || len(p) <= c.maxFrameSize
+		frame := p
+		if !fin {
+			frame = p[:c.maxFrameSize]
+		}
+		m, err := c.writeFrame(ctx, fin, flate, opcode, frame)
+		n += m
+		if err != nil || fin {
+			return n, err
+		}
+		p = p[len(frame):]
+		opcode = opContinuation
+	}
+}
+
+func (mw *msgWriter) write(p []byte) (n int, err error) {
+	for {
+		frame := p
+		if mw.c.maxFrameSize > 0 && len(frame) > mw.c.maxFrameSize {
+			frame = frame[:mw.c.maxFrameSize]
+		}
+		m, err := mw.c.writeFrame(mw.ctx, false, mw.flate, mw.opcode, frame)
+		n += m
+		mw.compressed += m
+		if err != nil {
+			return n, fmt.Errorf("failed to write data frame: %w", err)
+		}
+		mw.opcode = opContinuation
+		p = p[len(frame):]
+		if len(p) == 0 {
+			return n, nil
+		}
+	}
+}
+
+// Flush sends the data written so far to the peer without ending the message.
+func (mw *msgWriter) Flush() (err error) {
+	defer errd.Wrap(&err, "failed to flush writer")
+
+	err = mw.ctx.Err()
 	if err != nil {
-		return n, fmt.Errorf("failed to write data frame: %w", err)
+		return err
 	}
-	mw.opcode = opContinuation
-	return n, nil
+	err = mw.writeMu.lock(mw.ctx)
+	if err != nil {
+		return err
+	}
+	defer mw.writeMu.unlock()
+
+	if mw.closed {
+		return errors.New("cannot use closed writer")
+	}
+
+	if mw.flate {
+		err = mw.flateWriter.Flush()
+		if err != nil {
+			return fmt.Errorf("failed to flush flate: %w", err)
+		}
+		err = mw.trimWriter.flush()
+		if err != nil {
+			return fmt.Errorf("failed to flush flate: %w", err)
+		}
+	}
+
+	return mw.c.flush(mw.ctx)
 }
 
 // Close flushes the frame to the connection.
 func (mw *msgWriter) Close() (err error) {
 	defer errd.Wrap(&err, "failed to close writer")
 
+	err = mw.ctx.Err()
+	if err != nil {
+		// The message can no longer be completed.
+		err2 := mw.abort()
+		if err2 != nil {
+			return fmt.Errorf("%w; failed to abort: %v", err, err2)
+		}
+		return err
+	}
 	err = mw.writeMu.lock(mw.ctx)
 	if err != nil {
 		return err
@@ -212,14 +456,89 @@ func (mw *msgWriter) Close() (err error) {
 	if err != nil {
 		return fmt.Errorf("failed to write fin frame: %w", err)
 	}
+	mw.c.stats.messagesWritten.Add(1)
 
 	if mw.flate && !mw.flateContextTakeover() {
-		mw.putFlateWriter()
+		if len(mw.c.copts.dictionary) > 0 {
+			// Reset restores the dictionary which is cheaper than allocating a new writer.
+			mw.flateWriter.Reset(mw.trimWriter)
+		} else {
+			mw.putFlateWriter()
+		}
 	}
+	typ, uncompressed, compressed := mw.typ, mw.uncompressed, mw.compressed
 	mw.mu.unlock()
+	mw.c.writeComplete(typ, uncompressed, compressed)
 	return nil
 }
 
+// Abort cancels the message without ending it.
+func (mw *msgWriter) Abort() (err error) {
+	defer errd.Wrap(&err, "failed to abort writer")
+	return mw.abort()
+}
+
+func (mw *msgWriter) abort() error {
+	// The writer's context may be done so only the closure of the
+	// connection interrupts the lock.
+	err := mw.writeMu.lock(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if mw.closed {
+		mw.writeMu.unlock()
+		return errors.New("writer already closed")
+	}
+	mw.closed = true
+
+	discarded := mw.discard()
+	mw.writeMu.unlock()
+	if !discarded {
+		mw.c.close()
+		return errors.New("message partially sent: connection closed")
+	}
+	mw.mu.unlock()
+	return nil
+}
+
+// discard drops the frames of the message buffered in c.bw and the
+// data buffered in the flate writer. It reports false if they cannot be
+// dropped without the peer seeing a corrupt message.
+func (mw *msgWriter) discard() bool {
+	err := mw.c.writeFrameMu.lock(context.Background())
+	if err != nil {
+		return false
+	}
+	defer mw.c.writeFrameMu.unlock()
+
+	if mw.opcode == opContinuation {
+		if mw.c.msgFlushed {
+			return false
+		}
+		// Only frames of the message are buffered as every frame
+		// ending a message flushes c.bw.
+		mw.c.bw.Reset(mw.c.rwc)
+	}
+
+	if mw.flate {
+		switch {
+		case len(mw.c.copts.dictionary) == 0:
+			// A new flate writer does not refer back to any data
+			// and so is understood by the peer with or without
+			// context takeover.
+			mw.putFlateWriter()
+		case !mw.flateContextTakeover():
+			mw.flateWriter.Reset(mw.trimWriter)
+		default:
+			// The dictionary would be at a different offset in the
+			// peer's window.
+			return false
+		}
+	}
+	return true
+}
+
 func (mw *msgWriter) close() {
 	if mw.c.client {
 		mw.c.writeFrameMu.forceLock()
@@ -230,6 +549,56 @@ func (mw *msgWriter) close() {
 	mw.putFlateWriter()
 }
 
+// ControlOpcode is the opcode of a control frame written with WriteControl.
+type ControlOpcode Opcode
+
+// ControlOpcode constants.
+const (
+	ControlPing  = ControlOpcode(OpPing)
+	ControlPong  = ControlOpcode(OpPong)
+	ControlClose = ControlOpcode(OpClose)
+)
+
+func (op ControlOpcode) String() string {
+	return Opcode(op).String()
+}
+
+// WriteControl writes a single control frame with the given payload which
+// must be at most 125 bytes. It is safe to call concurrently with data writes
+// as the frame is written between the frames of a message being written.
+//
+// Unlike Ping, a ping written with WriteControl does not wait for the pong.
+// A pong may be written unsolicited as a unidirectional heartbeat.
+//
+// A close frame payload must be empty or a valid status code followed by the
+// reason. Writing it initiates the close handshake like InitiateClose.
+func (c *Conn) WriteControl(ctx context.Context, op ControlOpcode, payload []byte) (err error) {
+	defer errd.Wrap(&err, "failed to write control frame")
+
+	if len(payload) > maxControlPayload {
+		return fmt.Errorf("control frame payload length %v exceeds %v", len(payload), maxControlPayload)
+	}
+
+	switch op {
+	case ControlPing, ControlPong:
+		return c.writeControl(ctx, opcode(op), payload)
+	case ControlClose:
+		ce, err := parseClosePayload(payload)
+		if err != nil {
+			return err
+		}
+		if !utf8.ValidString(ce.Reason) {
+			return errors.New("close reason is not valid UTF-8")
+		}
+		if c.closeSent.Load() {
+			return errCloseSent
+		}
+		return c.writeClose(ce.Code, ce.Reason)
+	default:
+		return fmt.Errorf("%v is not a control opcode", op)
+	}
+}
+
 func (c *Conn) writeControl(ctx context.Context, opcode opcode, p []byte) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
@@ -249,6 +618,13 @@ func (c *Conn) writeFrame(ctx context.Context, fin bool, flate bool, opcode opco
 	}
 	defer c.writeFrameMu.unlock()
 
+	switch opcode {
+	case opText, opBinary, opContinuation:
+		if c.closeSent.Load() {
+			return 0, errCloseSent
+		}
+	}
+
 	select {
 	case <-c.closed:
 		return 0, net.ErrClosed
@@ -257,22 +633,36 @@ func (c *Conn) writeFrame(ctx context.Context, fin bool, flate bool, opcode opco
 
 	defer func() {
 		if err != nil {
-			select {
-			case <-c.closed:
-				err = net.ErrClosed
-			case <-ctx.Done():
-				err = ctx.Err()
-			default:
-			}
-			err = fmt.Errorf("failed to write frame: %w", err)
+			err = fmt.Errorf("failed to write frame: %w", c.ioErr(ctx, err))
 		}
 	}()
 
+	// n is the length of p before it is transformed by the extensions.
+	n := len(p)
+	switch opcode {
+	case opText, opBinary, opContinuation:
+		if len(c.exts) > 0 {
+			p, err = c.transform(p)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
 	c.writeHeader.fin = fin
 	c.writeHeader.opcode = opcode
 	c.writeHeader.payloadLength = int64(len(p))
 
-	if c.client {
+	if opcode == opText || opcode == opBinary {
+		// c.bw may hold messages held back by SetWriteCoalesce.
+		c.msgFlushed = c.bw.Buffered() > 0
+	}
+	if fin || maxFrameHeaderSize+len(p) > c.bw.Available() {
+		// c.bw flushes the frame or runs out of space for it.
+		c.msgFlushed = true
+	}
+
+	if c.client && !c.disableMasking {
 		c.writeHeader.masked = true
 		_, err = io.ReadFull(rand.Reader, c.writeHeaderBuf[:4])
 		if err != nil {
@@ -286,20 +676,30 @@ func (c *Conn) writeFrame(ctx context.Context, fin bool, flate bool, opcode opco
 		c.writeHeader.rsv1 = true
 	}
 
+	c.observeFrame(DirectionWrite, c.writeHeader)
+
 	err = writeFrameHeader(c.writeHeader, c.bw, c.writeHeaderBuf[:])
 	if err != nil {
 		return 0, err
 	}
 
-	n, err := c.writeFramePayload(p)
+	m, err := c.writeFramePayload(p)
 	if err != nil {
-		return n, err
+		if m > n {
+			m = n
+		}
+		return m, err
 	}
 
 	if c.writeHeader.fin {
-		err = c.bw.Flush()
-		if err != nil {
-			return n, fmt.Errorf("failed to flush: %w", err)
+		if c.coalesce(opcode) {
+			c.scheduleFlush()
+		} else {
+			c.stopFlush()
+			err = c.bw.Flush()
+			if err != nil {
+				return n, fmt.Errorf("failed to flush: %w", err)
+			}
 		}
 	}
 
@@ -315,6 +715,116 @@ func (c *Conn) writeFrame(ctx context.Context, fin bool, flate bool, opcode opco
 	return n, nil
 }
 
+// SetWriteCoalesce holds back complete data messages for up to window so that
+// messages written in quick succession are flushed to the connection together
+// instead of each in its own write. Every message is still a distinct WebSocket
+// message.
+//
+// The held back messages are flushed once window has elapsed since the first of
+// them, once maxBytes are held back, when a control frame such as a ping is written
+// and on Flush. maxBytes is capped by the size of the write buffer as the buffer is
+// flushed once full. A window of 0 disables coalescing and flushes the held back
+// messages.
+//
+// Messages held back when the connection is closed with CloseNow are lost. Close
+// flushes them with the close frame.
+func (c *Conn) SetWriteCoalesce(window time.Duration, maxBytes int) {
+	err := c.writeFrameMu.lock(context.Background())
+	if err != nil {
+		return
+	}
+	c.coalesceWindow = window
+	c.coalesceMaxBytes = maxBytes
+	c.writeFrameMu.unlock()
+
+	if window <= 0 {
+		c.flush(context.Background())
+	}
+}
+
+// Flush writes the messages held back by SetWriteCoalesce to the connection.
+func (c *Conn) Flush(ctx context.Context) error {
+	ctx, cancel := c.writeContext(ctx)
+	if cancel != nil {
+		defer cancel()
+	}
+	err := c.flush(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to flush: %w", err)
+	}
+	return nil
+}
+
+// coalesce reports whether the frame ending a message of opcode
+// is held back in c.bw instead of being flushed.
+func (c *Conn) coalesce(opcode opcode) bool {
+	switch opcode {
+	case opText, opBinary, opContinuation:
+		return c.coalesceWindow > 0 && c.bw.Buffered() < c.coalesceMaxBytes
+	default:
+		return false
+	}
+}
+
+// scheduleFlush flushes c.bw once the coalesce window has elapsed
+// unless a flush is already scheduled.
+func (c *Conn) scheduleFlush() {
+	if c.coalescePending {
+		return
+	}
+	c.coalescePending = true
+	if c.coalesceTimer == nil {
+		c.coalesceTimer = time.AfterFunc(c.coalesceWindow, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			err := c.flush(ctx)
+			if err != nil && !errors.Is(err, net.ErrClosed) {
+				c.debugf("failed to flush coalesced messages: %v", err)
+			}
+		})
+		return
+	}
+	c.coalesceTimer.Reset(c.coalesceWindow)
+}
+
+// stopFlush cancels the scheduled flush as c.bw is being flushed.
+func (c *Conn) stopFlush() {
+	if c.coalescePending {
+		c.coalescePending = false
+		c.coalesceTimer.Stop()
+	}
+}
+
+// flush flushes the frames buffered in c.bw to the connection.
+func (c *Conn) flush(ctx context.Context) (err error) {
+	err = c.writeFrameMu.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.writeFrameMu.unlock()
+
+	select {
+	case <-c.closed:
+		return net.ErrClosed
+	case c.writeTimeout <- ctx:
+	}
+
+	c.msgFlushed = true
+	c.stopFlush()
+	err = c.bw.Flush()
+	if err != nil {
+		return c.ioErr(ctx, fmt.Errorf("failed to flush: %w", err))
+	}
+
+	select {
+	case <-c.closed:
+		return net.ErrClosed
+	case c.writeTimeout <- context.Background():
+	}
+
+	return nil
+}
+
 func (c *Conn) writeFramePayload(p []byte) (n int, err error) {
 	defer errd.Wrap(&err, "failed to write frame payload")
 
@@ -372,5 +882,6 @@ func extractBufioWriterBuf(bw *bufio.Writer, w io.Writer) []byte {
 }
 
 func (c *Conn) writeError(code StatusCode, err error) {
+	c.debugf("closing connection with %v: %v", code, err)
 	c.writeClose(code, err.Error())
 }
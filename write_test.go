@@ -0,0 +1,754 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestWriterFlush(t *testing.T) {
+	t.Parallel()
+
+	for name, mode := range map[string]websocket.CompressionMode{
+		"disabled":          websocket.CompressionDisabled,
+		"contextTakeover":   websocket.CompressionContextTakeover,
+		"noContextTakeover": websocket.CompressionNoContextTakeover,
+	} {
+		mode := mode
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			c1, c2 := wstest.Pipe(&websocket.DialOptions{
+				CompressionMode:      mode,
+				CompressionThreshold: 1,
+			}, &websocket.AcceptOptions{
+				CompressionMode:      mode,
+				CompressionThreshold: 1,
+			})
+			defer c1.CloseNow()
+			defer c2.CloseNow()
+
+			partial := make(chan []byte, 1)
+			readErr := make(chan error, 1)
+			go func() {
+				_, r, err := c2.Reader(ctx)
+				if err != nil {
+					readErr <- err
+					return
+				}
+				p := make([]byte, len("partial data"))
+				_, err = io.ReadFull(r, p)
+				if err != nil {
+					readErr <- err
+					return
+				}
+				partial <- p
+				_, err = io.ReadAll(r)
+				readErr <- err
+			}()
+
+			w, err := c1.Writer(ctx, websocket.MessageText)
+			assert.Success(t, err)
+			_, err = w.Write([]byte("partial data"))
+			assert.Success(t, err)
+			err = w.(interface{ Flush() error }).Flush()
+			assert.Success(t, err)
+
+			// The peer must see the data before the message is finished.
+			select {
+			case p := <-partial:
+				assert.Equal(t, "partial data", "partial data", string(p))
+			case err := <-readErr:
+				t.Fatal(err)
+			case <-ctx.Done():
+				t.Fatal("flushed data not visible to the peer")
+			}
+
+			_, err = w.Write([]byte(" and the rest"))
+			assert.Success(t, err)
+			assert.Success(t, w.Close())
+			assert.Success(t, <-readErr)
+		})
+	}
+}
+
+func TestWriterAbort(t *testing.T) {
+	t.Parallel()
+
+	for name, mode := range map[string]websocket.CompressionMode{
+		"disabled":          websocket.CompressionDisabled,
+		"contextTakeover":   websocket.CompressionContextTakeover,
+		"noContextTakeover": websocket.CompressionNoContextTakeover,
+	} {
+		mode := mode
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			c1, c2 := wstest.Pipe(&websocket.DialOptions{
+				CompressionMode:      mode,
+				CompressionThreshold: 1,
+			}, &websocket.AcceptOptions{
+				CompressionMode:      mode,
+				CompressionThreshold: 1,
+			})
+			defer c1.CloseNow()
+			defer c2.CloseNow()
+
+			msgs := make(chan string, 3)
+			readErr := make(chan error, 1)
+			go func() {
+				for {
+					_, b, err := c2.Read(ctx)
+					if err != nil {
+						readErr <- err
+						return
+					}
+					msgs <- string(b)
+				}
+			}()
+
+			w, err := c1.Writer(ctx, websocket.MessageText)
+			assert.Success(t, err)
+			_, err = w.Write([]byte("aborted"))
+			assert.Success(t, err)
+			assert.Success(t, w.(interface{ Abort() error }).Abort())
+			assert.Error(t, w.Close())
+
+			assert.Success(t, c1.Write(ctx, websocket.MessageText, []byte("fresh")))
+			assert.Equal(t, "msg", "fresh", <-msgs)
+
+			wctx, wcancel := context.WithCancel(ctx)
+			w, err = c1.Writer(wctx, websocket.MessageText)
+			assert.Success(t, err)
+			_, err = w.Write([]byte("cancelled"))
+			assert.Success(t, err)
+			wcancel()
+			_, err = w.Write([]byte("more"))
+			assert.ErrorIs(t, context.Canceled, err)
+			assert.ErrorIs(t, context.Canceled, w.Close())
+
+			assert.Success(t, c1.Write(ctx, websocket.MessageText, []byte("fresh again")))
+			assert.Equal(t, "msg", "fresh again", <-msgs)
+
+			// Once part of the message is sent, aborting fails the connection.
+			w, err = c1.Writer(ctx, websocket.MessageText)
+			assert.Success(t, err)
+			_, err = w.Write([]byte("partial"))
+			assert.Success(t, err)
+			assert.Success(t, w.(interface{ Flush() error }).Flush())
+			assert.Error(t, w.(interface{ Abort() error }).Abort())
+			assert.Error(t, <-readErr)
+			assert.Error(t, c1.Write(ctx, websocket.MessageText, []byte("closed")))
+		})
+	}
+}
+
+func TestWriteFrom(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+	c2.SetReadLimit(-1)
+
+	exp := make([]byte, 1<<20)
+	_, err := rand.Read(exp)
+	assert.Success(t, err)
+	name := filepath.Join(t.TempDir(), "data")
+	assert.Success(t, os.WriteFile(name, exp, 0o600))
+
+	f, err := os.Open(name)
+	assert.Success(t, err)
+	defer f.Close()
+
+	written := make(chan error, 1)
+	go func() {
+		n, err := c1.WriteFrom(ctx, websocket.MessageBinary, f)
+		if err == nil && n != int64(len(exp)) {
+			err = errors.New("short write")
+		}
+		written <- err
+	}()
+
+	typ, p, err := c2.Read(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "message type", websocket.MessageBinary, typ)
+	if !bytes.Equal(exp, p) {
+		t.Fatal("message differs from the file")
+	}
+	assert.Success(t, <-written)
+
+	// A failing reader aborts the message.
+	readErr := errors.New("read failed")
+	_, err = c1.WriteFrom(ctx, websocket.MessageBinary, iotest.ErrReader(readErr))
+	assert.ErrorIs(t, readErr, err)
+
+	go c1.Write(ctx, websocket.MessageText, []byte("next"))
+	_, p, err = c2.Read(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "message", "next", string(p))
+}
+
+func TestWriteCoalesce(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	const count = 100
+	received := make(chan []string, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+		var msgs []string
+		for i := 0; i < count; i++ {
+			_, p, err := c.Read(ctx)
+			if err != nil {
+				break
+			}
+			msgs = append(msgs, string(p))
+		}
+		received <- msgs
+	}))
+	defer s.Close()
+
+	var writes atomic.Int64
+	c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					nc, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+					if err != nil {
+						return nil, err
+					}
+					return &countingConn{Conn: nc, writes: &writes}, nil
+				},
+			},
+		},
+	})
+	assert.Success(t, err)
+	defer c.CloseNow()
+
+	c.SetWriteCoalesce(time.Millisecond*50, 1<<20)
+	writes.Store(0)
+	for i := 0; i < count; i++ {
+		err = c.Write(ctx, websocket.MessageText, []byte(strconv.Itoa(i)))
+		assert.Success(t, err)
+	}
+	assert.Success(t, c.Flush(ctx))
+	if n := writes.Load(); n > count/10 {
+		t.Fatalf("expected at most %v writes for %v coalesced messages but got %v", count/10, count, n)
+	}
+
+	msgs := <-received
+	assert.Equal(t, "message count", count, len(msgs))
+	for i, msg := range msgs {
+		assert.Equal(t, "message", strconv.Itoa(i), msg)
+	}
+}
+
+// countingConn counts the writes to the underlying net.Conn.
+type countingConn struct {
+	net.Conn
+	writes *atomic.Int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	c.writes.Add(1)
+	return c.Conn.Write(p)
+}
+
+func TestWriteMaxFrameSize(t *testing.T) {
+	t.Parallel()
+
+	for name, mode := range map[string]websocket.CompressionMode{
+		"disabled":        websocket.CompressionDisabled,
+		"contextTakeover": websocket.CompressionContextTakeover,
+	} {
+		mode := mode
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			const maxFrameSize = 1024
+			c1, c2, rec := wstest.RecordingPipe(&websocket.DialOptions{
+				CompressionMode:      mode,
+				CompressionThreshold: 1,
+				MaxFrameSize:         maxFrameSize,
+			}, &websocket.AcceptOptions{
+				CompressionMode: mode,
+			})
+			defer c1.CloseNow()
+			defer c2.CloseNow()
+
+			// Random so that the compressed message is still larger than a frame.
+			msg := make([]byte, maxFrameSize*4+100)
+			_, err := rand.Read(msg)
+			assert.Success(t, err)
+
+			errs := make(chan error, 1)
+			go func() {
+				errs <- c1.Write(ctx, websocket.MessageBinary, msg)
+			}()
+			_, p, err := c2.Read(ctx)
+			assert.Success(t, err)
+			assert.Success(t, <-errs)
+			assert.Equal(t, "message", msg, p)
+
+			frames := rec.ClientFrames()
+			if len(frames) < 5 {
+				t.Fatalf("expected at least 5 frames but got %v", len(frames))
+			}
+			for i, f := range frames {
+				expOpcode := websocket.OpContinuation
+				if i == 0 {
+					expOpcode = websocket.OpBinary
+				}
+				assert.Equal(t, "opcode", expOpcode, f.Opcode)
+				assert.Equal(t, "fin", i == len(frames)-1, f.Fin)
+				if f.Length > maxFrameSize {
+					t.Fatalf("frame %v is larger than %v: %v", i, maxFrameSize, f.Length)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteControl(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	pongs := make(chan int, 1)
+	c1, c2 := wstest.Pipe(nil, &websocket.AcceptOptions{
+		FrameHook: func(dir websocket.Direction, op websocket.Opcode, fin, rsv1 bool, length int) {
+			if dir == websocket.DirectionRead && op == websocket.OpPong {
+				pongs <- length
+			}
+		},
+	})
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	errs := make(chan error, 1)
+	go func() {
+		// The pong is written between the frames of the message.
+		w, err := c1.Writer(ctx, websocket.MessageText)
+		if err != nil {
+			errs <- err
+			return
+		}
+		_, err = w.Write([]byte("hello "))
+		if err != nil {
+			errs <- err
+			return
+		}
+		err = w.(interface{ Flush() error }).Flush()
+		if err != nil {
+			errs <- err
+			return
+		}
+		err = c1.WriteControl(ctx, websocket.ControlPong, []byte("heartbeat"))
+		if err != nil {
+			errs <- err
+			return
+		}
+		_, err = w.Write([]byte("world"))
+		if err != nil {
+			errs <- err
+			return
+		}
+		errs <- w.Close()
+	}()
+
+	_, p, err := c2.Read(ctx)
+	assert.Success(t, err)
+	assert.Success(t, <-errs)
+	assert.Equal(t, "message", "hello world", string(p))
+	assert.Equal(t, "pong length", len("heartbeat"), <-pongs)
+
+	err = c1.WriteControl(ctx, websocket.ControlPing, make([]byte, 126))
+	assert.Contains(t, err, "exceeds 125")
+	err = c1.WriteControl(ctx, websocket.ControlOpcode(websocket.OpText), nil)
+	assert.Contains(t, err, "not a control opcode")
+	err = c1.WriteControl(ctx, websocket.ControlClose, []byte{0})
+	assert.Contains(t, err, "too small")
+}
+
+func TestWriteStrictConcurrency(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(&websocket.DialOptions{
+		StrictConcurrency: true,
+	}, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	w, err := c1.Writer(ctx, websocket.MessageText)
+	assert.Success(t, err)
+
+	_, err = c1.Writer(ctx, websocket.MessageText)
+	assert.ErrorIs(t, websocket.ErrConcurrentWriter, err)
+	err = c1.Write(ctx, websocket.MessageText, []byte("world"))
+	assert.ErrorIs(t, websocket.ErrConcurrentWriter, err)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := w.Write([]byte("hello"))
+		if err != nil {
+			errs <- err
+			return
+		}
+		err = w.Close()
+		if err != nil {
+			errs <- err
+			return
+		}
+		errs <- c1.Write(ctx, websocket.MessageText, []byte("world"))
+	}()
+
+	_, p, err := c2.Read(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "first message", "hello", string(p))
+	_, p, err = c2.Read(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "second message", "world", string(p))
+	assert.Success(t, <-errs)
+}
+
+// discardMessages reads and discards messages from c
+// without allocating until the connection is closed.
+func discardMessages(ctx context.Context, c *websocket.Conn) {
+	b := make([]byte, 512)
+	for {
+		_, r, err := c.Reader(ctx)
+		if err != nil {
+			return
+		}
+		for err == nil {
+			_, err = r.Read(b)
+		}
+	}
+}
+
+func TestWriteSmallAllocs(t *testing.T) {
+	// Not parallel as AllocsPerRun counts the allocations of every goroutine.
+
+	msg := []byte("0123456789abcdef")
+
+	modes := map[string]websocket.CompressionMode{
+		"disabled":          websocket.CompressionDisabled,
+		"noContextTakeover": websocket.CompressionNoContextTakeover,
+		"contextTakeover":   websocket.CompressionContextTakeover,
+	}
+	for name, mode := range modes {
+		mode := mode
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			c1, c2, rec := wstest.RecordingPipe(&websocket.DialOptions{
+				CompressionMode: mode,
+			}, &websocket.AcceptOptions{
+				CompressionMode: mode,
+			})
+			defer c1.CloseNow()
+			defer c2.CloseNow()
+			go discardMessages(ctx, c2)
+
+			allocs := testing.AllocsPerRun(100, func() {
+				err := c1.Write(ctx, websocket.MessageText, msg)
+				assert.Success(t, err)
+			})
+			assert.Equal(t, "allocations per write", 0.0, allocs)
+
+			// The message below the compression threshold is a single frame.
+			f := rec.ClientFrames()[0]
+			assert.Equal(t, "opcode", websocket.OpText, f.Opcode)
+			assert.Equal(t, "fin", true, f.Fin)
+			assert.Equal(t, "rsv1", false, f.RSV1)
+			assert.Equal(t, "payload", string(msg), string(f.Payload))
+		})
+	}
+}
+
+func BenchmarkWriteSmall(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+	go discardMessages(ctx, c2)
+
+	msg := []byte("0123456789abcdef")
+	b.SetBytes(int64(len(msg)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := c1.Write(ctx, websocket.MessageText, msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	t.Parallel()
+
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+		// Never reads so that the writes of the client block.
+		<-done
+	}))
+	defer s.Close()
+	defer close(done)
+
+	// writeUntilError writes until a write fails and returns
+	// its error and how long it blocked.
+	writeUntilError := func(t *testing.T, ctx context.Context, opts *websocket.DialOptions) (time.Duration, error) {
+		c, _, err := websocket.Dial(context.Background(), s.URL, opts)
+		assert.Success(t, err)
+		defer c.CloseNow()
+
+		msg := make([]byte, 1<<20)
+		for {
+			start := time.Now()
+			err := c.Write(ctx, websocket.MessageBinary, msg)
+			if err != nil {
+				return time.Since(start), err
+			}
+		}
+	}
+
+	t.Run("default", func(t *testing.T) {
+		d, err := writeUntilError(t, context.Background(), &websocket.DialOptions{
+			WriteTimeout: time.Millisecond * 100,
+		})
+		assert.ErrorIs(t, context.DeadlineExceeded, err)
+		if d > time.Second*2 {
+			t.Fatalf("write blocked for %v despite the write timeout", d)
+		}
+	})
+
+	t.Run("tighterContext", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+
+		d, err := writeUntilError(t, ctx, &websocket.DialOptions{
+			WriteTimeout: time.Hour,
+		})
+		assert.ErrorIs(t, context.DeadlineExceeded, err)
+		if d > time.Second*2 {
+			t.Fatalf("write blocked for %v despite the context deadline", d)
+		}
+	})
+}
+
+func TestWriteOnWriteComplete(t *testing.T) {
+	t.Parallel()
+
+	type writeStats struct {
+		typ          websocket.MessageType
+		uncompressed int
+		compressed   int
+	}
+
+	modes := map[string]websocket.CompressionMode{
+		"noContextTakeover": websocket.CompressionNoContextTakeover,
+		"contextTakeover":   websocket.CompressionContextTakeover,
+	}
+	for name, mode := range modes {
+		mode := mode
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			completed := make(chan writeStats, 4)
+			c1, c2 := wstest.Pipe(&websocket.DialOptions{
+				CompressionMode:      mode,
+				CompressionThreshold: 512,
+				OnWriteComplete: func(typ websocket.MessageType, uncompressed, compressed int) {
+					completed <- writeStats{typ, uncompressed, compressed}
+				},
+			}, &websocket.AcceptOptions{
+				CompressionMode: mode,
+			})
+			defer c1.CloseNow()
+			defer c2.CloseNow()
+			go discardMessages(ctx, c2)
+
+			compressible := bytes.Repeat([]byte("compressible "), 1024)
+			incompressible := make([]byte, 4096)
+			rand.Read(incompressible)
+			small := []byte("below the threshold")
+
+			err := c1.Write(ctx, websocket.MessageText, compressible)
+			assert.Success(t, err)
+			s := <-completed
+			assert.Equal(t, "type", websocket.MessageText, s.typ)
+			assert.Equal(t, "uncompressed", len(compressible), s.uncompressed)
+			if s.compressed <= 0 || s.compressed > len(compressible)/10 {
+				t.Fatalf("expected compressible message of %v bytes to compress to at most a tenth: %v", len(compressible), s.compressed)
+			}
+
+			err = c1.Write(ctx, websocket.MessageBinary, incompressible)
+			assert.Success(t, err)
+			s = <-completed
+			assert.Equal(t, "type", websocket.MessageBinary, s.typ)
+			assert.Equal(t, "uncompressed", len(incompressible), s.uncompressed)
+			if s.compressed < len(incompressible)*9/10 || s.compressed > len(incompressible)*11/10 {
+				t.Fatalf("expected incompressible message of %v bytes to stay about the same size: %v", len(incompressible), s.compressed)
+			}
+
+			err = c1.Write(ctx, websocket.MessageBinary, small)
+			assert.Success(t, err)
+			assert.Equal(t, "uncompressed message", writeStats{websocket.MessageBinary, len(small), len(small)}, <-completed)
+
+			// Streamed with Writer.
+			w, err := c1.Writer(ctx, websocket.MessageText)
+			assert.Success(t, err)
+			_, err = w.Write(compressible[:len(compressible)/2])
+			assert.Success(t, err)
+			err = w.(interface{ Flush() error }).Flush()
+			assert.Success(t, err)
+			_, err = w.Write(compressible[len(compressible)/2:])
+			assert.Success(t, err)
+			err = w.Close()
+			assert.Success(t, err)
+			s = <-completed
+			assert.Equal(t, "uncompressed", len(compressible), s.uncompressed)
+			if s.compressed <= 0 || s.compressed > len(compressible)/10 {
+				t.Fatalf("expected streamed message of %v bytes to compress to at most a tenth: %v", len(compressible), s.compressed)
+			}
+
+			select {
+			case s := <-completed:
+				t.Fatalf("unexpected callback: %+v", s)
+			default:
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		completed := make(chan writeStats, 1)
+		c1, c2 := wstest.Pipe(&websocket.DialOptions{
+			OnWriteComplete: func(typ websocket.MessageType, uncompressed, compressed int) {
+				completed <- writeStats{typ, uncompressed, compressed}
+			},
+		}, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+		go discardMessages(ctx, c2)
+
+		msg := bytes.Repeat([]byte("compressible "), 1024)
+		err := c1.Write(ctx, websocket.MessageText, msg)
+		assert.Success(t, err)
+		assert.Equal(t, "uncompressed message", writeStats{websocket.MessageText, len(msg), len(msg)}, <-completed)
+	})
+}
+
+func TestWriteDisableMasking(t *testing.T) {
+	t.Parallel()
+
+	t.Run("allowed", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2, rec := wstest.RecordingPipe(&websocket.DialOptions{
+			DisableMasking: true,
+		}, &websocket.AcceptOptions{
+			AllowUnmaskedFrames: true,
+		})
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- c1.Write(ctx, websocket.MessageText, []byte("unmasked"))
+		}()
+		_, p, err := c2.Read(ctx)
+		assert.Success(t, err)
+		assert.Success(t, <-errs)
+		assert.Equal(t, "message", "unmasked", string(p))
+
+		frames := rec.ClientFrames()
+		assert.Equal(t, "client frames", 1, len(frames))
+		assert.Equal(t, "masked", false, frames[0].Masked)
+		assert.Equal(t, "payload", "unmasked", string(frames[0].Payload))
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2, rec := wstest.RecordingPipe(&websocket.DialOptions{
+			DisableMasking: true,
+		}, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- c1.Write(ctx, websocket.MessageText, []byte("unmasked"))
+		}()
+		_, _, err := c2.Read(ctx)
+		assert.Contains(t, err, "received unmasked frame from client")
+		assert.Success(t, <-errs)
+
+		assert.Equal(t, "masked", false, rec.ClientFrames()[0].Masked)
+	})
+}
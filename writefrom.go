@@ -0,0 +1,31 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// WriteFrom is a convenience method around Writer to write everything read
+// from r until io.EOF as a single message without buffering it in memory.
+// It returns the number of bytes written.
+//
+// If reading from r fails, the message is aborted with the Abort method of the
+// writer returned by Writer instead of being sent incomplete. See Writer for
+// when that closes the connection.
+func (c *Conn) WriteFrom(ctx context.Context, typ MessageType, r io.Reader) (int64, error) {
+	w, err := c.Writer(ctx, typ)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(w, r)
+	if err != nil {
+		err2 := w.(interface{ Abort() error }).Abort()
+		if err2 != nil {
+			return n, fmt.Errorf("%w; failed to abort message: %v", err, err2)
+		}
+		return n, err
+	}
+	return n, w.Close()
+}
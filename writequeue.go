@@ -0,0 +1,296 @@
+//go:build !js
+// +build !js
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// ErrWriteBufferFull is returned by WriteBuffered when the write queue
+// is full because the peer is not reading fast enough.
+var ErrWriteBufferFull = errors.New("write buffer full")
+
+// defaultWriteQueueSize is the default capacity of the WriteBuffered queue.
+const defaultWriteQueueSize = 16
+
+type queuedMessage struct {
+	typ MessageType
+	p   []byte
+}
+
+// WriteBuffered queues a copy of p to be written as a message of the given type
+// by a background goroutine and returns immediately.
+//
+// If the queue is full, ErrWriteBufferFull is returned and the message is dropped.
+// It is then up to the caller to drop further messages or to close the slow peer.
+// The capacity of the queue is set with the WriteQueueSize option.
+//
+// ctx is only checked before queueing. The queued messages are written
+// in order but their order relative to Writer and Write is undefined.
+// If writing a queued message fails, the connection is closed.
+func (c *Conn) WriteBuffered(ctx context.Context, typ MessageType, p []byte) error {
+	c.writeQueueOnce.Do(func() {
+		c.writeQueue = make(chan queuedMessage, c.writeQueueSize)
+		c.writeQueueWritten = make(chan struct{}, 1)
+		go c.writeQueueLoop()
+	})
+
+	select {
+	case <-c.closed:
+		return fmt.Errorf("failed to write buffered msg: %w", net.ErrClosed)
+	case <-ctx.Done():
+		return fmt.Errorf("failed to write buffered msg: %w", ctx.Err())
+	default:
+	}
+
+	c.writeQueuePending.Add(1)
+	select {
+	case c.writeQueue <- queuedMessage{typ: typ, p: append([]byte(nil), p...)}:
+		return nil
+	default:
+		c.writeQueuePending.Add(-1)
+		return ErrWriteBufferFull
+	}
+}
+
+func (c *Conn) writeQueueLoop() {
+	for {
+		select {
+		case <-c.closed:
+			return
+		case m := <-c.writeQueue:
+			// Waits for the message being written even with StrictConcurrency.
+			_, err := c.write(context.Background(), m.typ, m.p, false)
+			if err != nil {
+				c.debugf("failed to write buffered message: %v", err)
+				c.close()
+				return
+			}
+			c.writeQueuePending.Add(-1)
+			select {
+			case c.writeQueueWritten <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// drainWrites waits for the messages queued with WriteBuffered and the
+// message being written to be written and then flushes c.bw.
+func (c *Conn) drainWrites(ctx context.Context) error {
+	for c.writeQueuePending.Load() > 0 {
+		select {
+		case <-c.writeQueueWritten:
+		case <-c.closed:
+			return net.ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	err := c.msgWriter.mu.lock(ctx)
+	if err != nil {
+		return err
+	}
+	c.msgWriter.mu.unlock()
+
+	return c.flush(ctx)
+}
+
+// ErrWouldBlock is returned by WriteBestEffort when the message
+// cannot be written without blocking.
+var ErrWouldBlock = errors.New("write would block")
+
+// errBestEffortUnsupported is returned by WriteBestEffort on connections
+// without the write deadlines it relies on.
+var errBestEffortUnsupported = errors.New("best effort writes are not supported on TLS connections and connections from Dial")
+
+const (
+	// bestEffortTimeout is how long WriteBestEffort waits for the
+	// connection to become writable before dropping the message.
+	bestEffortTimeout = time.Millisecond
+
+	// bestEffortTailTimeout bounds the write of the rest of a partially
+	// written message.
+	bestEffortTailTimeout = time.Second
+)
+
+// WriteBestEffort writes a message of the given type without blocking.
+// If the message cannot be written right away, it is dropped and
+// ErrWouldBlock is returned. Use it for messages such as telemetry that
+// are better dropped than delayed.
+//
+// The message is dropped if another message is being written, which is the
+// case when a write is blocked on a slow peer, or if the connection is not
+// writable within a millisecond.
+//
+// It requires write deadlines on the underlying net.Conn that survive a timeout.
+// TLS connections and connections from Dial do not have them and so WriteBestEffort
+// always returns an error on them.
+//
+// The message is never compressed. If the message has been partially written
+// when the connection stops being writable, the rest is written with a deadline
+// of one second so as to not corrupt the connection. If that deadline is hit,
+// the connection is closed. Small messages are less likely to be partially
+// written and so are better suited to WriteBestEffort.
+func (c *Conn) WriteBestEffort(typ MessageType, p []byte) error {
+	if c.isClosed() {
+		return fmt.Errorf("failed to write best effort msg: %w", net.ErrClosed)
+	}
+	dl, ok := c.rwc.(interface {
+		SetWriteDeadline(time.Time) error
+	})
+	// A timed out write permanently breaks a *tls.Conn.
+	if _, isTLS := c.rwc.(*tls.Conn); !ok || isTLS {
+		return fmt.Errorf("failed to write best effort msg: %w", errBestEffortUnsupported)
+	}
+
+	err := c.writeBestEffort(dl, typ, p)
+	if err != nil {
+		return err
+	}
+	c.writeComplete(typ, len(p), len(p))
+	return nil
+}
+
+func (c *Conn) writeBestEffort(dl interface{ SetWriteDeadline(time.Time) error }, typ MessageType, p []byte) error {
+	if !c.msgWriter.mu.tryLock() {
+		return ErrWouldBlock
+	}
+	defer c.msgWriter.mu.unlock()
+	if !c.writeFrameMu.tryLock() {
+		return ErrWouldBlock
+	}
+	defer c.writeFrameMu.unlock()
+	if c.closeSent.Load() {
+		return fmt.Errorf("failed to write best effort msg: %w", errCloseSent)
+	}
+	if c.bw.Buffered() > 0 {
+		return ErrWouldBlock
+	}
+
+	frame, err := c.bestEffortFrame(typ, p)
+	if err != nil {
+		return fmt.Errorf("failed to write best effort msg: %w", err)
+	}
+
+	// The write deadlines bound the write. The timeout loop only closes the
+	// connection if they fail to.
+	ctx, cancel := context.WithTimeout(context.Background(), bestEffortTailTimeout*2)
+	defer cancel()
+	select {
+	case <-c.closed:
+		return fmt.Errorf("failed to write best effort msg: %w", net.ErrClosed)
+	case c.writeTimeout <- ctx:
+	}
+
+	err = c.writeNonBlocking(dl, frame)
+	if err != nil && !errors.Is(err, ErrWouldBlock) {
+		c.close()
+		return fmt.Errorf("failed to write best effort msg: %w", err)
+	}
+
+	select {
+	case <-c.closed:
+		return fmt.Errorf("failed to write best effort msg: %w", net.ErrClosed)
+	case c.writeTimeout <- context.Background():
+	}
+	if err != nil {
+		return err
+	}
+
+	c.stats.messagesWritten.Add(1)
+	c.stats.bytesWritten.Add(int64(len(p)))
+	return nil
+}
+
+// bestEffortFrame encodes p as a single uncompressed frame.
+func (c *Conn) bestEffortFrame(typ MessageType, p []byte) ([]byte, error) {
+	if len(c.exts) > 0 {
+		var err error
+		p, err = c.transform(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	h := header{
+		fin:           true,
+		opcode:        opcode(typ),
+		payloadLength: int64(len(p)),
+	}
+	if c.client && !c.disableMasking {
+		var key [4]byte
+		_, err := io.ReadFull(rand.Reader, key[:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate masking key: %w", err)
+		}
+		h.masked = true
+		h.maskKey = binary.LittleEndian.Uint32(key[:])
+	}
+	c.observeFrame(DirectionWrite, h)
+
+	var buf bytes.Buffer
+	bw := bufio.NewWriterSize(&buf, 16)
+	var headerBuf [8]byte
+	err := writeFrameHeader(h, bw, headerBuf[:])
+	if err != nil {
+		return nil, err
+	}
+	err = bw.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	headerLen := buf.Len()
+	buf.Write(p)
+	frame := buf.Bytes()
+	if h.masked {
+		mask(frame[headerLen:], h.maskKey)
+	}
+	return frame, nil
+}
+
+// writeNonBlocking writes frame to the underlying connection. ErrWouldBlock
+// is returned if nothing could be written within bestEffortTimeout.
+func (c *Conn) writeNonBlocking(dl interface{ SetWriteDeadline(time.Time) error }, frame []byte) error {
+	err := dl.SetWriteDeadline(time.Now().Add(bestEffortTimeout))
+	if err != nil {
+		return fmt.Errorf("failed to set write deadline: %w", err)
+	}
+	n, err := c.rwc.Write(frame)
+	if err != nil && n > 0 && errors.Is(err, os.ErrDeadlineExceeded) {
+		// Finish the partially written frame.
+		err = dl.SetWriteDeadline(time.Now().Add(bestEffortTailTimeout))
+		if err != nil {
+			return fmt.Errorf("failed to set write deadline: %w", err)
+		}
+		_, err = c.rwc.Write(frame[n:])
+		if err != nil {
+			return fmt.Errorf("failed to write rest of frame: %w", err)
+		}
+	}
+	resetErr := dl.SetWriteDeadline(time.Time{})
+	if err != nil {
+		if n == 0 && errors.Is(err, os.ErrDeadlineExceeded) && resetErr == nil {
+			return ErrWouldBlock
+		}
+		return err
+	}
+	if resetErr != nil {
+		return fmt.Errorf("failed to reset write deadline: %w", resetErr)
+	}
+	return nil
+}
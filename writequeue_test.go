@@ -0,0 +1,159 @@
+//go:build !js
+// +build !js
+
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+func TestWriteBuffered(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, &websocket.AcceptOptions{
+		WriteQueueSize: 1,
+	})
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	// c1 is not reading so at most one message is being written
+	// and one is queued before the queue is full.
+	var queued int
+	for ; queued < 3; queued++ {
+		err := c2.WriteBuffered(ctx, websocket.MessageText, []byte(strconv.Itoa(queued)))
+		if errors.Is(err, websocket.ErrWriteBufferFull) {
+			break
+		}
+		assert.Success(t, err)
+	}
+	if queued == 0 || queued > 2 {
+		t.Fatalf("expected ErrWriteBufferFull after 1 or 2 messages: queued %v", queued)
+	}
+
+	for i := 0; i < queued; i++ {
+		_, b, err := c1.Read(ctx)
+		assert.Success(t, err)
+		assert.Equal(t, "msg", strconv.Itoa(i), string(b))
+	}
+}
+
+func TestWriteBestEffort(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	msg := bytes.Repeat([]byte("x"), 1024)
+
+	// A real TCP connection with small kernel buffers is used so that
+	// writes block once they fill up.
+	errs := make(chan error, 1)
+	blocked := make(chan struct{})
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer c.CloseNow()
+
+		errs <- func() error {
+			for i := 0; i < 1e6; i++ {
+				err := c.WriteBestEffort(websocket.MessageBinary, msg)
+				if errors.Is(err, websocket.ErrWouldBlock) {
+					close(blocked)
+					return c.Write(ctx, websocket.MessageText, []byte("done"))
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return errors.New("expected ErrWouldBlock")
+		}()
+	}))
+	s.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			c.(*net.TCPConn).SetWriteBuffer(1 << 16)
+		}
+	}
+	s.Start()
+	defer s.Close()
+
+	c, _, err := websocket.Dial(ctx, s.URL, &websocket.DialOptions{
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					var d net.Dialer
+					c, err := d.DialContext(ctx, network, addr)
+					if err != nil {
+						return nil, err
+					}
+					c.(*net.TCPConn).SetReadBuffer(1 << 16)
+					return c, nil
+				},
+			},
+		},
+	})
+	assert.Success(t, err)
+	defer c.CloseNow()
+	c.SetReadLimit(-1)
+
+	err = c.WriteBestEffort(websocket.MessageBinary, msg)
+	assert.Contains(t, err, "not supported")
+
+	// Do not read until the server has filled the kernel buffers. A message
+	// partially written when they fill up is finished once reading starts.
+	select {
+	case <-blocked:
+	case <-time.After(time.Millisecond * 500):
+	}
+
+	// Every message written before ErrWouldBlock must be intact.
+	for {
+		typ, b, err := c.Read(ctx)
+		assert.Success(t, err)
+		if typ == websocket.MessageText {
+			assert.Equal(t, "msg", "done", string(b))
+			break
+		}
+		if !bytes.Equal(msg, b) {
+			t.Fatalf("corrupted message of length %v", len(b))
+		}
+	}
+	assert.Success(t, <-errs)
+}
+
+func TestWriteBestEffortAfterClose(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	// Reads the close frame which the pipe would otherwise block on.
+	go c1.Read(ctx)
+
+	err := c2.InitiateClose(websocket.StatusNormalClosure, "")
+	assert.Success(t, err)
+
+	err = c2.WriteBestEffort(websocket.MessageBinary, []byte("late"))
+	assert.Contains(t, err, "close frame already sent")
+}
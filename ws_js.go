@@ -3,6 +3,7 @@ package websocket // import "github.com/oarkflow/websocket"
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"syscall/js"
+	"time"
 
 	"github.com/oarkflow/websocket/internal/bpool"
 	"github.com/oarkflow/websocket/internal/wsjs"
@@ -47,6 +49,14 @@ type Conn struct {
 	// read limit for a message in bytes.
 	msgReadLimit atomic.Int64
 
+	readDeadline  atomic.Int64
+	writeDeadline atomic.Int64
+
+	stats connStats
+
+	handshakeStart    time.Time
+	handshakeDuration time.Duration
+
 	closeReadMu  sync.Mutex
 	closeReadCtx context.Context
 
@@ -83,7 +93,7 @@ func (c *Conn) init() {
 	c.closed = make(chan struct{})
 	c.readSignal = make(chan struct{}, 1)
 
-	c.msgReadLimit.Store(32768)
+	c.msgReadLimit.Store(DefaultReadLimit)
 
 	c.releaseOnClose = c.ws.OnClose(func(e wsjs.CloseEvent) {
 		err := CloseError{
@@ -93,6 +103,7 @@ func (c *Conn) init() {
 		// We do not know if we sent or received this close as
 		// its possible the browser triggered it without us
 		// explicitly sending it.
+		c.stats.closeStatus.CompareAndSwap(0, int64(err.Code))
 		c.close(err, e.WasClean)
 
 		c.releaseOnClose()
@@ -148,10 +159,17 @@ func (c *Conn) Read(ctx context.Context) (MessageType, []byte, error) {
 		c.Close(StatusMessageTooBig, err.Error())
 		return 0, nil, err
 	}
+	c.stats.messagesRead.Add(1)
+	c.stats.bytesRead.Add(int64(len(p)))
 	return typ, p, nil
 }
 
 func (c *Conn) read(ctx context.Context) (MessageType, []byte, error) {
+	ctx, cancel := withDeadline(ctx, &c.readDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
 	select {
 	case <-ctx.Done():
 		c.Close(StatusPolicyViolation, "read timed out")
@@ -207,6 +225,8 @@ func (c *Conn) Write(ctx context.Context, typ MessageType, p []byte) error {
 		c.closeWithInternal()
 		return err
 	}
+	c.stats.messagesWritten.Add(1)
+	c.stats.bytesWritten.Add(int64(len(p)))
 	return nil
 }
 
@@ -257,6 +277,7 @@ func (c *Conn) exportedClose(code StatusCode, reason string) error {
 		Code:   code,
 		Reason: reason,
 	})
+	c.stats.closeStatus.CompareAndSwap(0, int64(code))
 
 	c.setCloseErr(ce)
 	err := c.ws.Close(int(code), reason)
@@ -273,10 +294,64 @@ func (c *Conn) exportedClose(code StatusCode, reason string) error {
 
 // Subprotocol returns the negotiated subprotocol.
 // An empty string means the default protocol.
+// It is available as soon as Dial returns as Dial waits for the
+// connection to open.
 func (c *Conn) Subprotocol() string {
 	return c.ws.Subprotocol()
 }
 
+// Extensions returns the negotiated extensions in the format of
+// the Sec-WebSocket-Extensions header.
+// An empty string means no extensions were negotiated.
+func (c *Conn) Extensions() string {
+	return c.ws.Extensions()
+}
+
+// ClientExtensionsOffered always returns an empty string
+// as a Conn in the browser is always a client.
+func (c *Conn) ClientExtensionsOffered() string {
+	return ""
+}
+
+// ServerExtensionsOffered returns the extensions offered by the server
+// which in the browser are the negotiated extensions.
+func (c *Conn) ServerExtensionsOffered() string {
+	return c.ws.Extensions()
+}
+
+// HandshakeStart returns the time the handshake started.
+func (c *Conn) HandshakeStart() time.Time {
+	return c.handshakeStart
+}
+
+// HandshakeDuration returns how long the handshake took.
+func (c *Conn) HandshakeDuration() time.Duration {
+	return c.handshakeDuration
+}
+
+// RemoteAddr always returns nil as the browser does not expose the
+// address of the server.
+func (c *Conn) RemoteAddr() net.Addr {
+	return nil
+}
+
+// TLS always returns nil as the browser does not expose the state
+// of the TLS connection.
+func (c *Conn) TLS() *tls.ConnectionState {
+	return nil
+}
+
+// Stats returns the connection's statistics.
+func (c *Conn) Stats() Stats {
+	return c.stats.load()
+}
+
+// Closed returns a channel that is closed once the connection is closed
+// for any reason.
+func (c *Conn) Closed() <-chan struct{} {
+	return c.closed
+}
+
 // DialOptions represents the options available to pass to Dial.
 type DialOptions struct {
 	// Subprotocols lists the subprotocols to negotiate with the server.
@@ -303,13 +378,15 @@ func dial(ctx context.Context, url string, opts *DialOptions) (*Conn, *http.Resp
 	url = strings.Replace(url, "http://", "ws://", 1)
 	url = strings.Replace(url, "https://", "wss://", 1)
 
+	handshakeStart := time.Now()
 	ws, err := wsjs.New(url, opts.Subprotocols)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	c := &Conn{
-		ws: ws,
+		ws:             ws,
+		handshakeStart: handshakeStart,
 	}
 	c.init()
 
@@ -324,6 +401,7 @@ func dial(ctx context.Context, url string, opts *DialOptions) (*Conn, *http.Resp
 		c.Close(StatusPolicyViolation, "dial timed out")
 		return nil, nil, ctx.Err()
 	case <-opench:
+		c.handshakeDuration = time.Since(handshakeStart)
 		return c, &http.Response{
 			StatusCode: http.StatusSwitchingProtocols,
 		}, nil
@@ -389,6 +467,16 @@ func (w *writer) Close() error {
 	return nil
 }
 
+// Abort discards the buffered message without sending it.
+func (w *writer) Abort() error {
+	if w.closed {
+		return errors.New("cannot abort closed writer")
+	}
+	w.closed = true
+	bpool.Put(w.b)
+	return nil
+}
+
 // CloseRead implements *Conn.CloseRead for wasm.
 func (c *Conn) CloseRead(ctx context.Context) context.Context {
 	c.closeReadMu.Lock()
@@ -412,11 +500,40 @@ func (c *Conn) CloseRead(ctx context.Context) context.Context {
 	return ctx
 }
 
+// bufferedReader implements *Conn.bufferedReader for wasm
+// where every message is buffered.
+func (c *Conn) bufferedReader(ctx context.Context) (MessageType, io.Reader, error) {
+	return c.Reader(ctx)
+}
+
+// contextValue implements *Conn.contextValue for wasm
+// where Context never has any values.
+func (c *Conn) contextValue(key interface{}) interface{} {
+	return nil
+}
+
+// streamBinaryReader implements *Conn.streamBinaryReader for wasm.
+func (c *Conn) streamBinaryReader(ctx context.Context) (MessageType, io.Reader, error) {
+	return c.Reader(ctx)
+}
+
 // SetReadLimit implements *Conn.SetReadLimit for wasm.
 func (c *Conn) SetReadLimit(n int64) {
 	c.msgReadLimit.Store(n)
 }
 
+// SetReadLimitNow implements *Conn.SetReadLimitNow for wasm. Messages are
+// received whole and the limit is checked as they are read so it is the
+// same as SetReadLimit.
+func (c *Conn) SetReadLimitNow(n int64) {
+	c.msgReadLimit.Store(n)
+}
+
+// ReadLimit implements *Conn.ReadLimit for wasm.
+func (c *Conn) ReadLimit() int64 {
+	return c.msgReadLimit.Load()
+}
+
 func (c *Conn) setCloseErr(err error) {
 	c.closeErrOnce.Do(func() {
 		c.closeErr = fmt.Errorf("WebSocket closed: %w", err)
@@ -516,6 +633,18 @@ func CloseStatus(err error) StatusCode {
 	return -1
 }
 
+// CloseReason is a convenience wrapper around Go 1.13's errors.As to grab
+// the status code and reason from a CloseError.
+//
+// ok is false if the passed error is nil or not a CloseError.
+func CloseReason(err error) (code StatusCode, reason string, ok bool) {
+	var ce CloseError
+	if errors.As(err, &ce) {
+		return ce.Code, ce.Reason, true
+	}
+	return -1, "", false
+}
+
 // CompressionMode represents the modes available to the deflate extension.
 // See https://tools.ietf.org/html/rfc7692
 // Works in all browsers except Safari which does not implement the deflate extension.
@@ -559,6 +688,10 @@ const (
 	MessageText MessageType = iota + 1
 	// MessageBinary is for binary messages like protobufs.
 	MessageBinary
+	// MessagePing is for ping frames returned with the DeliverControlFrames option.
+	MessagePing
+	// MessagePong is for pong frames returned with the DeliverControlFrames option.
+	MessagePong
 )
 
 type mu struct {
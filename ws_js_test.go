@@ -0,0 +1,50 @@
+//go:build js
+// +build js
+
+package websocket_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+)
+
+// echoServerURL is set by ci/test.sh to the URL printed by
+// internal/test/wsjstest.
+var echoServerURL = os.Getenv("WS_ECHO_SERVER_URL")
+
+func TestWasm(t *testing.T) {
+	t.Parallel()
+
+	if echoServerURL == "" {
+		t.Skip("WS_ECHO_SERVER_URL is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	c, resp, err := websocket.Dial(ctx, echoServerURL, nil)
+	assert.Success(t, err)
+	defer c.Close(websocket.StatusInternalError, "")
+
+	assert.Equal(t, "response code", 101, resp.StatusCode)
+	if !strings.Contains(c.Extensions(), "permessage-deflate") {
+		t.Fatalf("expected permessage-deflate in the negotiated extensions: %q", c.Extensions())
+	}
+	assert.Equal(t, "server extensions offered", c.Extensions(), c.ServerExtensionsOffered())
+	assert.Equal(t, "client extensions offered", "", c.ClientExtensionsOffered())
+
+	for i := 0; i < 5; i++ {
+		err = wstest.Echo(ctx, c, 4096)
+		assert.Success(t, err)
+	}
+
+	err = c.Close(websocket.StatusNormalClosure, "")
+	assert.Success(t, err)
+}
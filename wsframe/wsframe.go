@@ -0,0 +1,96 @@
+// Package wsframe provides helpers for writing and reading length-prefixed
+// frames within a single WebSocket message.
+//
+// It is for tunneling a stream of sub-messages over one long-lived message
+// written with Conn.Writer and read with Conn.Reader. Each frame is its length
+// as an unsigned varint, as encoded by binary.PutUvarint, followed by its payload.
+package wsframe // import "github.com/oarkflow/websocket/wsframe"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// maxPrealloc is the largest frame allocated in full from its length prefix.
+// Larger frames grow as their payload is read so that a bogus length prefix
+// cannot allocate more than is actually received.
+const maxPrealloc = 64 << 10
+
+// WriteFrame writes p to w as a length-prefixed frame.
+func WriteFrame(w io.Writer, p []byte) error {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], uint64(len(p)))
+
+	_, err := w.Write(b[:n])
+	if err != nil {
+		return fmt.Errorf("failed to write frame length: %w", err)
+	}
+	_, err = w.Write(p)
+	if err != nil {
+		return fmt.Errorf("failed to write frame payload: %w", err)
+	}
+	return nil
+}
+
+// ReadFrame reads the payload of the next length-prefixed frame from r.
+//
+// It returns io.EOF if r is at the end, e.g. of the WebSocket message, before
+// the next frame and io.ErrUnexpectedEOF if r ends in the middle of a frame.
+// The size of a frame is bounded by the read limit of the connection.
+func ReadFrame(r io.Reader) ([]byte, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = byteReader{r}
+	}
+
+	n, err := binary.ReadUvarint(br)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read frame length: %w", err)
+	}
+	if n > math.MaxInt32 {
+		return nil, fmt.Errorf("failed to read frame: length %v too large", n)
+	}
+
+	if n <= maxPrealloc {
+		p := make([]byte, n)
+		_, err = io.ReadFull(r, p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read frame payload: %w", unexpectedEOF(err))
+		}
+		return p, nil
+	}
+
+	p, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read frame payload: %w", err)
+	}
+	if uint64(len(p)) < n {
+		return nil, fmt.Errorf("failed to read frame payload: %w", io.ErrUnexpectedEOF)
+	}
+	return p, nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// byteReader reads a single byte at a time from an io.Reader
+// that does not implement io.ByteReader.
+type byteReader struct {
+	r io.Reader
+}
+
+func (br byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(br.r, b[:])
+	return b[0], err
+}
@@ -0,0 +1,133 @@
+//go:build !js
+// +build !js
+
+package wsframe_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+	"github.com/oarkflow/websocket/wsframe"
+)
+
+func TestFrames(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	frames := [][]byte{
+		[]byte("first"),
+		{},
+		bytes.Repeat([]byte("x"), 300),
+		bytes.Repeat([]byte("large"), 100<<10),
+		[]byte("last"),
+	}
+
+	writeErr := make(chan error, 1)
+	go func() {
+		writeErr <- func() error {
+			w, err := c1.Writer(ctx, websocket.MessageBinary)
+			if err != nil {
+				return err
+			}
+			for _, p := range frames {
+				err = wsframe.WriteFrame(w, p)
+				if err != nil {
+					return err
+				}
+			}
+			return w.Close()
+		}()
+	}()
+
+	c2.SetReadLimit(-1)
+	typ, r, err := c2.Reader(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "message type", websocket.MessageBinary, typ)
+	for i, exp := range frames {
+		p, err := wsframe.ReadFrame(r)
+		assert.Success(t, err)
+		assert.Equal(t, "frame "+strconv.Itoa(i), exp, p)
+	}
+	_, err = wsframe.ReadFrame(r)
+	assert.ErrorIs(t, io.EOF, err)
+	assert.Success(t, <-writeErr)
+}
+
+func TestReadFrame(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	err := wsframe.WriteFrame(&b, []byte("hello"))
+	assert.Success(t, err)
+	encoded := b.Bytes()
+	assert.Equal(t, "encoded", append([]byte{5}, "hello"...), encoded)
+
+	t.Run("oneByteReader", func(t *testing.T) {
+		t.Parallel()
+
+		// Does not implement io.ByteReader.
+		r := iotest.OneByteReader(bytes.NewReader(encoded))
+		p, err := wsframe.ReadFrame(r)
+		assert.Success(t, err)
+		assert.Equal(t, "frame", "hello", string(p))
+		_, err = wsframe.ReadFrame(r)
+		assert.ErrorIs(t, io.EOF, err)
+	})
+
+	t.Run("truncatedPayload", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := wsframe.ReadFrame(bytes.NewReader(encoded[:3]))
+		assert.ErrorIs(t, io.ErrUnexpectedEOF, err)
+	})
+
+	t.Run("truncatedLength", func(t *testing.T) {
+		t.Parallel()
+
+		// The continuation bit promises another byte of the length.
+		_, err := wsframe.ReadFrame(bytes.NewReader([]byte{0x80}))
+		assert.ErrorIs(t, io.ErrUnexpectedEOF, err)
+	})
+
+	t.Run("bogusLength", func(t *testing.T) {
+		t.Parallel()
+
+		// A length of 1 MB with only a few bytes of payload.
+		var b bytes.Buffer
+		err := wsframe.WriteFrame(&b, make([]byte, 1<<20))
+		assert.Success(t, err)
+		_, err = wsframe.ReadFrame(bytes.NewReader(b.Bytes()[:16]))
+		assert.ErrorIs(t, io.ErrUnexpectedEOF, err)
+	})
+
+	t.Run("writeError", func(t *testing.T) {
+		t.Parallel()
+
+		errWrite := errors.New("write failed")
+		err := wsframe.WriteFrame(failingWriter{errWrite}, []byte("hello"))
+		assert.ErrorIs(t, errWrite, err)
+	})
+}
+
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
@@ -0,0 +1,68 @@
+// Package wsgob provides helpers for reading and writing gob messages.
+//
+// Each message is a self contained gob stream so messages
+// can be decoded independently of each other.
+package wsgob // import "github.com/oarkflow/websocket/wsgob"
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/bpool"
+	"github.com/oarkflow/websocket/internal/errd"
+)
+
+// Read reads a gob message from c into v.
+// It will reuse buffers in between calls to avoid allocations.
+func Read(ctx context.Context, c *websocket.Conn, v interface{}) error {
+	return read(ctx, c, v)
+}
+
+func read(ctx context.Context, c *websocket.Conn, v interface{}) (err error) {
+	defer errd.Wrap(&err, "failed to read gob message")
+
+	_, r, err := c.Reader(ctx)
+	if err != nil {
+		return err
+	}
+
+	b := bpool.Get()
+	defer bpool.Put(b)
+
+	_, err = b.ReadFrom(r)
+	if err != nil {
+		return err
+	}
+
+	err = gob.NewDecoder(b).Decode(v)
+	if err != nil {
+		c.Close(websocket.StatusInvalidFramePayloadData, "failed to decode gob")
+		return fmt.Errorf("failed to decode gob: %w", err)
+	}
+
+	return nil
+}
+
+// Write writes the gob message v to c.
+// It will reuse buffers in between calls to avoid allocations.
+func Write(ctx context.Context, c *websocket.Conn, v interface{}) error {
+	return write(ctx, c, v)
+}
+
+func write(ctx context.Context, c *websocket.Conn, v interface{}) (err error) {
+	defer errd.Wrap(&err, "failed to write gob message")
+
+	b := bpool.Get()
+	defer bpool.Put(b)
+
+	// gob.Encoder writes the type information and the value separately
+	// and so the stream must be buffered to write it as a single message.
+	err = gob.NewEncoder(b).Encode(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode gob: %w", err)
+	}
+
+	return c.Write(ctx, websocket.MessageBinary, b.Bytes())
+}
@@ -0,0 +1,85 @@
+//go:build !js
+// +build !js
+
+package wsgob_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+	"github.com/oarkflow/websocket/wsgob"
+)
+
+type request struct {
+	Method string
+	Args   []int
+	Meta   map[string]string
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	exp := []request{
+		{Method: "sum", Args: []int{1, 2, 3}},
+		{Method: "echo", Meta: map[string]string{"id": "42"}},
+	}
+	errs := make(chan error, 1)
+	go func() {
+		for _, req := range exp {
+			err := wsgob.Write(ctx, c1, req)
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+		errs <- nil
+	}()
+
+	// Every message carries its own type information so each
+	// is decoded by a fresh decoder.
+	for _, req := range exp {
+		var act request
+		err := wsgob.Read(ctx, c2, &act)
+		assert.Success(t, err)
+		assert.Equal(t, "request", req, act)
+	}
+	assert.Success(t, <-errs)
+}
+
+func TestReadCorrupted(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	// The peer keeps reading so that the close handshake started
+	// by the failed decode can complete.
+	errs := make(chan error, 1)
+	go func() {
+		err := c1.Write(ctx, websocket.MessageBinary, []byte{0xff, 0x00, 0x13, 0x37})
+		if err == nil {
+			_, _, err = c1.Read(ctx)
+		}
+		errs <- err
+	}()
+
+	var act request
+	err := wsgob.Read(ctx, c2, &act)
+	assert.Contains(t, err, "failed to decode gob")
+	assert.Equal(t, "close status", websocket.StatusInvalidFramePayloadData, websocket.CloseStatus(<-errs))
+}
@@ -0,0 +1,90 @@
+package wshub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/oarkflow/websocket"
+)
+
+// Hub tracks active connections so that they may all be closed at once,
+// e.g. during http.Server.Shutdown.
+//
+// Connections are automatically removed once they are closed.
+// Hub.Add can be used directly as websocket.AcceptOptions.OnConn.
+//
+// The zero value is ready to use. All methods may be called concurrently.
+type Hub struct {
+	mu    sync.Mutex
+	conns map[*websocket.Conn]struct{}
+}
+
+// Add adds c to the hub.
+func (h *Hub) Add(c *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conns == nil {
+		h.conns = make(map[*websocket.Conn]struct{})
+	}
+	if _, ok := h.conns[c]; ok {
+		return
+	}
+	h.conns[c] = struct{}{}
+	go h.removeOnClose(c)
+}
+
+func (h *Hub) removeOnClose(c *websocket.Conn) {
+	<-c.Closed()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, c)
+}
+
+// Len returns the number of active connections in the hub.
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.conns)
+}
+
+// CloseAll closes every connection in the hub with the given status code and reason.
+//
+// The close handshakes are performed concurrently. If ctx is cancelled before
+// they complete, the remaining connections are closed without a handshake and
+// ctx.Err() is returned. Otherwise the first close error is returned.
+//
+// Use StatusGoingAway when shutting down so that clients reconnect elsewhere.
+func (h *Hub) CloseAll(ctx context.Context, code websocket.StatusCode, reason string) error {
+	h.mu.Lock()
+	conns := make([]*websocket.Conn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.Unlock()
+
+	errs := make(chan error, len(conns))
+	for _, c := range conns {
+		go func(c *websocket.Conn) {
+			errs <- c.Close(code, reason)
+		}(c)
+	}
+
+	var firstErr error
+	for range conns {
+		select {
+		case err := <-errs:
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("failed to close all connections: %w", err)
+			}
+		case <-ctx.Done():
+			for _, c := range conns {
+				c.CloseNow()
+			}
+			return fmt.Errorf("failed to close all connections: %w", ctx.Err())
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,68 @@
+//go:build !js
+// +build !js
+
+package wshub_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/wshub"
+)
+
+func TestHub(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var hub wshub.Hub
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			OnConn: hub.Add,
+		})
+		if err != nil {
+			return
+		}
+		c.CloseRead(context.Background())
+	}))
+	defer s.Close()
+
+	const n = 3
+	var conns []*websocket.Conn
+	for i := 0; i < n; i++ {
+		c, _, err := websocket.Dial(ctx, s.URL, nil)
+		assert.Success(t, err)
+		defer c.CloseNow()
+		conns = append(conns, c)
+	}
+	waitLen(t, ctx, &hub, n)
+
+	closeErr := make(chan error, 1)
+	go func() {
+		closeErr <- hub.CloseAll(ctx, websocket.StatusGoingAway, "shutting down")
+	}()
+	for _, c := range conns {
+		_, _, err := c.Read(ctx)
+		assert.Equal(t, "close status", websocket.StatusGoingAway, websocket.CloseStatus(err))
+	}
+	assert.Success(t, <-closeErr)
+	waitLen(t, ctx, &hub, 0)
+}
+
+func waitLen(t *testing.T, ctx context.Context, hub *wshub.Hub, n int) {
+	t.Helper()
+
+	for hub.Len() != n {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected %v connections but got %v", n, hub.Len())
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
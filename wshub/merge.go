@@ -0,0 +1,67 @@
+package wshub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/oarkflow/websocket"
+)
+
+// MergedMessage is a message or read error delivered by Merge.
+type MergedMessage struct {
+	Conn        *websocket.Conn
+	MessageType websocket.MessageType
+	Data        []byte
+	// Err is the error that ended reading from Conn.
+	// No more messages from Conn are delivered after it.
+	Err error
+}
+
+// Merge reads from every connection concurrently and delivers their messages
+// on the returned channel. When reading from a connection fails, e.g. because
+// it was closed, the error is delivered and the connection is removed from the set.
+//
+// The channel is closed once every connection has been removed or ctx is cancelled.
+// As with Read, cancelling ctx closes the connections that are being read from.
+// The caller must receive from the channel until it is closed.
+func Merge(ctx context.Context, conns ...*websocket.Conn) <-chan MergedMessage {
+	ch := make(chan MergedMessage)
+
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *websocket.Conn) {
+			defer wg.Done()
+			mergeConn(ctx, c, ch)
+		}(c)
+	}
+
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	return ch
+}
+
+func mergeConn(ctx context.Context, c *websocket.Conn, ch chan<- MergedMessage) {
+	for {
+		typ, p, err := c.Read(ctx)
+		msg := MergedMessage{
+			Conn:        c,
+			MessageType: typ,
+			Data:        p,
+			Err:         err,
+		}
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		select {
+		case ch <- msg:
+		case <-ctx.Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
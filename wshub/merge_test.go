@@ -0,0 +1,81 @@
+//go:build !js
+// +build !js
+
+package wshub_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+	"github.com/oarkflow/websocket/wshub"
+)
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	const n = 3
+	var clients, servers []*websocket.Conn
+	for i := 0; i < n; i++ {
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+		clients = append(clients, c1)
+		servers = append(servers, c2)
+	}
+
+	merged := wshub.Merge(ctx, servers...)
+	for i, c := range clients {
+		go func(i int, c *websocket.Conn) {
+			err := c.Write(ctx, websocket.MessageText, []byte(fmt.Sprint(i)))
+			if err == nil {
+				c.Close(websocket.StatusNormalClosure, "")
+			}
+		}(i, c)
+	}
+
+	got := make(map[*websocket.Conn]string)
+	closed := 0
+	for msg := range merged {
+		if msg.Err != nil {
+			assert.Equal(t, "close status", websocket.StatusNormalClosure, websocket.CloseStatus(msg.Err))
+			closed++
+			continue
+		}
+		assert.Equal(t, "message type", websocket.MessageText, msg.MessageType)
+		got[msg.Conn] = string(msg.Data)
+	}
+	assert.Equal(t, "closed connections", n, closed)
+	for i, c := range servers {
+		assert.Equal(t, "message", fmt.Sprint(i), got[c])
+	}
+}
+
+func TestMergeCancel(t *testing.T) {
+	t.Parallel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	merged := wshub.Merge(ctx, c2)
+	cancel()
+
+	timer := time.NewTimer(time.Second * 5)
+	defer timer.Stop()
+	select {
+	case msg, ok := <-merged:
+		assert.Equal(t, "channel open", false, ok)
+		assert.Equal(t, "message", wshub.MergedMessage{}, msg)
+	case <-timer.C:
+		t.Fatal("merged channel not closed after the context was cancelled")
+	}
+}
@@ -0,0 +1,113 @@
+package wshub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/oarkflow/websocket"
+)
+
+// Topics fans out messages to the connections subscribed to a topic.
+//
+// A connection is automatically unsubscribed from all topics once it is closed.
+//
+// The zero value is ready to use. All methods may be called concurrently.
+type Topics struct {
+	mu     sync.Mutex
+	topics map[string]map[*websocket.Conn]struct{}
+	conns  map[*websocket.Conn]map[string]struct{}
+}
+
+// Subscribe subscribes c to topic.
+func (t *Topics) Subscribe(c *websocket.Conn, topic string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.topics == nil {
+		t.topics = make(map[string]map[*websocket.Conn]struct{})
+		t.conns = make(map[*websocket.Conn]map[string]struct{})
+	}
+
+	subs, ok := t.conns[c]
+	if !ok {
+		subs = make(map[string]struct{})
+		t.conns[c] = subs
+		go t.removeOnClose(c)
+	}
+	subs[topic] = struct{}{}
+
+	conns, ok := t.topics[topic]
+	if !ok {
+		conns = make(map[*websocket.Conn]struct{})
+		t.topics[topic] = conns
+	}
+	conns[c] = struct{}{}
+}
+
+// Unsubscribe unsubscribes c from topic.
+func (t *Topics) Unsubscribe(c *websocket.Conn, topic string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if subs, ok := t.conns[c]; ok {
+		delete(subs, topic)
+	}
+	t.unsubscribe(c, topic)
+}
+
+func (t *Topics) unsubscribe(c *websocket.Conn, topic string) {
+	conns, ok := t.topics[topic]
+	if !ok {
+		return
+	}
+	delete(conns, c)
+	if len(conns) == 0 {
+		delete(t.topics, topic)
+	}
+}
+
+func (t *Topics) removeOnClose(c *websocket.Conn) {
+	<-c.Closed()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for topic := range t.conns[c] {
+		t.unsubscribe(c, topic)
+	}
+	delete(t.conns, c)
+}
+
+// Publish writes a message to every connection subscribed to topic.
+//
+// The writes are performed concurrently and Publish returns once all of them
+// have completed. If any write fails, the first error is returned.
+// As with any write error, the failing connections are closed.
+func (t *Topics) Publish(ctx context.Context, topic string, typ websocket.MessageType, p []byte) error {
+	t.mu.Lock()
+	conns := make([]*websocket.Conn, 0, len(t.topics[topic]))
+	for c := range t.topics[topic] {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(conns))
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *websocket.Conn) {
+			defer wg.Done()
+			errs <- c.Write(ctx, typ, p)
+		}(c)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return fmt.Errorf("failed to publish to topic %q: %w", topic, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+//go:build !js
+// +build !js
+
+package wshub_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+	"github.com/oarkflow/websocket/wshub"
+)
+
+func TestTopics(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, s1 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	c2, s2 := wstest.Pipe(nil, nil)
+	defer c2.CloseNow()
+
+	var topics wshub.Topics
+	topics.Subscribe(s1, "a")
+	topics.Subscribe(s2, "b")
+
+	msgs1, _ := c1.ReadChan(ctx)
+	msgs2, _ := c2.ReadChan(ctx)
+
+	assert.Success(t, topics.Publish(ctx, "a", websocket.MessageText, []byte("to a")))
+	assert.Success(t, topics.Publish(ctx, "b", websocket.MessageText, []byte("to b")))
+
+	assert.Equal(t, "message", "to a", string(readMsg(t, ctx, msgs1)))
+	// The first message read by c2 must be the one published to b.
+	assert.Equal(t, "message", "to b", string(readMsg(t, ctx, msgs2)))
+
+	topics.Unsubscribe(s2, "b")
+	topics.Subscribe(s2, "a")
+	assert.Success(t, topics.Publish(ctx, "a", websocket.MessageText, []byte("to all")))
+	assert.Equal(t, "message", "to all", string(readMsg(t, ctx, msgs1)))
+	assert.Equal(t, "message", "to all", string(readMsg(t, ctx, msgs2)))
+
+	// Closed connections are unsubscribed automatically.
+	s1.CloseNow()
+	s2.CloseNow()
+	for {
+		err := topics.Publish(ctx, "a", websocket.MessageText, []byte("closed"))
+		if err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("closed connections were not unsubscribed: %v", err)
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
+
+func readMsg(t *testing.T, ctx context.Context, msgs <-chan websocket.InboundMessage) []byte {
+	t.Helper()
+
+	select {
+	case m := <-msgs:
+		return m.Data
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+		return nil
+	}
+}
@@ -0,0 +1,2 @@
+// Package wshub provides helpers for managing many WebSocket connections.
+package wshub // import "github.com/oarkflow/websocket/wshub"
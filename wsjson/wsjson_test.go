@@ -0,0 +1,109 @@
+//go:build !js
+// +build !js
+
+package wsjson_test
+
+import (
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+	"github.com/oarkflow/websocket/wsgob"
+	"github.com/oarkflow/websocket/wsjson"
+)
+
+type event struct {
+	Name  string
+	Count int
+}
+
+func TestDispatchByMessageType(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	exp := []event{{"json", 1}, {"gob", 2}}
+	errs := make(chan error, 1)
+	go func() {
+		err := wsjson.Write(ctx, c1, exp[0])
+		if err == nil {
+			err = wsgob.Write(ctx, c1, exp[1])
+		}
+		errs <- err
+	}()
+
+	for _, ev := range exp {
+		typ, r, err := c2.Reader(ctx)
+		assert.Success(t, err)
+
+		// The type decides which decoder reads the payload of the same reader.
+		var act event
+		switch typ {
+		case websocket.MessageText:
+			err = json.NewDecoder(r).Decode(&act)
+		case websocket.MessageBinary:
+			err = gob.NewDecoder(r).Decode(&act)
+		}
+		assert.Success(t, err)
+		assert.Equal(t, "event", ev, act)
+
+		// Reads the rest of the message such as the newline of json.Encoder.
+		_, err = io.Copy(io.Discard, r)
+		assert.Success(t, err)
+	}
+	assert.Success(t, <-errs)
+}
+
+func TestReaderBeforePayload(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	w, err := c1.Writer(ctx, websocket.MessageText)
+	assert.Success(t, err)
+
+	// Only the first frame is sent and the message is not complete.
+	errs := make(chan error, 1)
+	go func() {
+		_, err := w.Write([]byte(`{"Name":`))
+		if err == nil {
+			err = w.(interface{ Flush() error }).Flush()
+		}
+		errs <- err
+	}()
+
+	typ, r, err := c2.Reader(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "type", websocket.MessageText, typ)
+	assert.Success(t, <-errs)
+
+	go func() {
+		_, err := w.Write([]byte(`"late","Count":3}`))
+		if err == nil {
+			err = w.Close()
+		}
+		errs <- err
+	}()
+
+	var act event
+	err = json.NewDecoder(r).Decode(&act)
+	assert.Success(t, err)
+	assert.Equal(t, "event", event{"late", 3}, act)
+	assert.Success(t, <-errs)
+}
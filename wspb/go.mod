@@ -0,0 +1,10 @@
+module github.com/oarkflow/websocket/wspb
+
+go 1.19
+
+replace github.com/oarkflow/websocket => ../
+
+require (
+	github.com/oarkflow/websocket v0.0.0-00010101000000-000000000000
+	google.golang.org/protobuf v1.33.0
+)
@@ -0,0 +1,91 @@
+//go:build !js
+// +build !js
+
+package wspb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+	"github.com/oarkflow/websocket/wspb"
+)
+
+func TestWSPB(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c1, c2 := wstest.Pipe(nil, nil)
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	exp, err := structpb.NewStruct(map[string]interface{}{
+		"name":  "gopher",
+		"count": 42,
+		"tags":  []interface{}{"a", "b"},
+	})
+	assert.Success(t, err)
+
+	for i := 0; i < 2; i++ {
+		go wspb.Write(ctx, c1, exp)
+
+		var act structpb.Struct
+		err = wspb.Read(ctx, c2, &act)
+		assert.Success(t, err)
+		if !proto.Equal(exp, &act) {
+			t.Fatalf("unexpected message: %v", &act)
+		}
+	}
+}
+
+func TestWSPBErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("textMessage", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		go c1.Write(ctx, websocket.MessageText, []byte("{}"))
+		go c1.Read(ctx)
+
+		err := wspb.Read(ctx, c2, &timestamppb.Timestamp{})
+		assert.Contains(t, err, "expected binary message")
+	})
+
+	t.Run("invalidPayload", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		c1, c2 := wstest.Pipe(nil, nil)
+		defer c1.CloseNow()
+		defer c2.CloseNow()
+
+		go c1.Write(ctx, websocket.MessageBinary, []byte{0xff, 0xff, 0xff})
+		errs := make(chan error, 1)
+		go func() {
+			_, _, err := c1.Read(ctx)
+			errs <- err
+		}()
+
+		err := wspb.Read(ctx, c2, &timestamppb.Timestamp{})
+		assert.Contains(t, err, "failed to unmarshal protobuf")
+		assert.Equal(t, "close status", websocket.StatusInvalidFramePayloadData, websocket.CloseStatus(<-errs))
+	})
+}
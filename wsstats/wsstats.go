@@ -0,0 +1,186 @@
+// Package wsstats collects metrics about WebSocket connections.
+//
+// It has no dependencies so that it can be exported to any metrics system.
+// For example, with Prometheus, implement a prometheus.Collector whose Collect
+// method takes a Snapshot and sends a gauge for ActiveConns, counters for the
+// message and byte totals, a counter labeled by status code for CloseCodes and
+// a histogram built with prometheus.MustNewConstHistogram for PingRTT.
+//
+// Round trip times are only recorded for pings sent with Collector.Ping.
+// Pings sent directly with Conn.Ping are not observed.
+package wsstats // import "github.com/oarkflow/websocket/wsstats"
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/oarkflow/websocket"
+)
+
+// DefaultPingBuckets are the default upper bounds of the PingRTT histogram buckets.
+var DefaultPingBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// Collector collects metrics about the connections it tracks.
+//
+// The zero value is ready to use. All methods may be called concurrently.
+type Collector struct {
+	// PingBuckets are the upper bounds of the PingRTT histogram buckets in increasing order.
+	// Defaults to DefaultPingBuckets. It must not be modified after the first Ping.
+	PingBuckets []time.Duration
+
+	mu    sync.Mutex
+	conns map[*websocket.Conn]struct{}
+	// closed holds the totals of the connections that have closed.
+	closed     websocket.Stats
+	closeCodes map[websocket.StatusCode]int64
+	ping       Histogram
+}
+
+// Snapshot holds the metrics collected at a point in time.
+type Snapshot struct {
+	// ActiveConns is the number of tracked connections that are still open.
+	ActiveConns int
+
+	// The totals of all tracked connections, open and closed.
+	MessagesRead    int64
+	BytesRead       int64
+	MessagesWritten int64
+	BytesWritten    int64
+
+	// CloseCodes counts the closed connections by the status code of the first
+	// close frame sent or received. Connections closed without a close frame
+	// are counted under StatusAbnormalClosure.
+	CloseCodes map[websocket.StatusCode]int64
+
+	// PingRTT is the histogram of the round trip times measured by Ping.
+	PingRTT Histogram
+}
+
+// Histogram is a cumulative histogram of durations.
+type Histogram struct {
+	// Buckets are the upper bounds of the buckets.
+	Buckets []time.Duration
+	// Counts[i] is the number of observations less than or equal to Buckets[i].
+	Counts []uint64
+	// Count is the total number of observations.
+	Count uint64
+	// Sum is the sum of all observations.
+	Sum time.Duration
+}
+
+// Track starts tracking c until it is closed.
+//
+// Collector.Track can be used directly as websocket.AcceptOptions.OnConn.
+func (col *Collector) Track(c *websocket.Conn) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+
+	if col.conns == nil {
+		col.conns = make(map[*websocket.Conn]struct{})
+		col.closeCodes = make(map[websocket.StatusCode]int64)
+	}
+	if _, ok := col.conns[c]; ok {
+		return
+	}
+	col.conns[c] = struct{}{}
+	go col.untrackOnClose(c)
+}
+
+func (col *Collector) untrackOnClose(c *websocket.Conn) {
+	<-c.Closed()
+	st := c.Stats()
+
+	col.mu.Lock()
+	defer col.mu.Unlock()
+
+	delete(col.conns, c)
+	addStats(&col.closed, st)
+	code := st.CloseStatus
+	if code == -1 {
+		code = websocket.StatusAbnormalClosure
+	}
+	col.closeCodes[code]++
+}
+
+// Ping pings the peer with c.Ping and records the round trip time
+// in the PingRTT histogram if successful.
+func (col *Collector) Ping(ctx context.Context, c *websocket.Conn) error {
+	start := time.Now()
+	err := c.Ping(ctx)
+	if err != nil {
+		return err
+	}
+	col.observePing(time.Since(start))
+	return nil
+}
+
+func (col *Collector) observePing(rtt time.Duration) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+
+	if col.ping.Buckets == nil {
+		col.ping.Buckets = col.PingBuckets
+		if col.ping.Buckets == nil {
+			col.ping.Buckets = DefaultPingBuckets
+		}
+		col.ping.Counts = make([]uint64, len(col.ping.Buckets))
+	}
+
+	for i, b := range col.ping.Buckets {
+		if rtt <= b {
+			col.ping.Counts[i]++
+		}
+	}
+	col.ping.Count++
+	col.ping.Sum += rtt
+}
+
+// Snapshot returns the metrics collected so far.
+func (col *Collector) Snapshot() Snapshot {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+
+	total := col.closed
+	for c := range col.conns {
+		addStats(&total, c.Stats())
+	}
+
+	closeCodes := make(map[websocket.StatusCode]int64, len(col.closeCodes))
+	for code, n := range col.closeCodes {
+		closeCodes[code] = n
+	}
+
+	ping := col.ping
+	ping.Buckets = append([]time.Duration(nil), ping.Buckets...)
+	ping.Counts = append([]uint64(nil), ping.Counts...)
+
+	return Snapshot{
+		ActiveConns:     len(col.conns),
+		MessagesRead:    total.MessagesRead,
+		BytesRead:       total.BytesRead,
+		MessagesWritten: total.MessagesWritten,
+		BytesWritten:    total.BytesWritten,
+		CloseCodes:      closeCodes,
+		PingRTT:         ping,
+	}
+}
+
+func addStats(total *websocket.Stats, st websocket.Stats) {
+	total.MessagesRead += st.MessagesRead
+	total.BytesRead += st.BytesRead
+	total.MessagesWritten += st.MessagesWritten
+	total.BytesWritten += st.BytesWritten
+}
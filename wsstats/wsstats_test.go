@@ -0,0 +1,63 @@
+//go:build !js
+// +build !js
+
+package wsstats_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oarkflow/websocket"
+	"github.com/oarkflow/websocket/internal/test/assert"
+	"github.com/oarkflow/websocket/internal/test/wstest"
+	"github.com/oarkflow/websocket/wsstats"
+)
+
+func TestCollector(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var col wsstats.Collector
+	c1, c2 := wstest.Pipe(nil, &websocket.AcceptOptions{
+		OnConn: col.Track,
+	})
+	defer c1.CloseNow()
+	defer c2.CloseNow()
+
+	st := col.Snapshot()
+	assert.Equal(t, "active conns", 1, st.ActiveConns)
+
+	go func() {
+		c1.Write(ctx, websocket.MessageText, []byte("hello"))
+	}()
+	_, b, err := c2.Read(ctx)
+	assert.Success(t, err)
+	assert.Equal(t, "read msg", "hello", string(b))
+
+	c1.CloseRead(ctx)
+	c2.CloseRead(ctx)
+	err = col.Ping(ctx, c2)
+	assert.Success(t, err)
+
+	st = col.Snapshot()
+	assert.Equal(t, "messages read", int64(1), st.MessagesRead)
+	assert.Equal(t, "bytes read", int64(5), st.BytesRead)
+	assert.Equal(t, "ping count", uint64(1), st.PingRTT.Count)
+
+	err = c2.Close(websocket.StatusNormalClosure, "")
+	assert.Success(t, err)
+	for col.Snapshot().ActiveConns != 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("connection was not untracked")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	st = col.Snapshot()
+	assert.Equal(t, "messages read", int64(1), st.MessagesRead)
+	assert.Equal(t, "normal closures", int64(1), st.CloseCodes[websocket.StatusNormalClosure])
+}